@@ -0,0 +1,188 @@
+package healthendpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a condition a component depends on is met. Check
+// returns nil when it is and an error describing why not otherwise.
+type Check interface {
+	Name() string
+	Check() error
+}
+
+// NewCheck returns a Check with the given name that calls f.
+func NewCheck(name string, f func() error) Check {
+	return funcCheck{name: name, f: f}
+}
+
+type funcCheck struct {
+	name string
+	f    func() error
+}
+
+func (c funcCheck) Name() string {
+	return c.name
+}
+
+func (c funcCheck) Check() error {
+	return c.f()
+}
+
+// Checks holds the liveness and readiness checks of a component and serves
+// them as JSON. Once shut down, readiness fails regardless of the checks.
+type Checks struct {
+	mu    sync.Mutex
+	live  []*checkState
+	ready []*checkState
+
+	shutdown int32
+}
+
+// NewChecks returns an empty Checks. With no checks the component is live
+// and ready.
+func NewChecks() *Checks {
+	c := &Checks{}
+	c.ready = append(c.ready, newCheckState(NewCheck("shutdown", c.checkShutdown)))
+
+	return c
+}
+
+// AddLiveness adds a check that must pass for the component to be live.
+func (c *Checks) AddLiveness(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.live = append(c.live, newCheckState(check))
+}
+
+// AddReadiness adds a check that must pass for the component to be ready.
+func (c *Checks) AddReadiness(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ready = append(c.ready, newCheckState(check))
+}
+
+// Shutdown marks the component as not ready.
+func (c *Checks) Shutdown() {
+	atomic.StoreInt32(&c.shutdown, 1)
+}
+
+// LiveHandler returns an http.Handler that serves the liveness checks.
+func (c *Checks) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, c.liveChecks())
+	})
+}
+
+// ReadyHandler returns an http.Handler that serves the readiness checks.
+func (c *Checks) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, c.readyChecks())
+	})
+}
+
+func (c *Checks) checkShutdown() error {
+	if atomic.LoadInt32(&c.shutdown) == 1 {
+		return errors.New("shutting down")
+	}
+
+	return nil
+}
+
+func (c *Checks) liveChecks() []*checkState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*checkState(nil), c.live...)
+}
+
+func (c *Checks) readyChecks() []*checkState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*checkState(nil), c.ready...)
+}
+
+// checksResponse is the JSON body served for liveness and readiness.
+type checksResponse struct {
+	Status string          `json:"status"`
+	Checks []checkResponse `json:"checks"`
+}
+
+type checkResponse struct {
+	Name           string    `json:"name"`
+	Status         string    `json:"status"`
+	Message        string    `json:"message,omitempty"`
+	LastTransition time.Time `json:"last_transition"`
+}
+
+func (c *Checks) serve(w http.ResponseWriter, checks []*checkState) {
+	resp := checksResponse{
+		Status: "ok",
+		Checks: make([]checkResponse, 0, len(checks)),
+	}
+	for _, s := range checks {
+		cr := s.run()
+		if cr.Status != "ok" {
+			resp.Status = "failing"
+		}
+		resp.Checks = append(resp.Checks, cr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("failed to write health checks: %s", err)
+	}
+}
+
+// checkState remembers the last status of a check and when it changed.
+type checkState struct {
+	check Check
+
+	mu             sync.Mutex
+	ok             bool
+	lastTransition time.Time
+}
+
+func newCheckState(check Check) *checkState {
+	return &checkState{
+		check: check,
+	}
+}
+
+func (s *checkState) run() checkResponse {
+	err := s.check.Check()
+	ok := err == nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastTransition.IsZero() || ok != s.ok {
+		s.ok = ok
+		s.lastTransition = time.Now()
+	}
+
+	cr := checkResponse{
+		Name:           s.check.Name(),
+		Status:         "ok",
+		LastTransition: s.lastTransition,
+	}
+	if !ok {
+		cr.Status = "failing"
+		cr.Message = err.Error()
+	}
+
+	return cr
+}
@@ -0,0 +1,108 @@
+package healthendpoint_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/healthendpoint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checks", func() {
+	type checkResult struct {
+		Name           string    `json:"name"`
+		Status         string    `json:"status"`
+		Message        string    `json:"message"`
+		LastTransition time.Time `json:"last_transition"`
+	}
+	type result struct {
+		Status string        `json:"status"`
+		Checks []checkResult `json:"checks"`
+	}
+
+	var (
+		checks *healthendpoint.Checks
+		err    error
+	)
+
+	serve := func(h http.Handler) (int, result) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var r result
+		Expect(json.Unmarshal(rec.Body.Bytes(), &r)).To(Succeed())
+
+		return rec.Code, r
+	}
+
+	BeforeEach(func() {
+		err = nil
+		checks = healthendpoint.NewChecks()
+		checks.AddLiveness(healthendpoint.NewCheck("alive", func() error {
+			return nil
+		}))
+		checks.AddReadiness(healthendpoint.NewCheck("dependency", func() error {
+			return err
+		}))
+	})
+
+	It("reports each liveness check", func() {
+		code, r := serve(checks.LiveHandler())
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(r.Status).To(Equal("ok"))
+		Expect(r.Checks).To(HaveLen(1))
+		Expect(r.Checks[0].Name).To(Equal("alive"))
+		Expect(r.Checks[0].Status).To(Equal("ok"))
+	})
+
+	It("reports failing readiness checks with their message", func() {
+		code, r := serve(checks.ReadyHandler())
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(r.Status).To(Equal("ok"))
+
+		err = errors.New("not connected")
+		code, r = serve(checks.ReadyHandler())
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(r.Status).To(Equal("failing"))
+
+		var dependency checkResult
+		for _, c := range r.Checks {
+			if c.Name == "dependency" {
+				dependency = c
+			}
+		}
+		Expect(dependency.Status).To(Equal("failing"))
+		Expect(dependency.Message).To(Equal("not connected"))
+	})
+
+	It("records when the status of a check last changed", func() {
+		_, r := serve(checks.ReadyHandler())
+		first := r.Checks[1].LastTransition
+
+		_, r = serve(checks.ReadyHandler())
+		Expect(r.Checks[1].LastTransition).To(Equal(first))
+
+		err = errors.New("not connected")
+		_, r = serve(checks.ReadyHandler())
+		Expect(r.Checks[1].LastTransition).To(BeTemporally(">", first))
+	})
+
+	It("is not ready once shut down", func() {
+		checks.Shutdown()
+
+		code, r := serve(checks.ReadyHandler())
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(r.Checks[0].Name).To(Equal("shutdown"))
+		Expect(r.Checks[0].Status).To(Equal("failing"))
+
+		code, _ = serve(checks.LiveHandler())
+		Expect(code).To(Equal(http.StatusOK))
+	})
+})
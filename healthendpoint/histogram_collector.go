@@ -0,0 +1,41 @@
+package healthendpoint
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HistogramCollector is a prometheus.Collector that reports a histogram that
+// is maintained outside of prometheus.
+type HistogramCollector struct {
+	desc     *prometheus.Desc
+	snapshot func() (count uint64, sum float64, buckets map[float64]uint64)
+}
+
+// NewHistogramCollector returns a HistogramCollector that reads the current
+// count, sum and cumulative bucket counts from the given function each time
+// it is collected.
+func NewHistogramCollector(
+	opts prometheus.HistogramOpts,
+	snapshot func() (count uint64, sum float64, buckets map[float64]uint64),
+) *HistogramCollector {
+	return &HistogramCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			nil,
+			opts.ConstLabels,
+		),
+		snapshot: snapshot,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *HistogramCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *HistogramCollector) Collect(ch chan<- prometheus.Metric) {
+	count, sum, buckets := c.snapshot()
+	ch <- prometheus.MustNewConstHistogram(c.desc, count, sum, buckets)
+}
@@ -0,0 +1,43 @@
+package healthendpoint_test
+
+import (
+	"code.cloudfoundry.org/loggregator/healthendpoint"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HistogramCollector", func() {
+	It("reports the histogram", func() {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(healthendpoint.NewHistogramCollector(
+			prometheus.HistogramOpts{
+				Namespace:   "loggregator",
+				Subsystem:   "test",
+				Name:        "messageSize",
+				Help:        "Size of messages",
+				ConstLabels: prometheus.Labels{"direction": "in"},
+			},
+			func() (uint64, float64, map[float64]uint64) {
+				return 3, 300, map[float64]uint64{64: 1, 128: 3}
+			},
+		))
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		Expect(families[0].GetName()).To(Equal("loggregator_test_messageSize"))
+
+		metrics := families[0].GetMetric()
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetLabel()[0].GetValue()).To(Equal("in"))
+
+		h := metrics[0].GetHistogram()
+		Expect(h.GetSampleCount()).To(Equal(uint64(3)))
+		Expect(h.GetSampleSum()).To(Equal(300.0))
+		Expect(h.GetBucket()).To(HaveLen(2))
+		Expect(h.GetBucket()[1].GetCumulativeCount()).To(Equal(uint64(3)))
+	})
+})
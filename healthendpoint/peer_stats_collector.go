@@ -0,0 +1,80 @@
+package healthendpoint
+
+import (
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PeerStatsCollector is a prometheus.Collector that reports the bytes and
+// messages exchanged with each gRPC peer. Each is reported as a counter
+// labeled with the address and identity of the peer, the RPC method and the
+// direction.
+type PeerStatsCollector struct {
+	bytes    *prometheus.Desc
+	messages *prometheus.Desc
+	stats    func() []plumbing.PeerStat
+}
+
+// NewPeerStatsCollector returns a PeerStatsCollector that reads the current
+// totals from the given function each time it is collected. The counters
+// are named peerBytes and peerMessages within the given namespace and
+// subsystem.
+func NewPeerStatsCollector(
+	namespace string,
+	subsystem string,
+	stats func() []plumbing.PeerStat,
+) *PeerStatsCollector {
+	labels := []string{"addr", "identity", "method", "direction"}
+
+	return &PeerStatsCollector{
+		bytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "peerBytes"),
+			"Payload bytes exchanged with each gRPC peer",
+			labels,
+			nil,
+		),
+		messages: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "peerMessages"),
+			"Messages exchanged with each gRPC peer",
+			labels,
+			nil,
+		),
+		stats: stats,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *PeerStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.messages
+}
+
+// Collect implements prometheus.Collector.
+func (c *PeerStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.stats() {
+		c.collect(ch, c.bytes, s, s.BytesIn, s.BytesOut)
+		c.collect(ch, c.messages, s, s.MessagesIn, s.MessagesOut)
+	}
+}
+
+func (c *PeerStatsCollector) collect(
+	ch chan<- prometheus.Metric,
+	desc *prometheus.Desc,
+	s plumbing.PeerStat,
+	in uint64,
+	out uint64,
+) {
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.CounterValue,
+		float64(in),
+		s.Addr, s.Identity, s.Method, "in",
+	)
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.CounterValue,
+		float64(out),
+		s.Addr, s.Identity, s.Method, "out",
+	)
+}
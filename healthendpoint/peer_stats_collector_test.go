@@ -0,0 +1,60 @@
+package healthendpoint_test
+
+import (
+	"code.cloudfoundry.org/loggregator/healthendpoint"
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerStatsCollector", func() {
+	It("reports bytes and messages for each peer in each direction", func() {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(healthendpoint.NewPeerStatsCollector(
+			"loggregator",
+			"test",
+			func() []plumbing.PeerStat {
+				return []plumbing.PeerStat{
+					{
+						Addr:        "10.0.0.1",
+						Identity:    "metron",
+						Method:      "/loggregator.v2.Ingress/Sender",
+						BytesIn:     100,
+						BytesOut:    10,
+						MessagesIn:  2,
+						MessagesOut: 1,
+					},
+				}
+			},
+		))
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(2))
+
+		values := make(map[string]float64)
+		for _, f := range families {
+			for _, m := range f.GetMetric() {
+				labels := make(map[string]string)
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				Expect(labels).To(HaveKeyWithValue("addr", "10.0.0.1"))
+				Expect(labels).To(HaveKeyWithValue("identity", "metron"))
+				Expect(labels).To(HaveKeyWithValue("method", "/loggregator.v2.Ingress/Sender"))
+
+				values[f.GetName()+":"+labels["direction"]] = m.GetCounter().GetValue()
+			}
+		}
+
+		Expect(values).To(Equal(map[string]float64{
+			"loggregator_test_peerBytes:in":     100,
+			"loggregator_test_peerBytes:out":    10,
+			"loggregator_test_peerMessages:in":  2,
+			"loggregator_test_peerMessages:out": 1,
+		}))
+	})
+})
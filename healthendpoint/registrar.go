@@ -1,14 +1,28 @@
 package healthendpoint
 
 import (
+	"errors"
 	"log"
+	"strings"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// ErrUnknownMetric is returned when a metric is looked up by a name that was
+// never registered.
+var ErrUnknownMetric = errors.New("unknown health metric")
+
+// ErrTooManySeries is returned when a labeled vector would grow beyond its
+// maximum number of label sets.
+var ErrTooManySeries = errors.New("too many series for health metric")
+
 // Registrar maintains a list of metrics to be served by the health endpoint
-// server.
+// server. Metrics can be given at construction or registered at runtime.
 type Registrar struct {
+	registerer prometheus.Registerer
+
+	mu     sync.RWMutex
 	gauges map[string]prometheus.Gauge
 }
 
@@ -19,41 +33,262 @@ func New(registrar prometheus.Registerer, gauges map[string]prometheus.Gauge) *R
 		registrar.MustRegister(c)
 	}
 
+	g := make(map[string]prometheus.Gauge, len(gauges))
+	for name, gauge := range gauges {
+		g[name] = gauge
+	}
+
 	return &Registrar{
-		gauges: gauges,
+		registerer: registrar,
+		gauges:     g,
 	}
 }
 
-// Set will set the given value on the gauge metric with the given name. If
-// the gauge metric is not found the process will exit with a status code of
-// 1.
-func (h *Registrar) Set(name string, value float64) {
+// Gauge returns the gauge metric with the given name. It returns
+// ErrUnknownMetric if the gauge was never registered.
+func (h *Registrar) Gauge(name string) (prometheus.Gauge, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	g, ok := h.gauges[name]
 	if !ok {
-		log.Panicf("Set called for unknown health metric: %s", name)
+		return nil, ErrUnknownMetric
+	}
+
+	return g, nil
+}
+
+// Set will set the given value on the gauge metric with the given name. If
+// the gauge metric is not found the call is logged and ignored.
+func (h *Registrar) Set(name string, value float64) {
+	g, err := h.Gauge(name)
+	if err != nil {
+		log.Printf("Set called for unknown health metric: %s", name)
+		return
 	}
 
 	g.Set(value)
 }
 
 // Inc will increment the gauge metric with the given name by 1. If the gauge
-// metric is not found the process will exit with a status code of 1.
+// metric is not found the call is logged and ignored.
 func (h *Registrar) Inc(name string) {
-	g, ok := h.gauges[name]
-	if !ok {
-		log.Panicf("Inc called for unknown health metric: %s", name)
+	g, err := h.Gauge(name)
+	if err != nil {
+		log.Printf("Inc called for unknown health metric: %s", name)
+		return
 	}
 
 	g.Inc()
 }
 
 // Dec will decrement the gauge metric with the given name by 1. If the gauge
-// metric is not found the process will exit with a status code of 1.
+// metric is not found the call is logged and ignored.
 func (h *Registrar) Dec(name string) {
-	g, ok := h.gauges[name]
-	if !ok {
-		log.Panicf("Dec called for unknown health metric: %s", name)
+	g, err := h.Gauge(name)
+	if err != nil {
+		log.Printf("Dec called for unknown health metric: %s", name)
+		return
 	}
 
 	g.Dec()
 }
+
+// RegisterGauge registers a new gauge and returns it. The gauge can also be
+// updated by its name with Set, Inc and Dec.
+func (h *Registrar) RegisterGauge(opts prometheus.GaugeOpts) (prometheus.Gauge, error) {
+	g := prometheus.NewGauge(opts)
+	if err := h.registerer.Register(g); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.gauges[opts.Name] = g
+	h.mu.Unlock()
+
+	return g, nil
+}
+
+// RegisterCounter registers a new counter and returns it.
+func (h *Registrar) RegisterCounter(opts prometheus.CounterOpts) (prometheus.Counter, error) {
+	c := prometheus.NewCounter(opts)
+	if err := h.registerer.Register(c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// RegisterHistogram registers a new histogram and returns it.
+func (h *Registrar) RegisterHistogram(opts prometheus.HistogramOpts) (prometheus.Histogram, error) {
+	hist := prometheus.NewHistogram(opts)
+	if err := h.registerer.Register(hist); err != nil {
+		return nil, err
+	}
+
+	return hist, nil
+}
+
+// RegisterGaugeVec registers a new gauge vector with the given labels. At
+// most maxSeries distinct label sets are allowed. A maxSeries of 0 or less
+// removes the limit.
+func (h *Registrar) RegisterGaugeVec(
+	opts prometheus.GaugeOpts,
+	labels []string,
+	maxSeries int,
+) (*GaugeVec, error) {
+	v := prometheus.NewGaugeVec(opts, labels)
+	if err := h.registerer.Register(v); err != nil {
+		return nil, err
+	}
+
+	return &GaugeVec{
+		vec:    v,
+		series: newSeriesLimit(maxSeries),
+	}, nil
+}
+
+// RegisterCounterVec registers a new counter vector with the given labels.
+// At most maxSeries distinct label sets are allowed. A maxSeries of 0 or
+// less removes the limit.
+func (h *Registrar) RegisterCounterVec(
+	opts prometheus.CounterOpts,
+	labels []string,
+	maxSeries int,
+) (*CounterVec, error) {
+	v := prometheus.NewCounterVec(opts, labels)
+	if err := h.registerer.Register(v); err != nil {
+		return nil, err
+	}
+
+	return &CounterVec{
+		vec:    v,
+		series: newSeriesLimit(maxSeries),
+	}, nil
+}
+
+// RegisterHistogramVec registers a new histogram vector with the given
+// labels. At most maxSeries distinct label sets are allowed. A maxSeries of
+// 0 or less removes the limit.
+func (h *Registrar) RegisterHistogramVec(
+	opts prometheus.HistogramOpts,
+	labels []string,
+	maxSeries int,
+) (*HistogramVec, error) {
+	v := prometheus.NewHistogramVec(opts, labels)
+	if err := h.registerer.Register(v); err != nil {
+		return nil, err
+	}
+
+	return &HistogramVec{
+		vec:    v,
+		series: newSeriesLimit(maxSeries),
+	}, nil
+}
+
+// GaugeVec is a labeled gauge with a bounded number of label sets.
+type GaugeVec struct {
+	vec    *prometheus.GaugeVec
+	series *seriesLimit
+}
+
+// WithLabelValues returns the gauge for the given label values. It returns
+// ErrTooManySeries if the label values are new and the vector is full.
+func (v *GaugeVec) WithLabelValues(values ...string) (prometheus.Gauge, error) {
+	if err := v.series.admit(values); err != nil {
+		return nil, err
+	}
+
+	return v.vec.WithLabelValues(values...), nil
+}
+
+// Delete removes the gauge for the given label values, freeing its place.
+func (v *GaugeVec) Delete(values ...string) {
+	v.vec.DeleteLabelValues(values...)
+	v.series.remove(values)
+}
+
+// CounterVec is a labeled counter with a bounded number of label sets.
+type CounterVec struct {
+	vec    *prometheus.CounterVec
+	series *seriesLimit
+}
+
+// WithLabelValues returns the counter for the given label values. It returns
+// ErrTooManySeries if the label values are new and the vector is full.
+func (v *CounterVec) WithLabelValues(values ...string) (prometheus.Counter, error) {
+	if err := v.series.admit(values); err != nil {
+		return nil, err
+	}
+
+	return v.vec.WithLabelValues(values...), nil
+}
+
+// Delete removes the counter for the given label values, freeing its place.
+func (v *CounterVec) Delete(values ...string) {
+	v.vec.DeleteLabelValues(values...)
+	v.series.remove(values)
+}
+
+// HistogramVec is a labeled histogram with a bounded number of label sets.
+type HistogramVec struct {
+	vec    *prometheus.HistogramVec
+	series *seriesLimit
+}
+
+// WithLabelValues returns the histogram for the given label values. It
+// returns ErrTooManySeries if the label values are new and the vector is
+// full.
+func (v *HistogramVec) WithLabelValues(values ...string) (prometheus.Observer, error) {
+	if err := v.series.admit(values); err != nil {
+		return nil, err
+	}
+
+	return v.vec.WithLabelValues(values...), nil
+}
+
+// Delete removes the histogram for the given label values, freeing its
+// place.
+func (v *HistogramVec) Delete(values ...string) {
+	v.vec.DeleteLabelValues(values...)
+	v.series.remove(values)
+}
+
+// seriesLimit tracks the label sets of a vector and bounds their number.
+type seriesLimit struct {
+	max int
+
+	mu     sync.Mutex
+	series map[string]bool
+}
+
+func newSeriesLimit(max int) *seriesLimit {
+	return &seriesLimit{
+		max:    max,
+		series: make(map[string]bool),
+	}
+}
+
+func (l *seriesLimit) admit(values []string) error {
+	key := strings.Join(values, "\xff")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.series[key] {
+		return nil
+	}
+	if l.max > 0 && len(l.series) >= l.max {
+		return ErrTooManySeries
+	}
+	l.series[key] = true
+
+	return nil
+}
+
+func (l *seriesLimit) remove(values []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.series, strings.Join(values, "\xff"))
+}
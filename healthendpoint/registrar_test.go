@@ -62,8 +62,151 @@ var _ = Describe("Health", func() {
 			Expect(gaugeCount2.dec).To(Equal(1))
 		})
 	})
+
+	Describe("unknown names", func() {
+		It("does not panic", func() {
+			Expect(func() {
+				h.Set("unknown", 1)
+				h.Inc("unknown")
+				h.Dec("unknown")
+			}).ToNot(Panic())
+		})
+
+		It("returns an error when looking up the gauge", func() {
+			_, err := h.Gauge("unknown")
+			Expect(err).To(Equal(healthendpoint.ErrUnknownMetric))
+
+			g, err := h.Gauge("count-1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(g).To(Equal(gaugeCount1))
+		})
+	})
 })
 
+var _ = Describe("Registering metrics at runtime", func() {
+	var (
+		registry *prometheus.Registry
+		h        *healthendpoint.Registrar
+	)
+
+	BeforeEach(func() {
+		registry = prometheus.NewRegistry()
+		h = healthendpoint.New(registry, map[string]prometheus.Gauge{})
+	})
+
+	It("registers gauges that can be set by name", func() {
+		g, err := h.RegisterGauge(prometheus.GaugeOpts{
+			Name: "shardCount",
+			Help: "Number of shards",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		g.Set(3)
+		h.Inc("shardCount")
+
+		Expect(gather(registry, "shardCount")).To(Equal(4.0))
+	})
+
+	It("registers counters and histograms", func() {
+		c, err := h.RegisterCounter(prometheus.CounterOpts{
+			Name: "reconnects",
+			Help: "Number of reconnects",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		c.Add(2)
+
+		hist, err := h.RegisterHistogram(prometheus.HistogramOpts{
+			Name: "latency",
+			Help: "Latency",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		hist.Observe(1)
+
+		Expect(gather(registry, "reconnects")).To(Equal(2.0))
+		Expect(gather(registry, "latency")).To(Equal(1.0))
+	})
+
+	It("returns an error when registering a duplicate", func() {
+		_, err := h.RegisterCounter(prometheus.CounterOpts{Name: "dup", Help: "dup"})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = h.RegisterCounter(prometheus.CounterOpts{Name: "dup", Help: "dup"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("bounds the number of label sets of a vector", func() {
+		v, err := h.RegisterGaugeVec(
+			prometheus.GaugeOpts{Name: "routerState", Help: "State"},
+			[]string{"addr"},
+			2,
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = v.WithLabelValues("a")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = v.WithLabelValues("b")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = v.WithLabelValues("a")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = v.WithLabelValues("c")
+		Expect(err).To(Equal(healthendpoint.ErrTooManySeries))
+
+		v.Delete("a")
+		_, err = v.WithLabelValues("c")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("bounds counter and histogram vectors", func() {
+		cv, err := h.RegisterCounterVec(
+			prometheus.CounterOpts{Name: "drops", Help: "Drops"},
+			[]string{"shard"},
+			1,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cv.WithLabelValues("1")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cv.WithLabelValues("2")
+		Expect(err).To(Equal(healthendpoint.ErrTooManySeries))
+
+		hv, err := h.RegisterHistogramVec(
+			prometheus.HistogramOpts{Name: "sizes", Help: "Sizes"},
+			[]string{"shard"},
+			1,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = hv.WithLabelValues("1")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = hv.WithLabelValues("2")
+		Expect(err).To(Equal(healthendpoint.ErrTooManySeries))
+	})
+})
+
+// gather returns the value of the single metric with the given name. For
+// histograms it is the sample sum.
+func gather(registry *prometheus.Registry, name string) float64 {
+	families, err := registry.Gather()
+	Expect(err).ToNot(HaveOccurred())
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		m := f.GetMetric()[0]
+		switch {
+		case m.Gauge != nil:
+			return m.GetGauge().GetValue()
+		case m.Counter != nil:
+			return m.GetCounter().GetValue()
+		case m.Histogram != nil:
+			return m.GetHistogram().GetSampleSum()
+		}
+	}
+
+	Fail("metric not found: " + name)
+	return 0
+}
+
 type spyRegistrar struct {
 	prometheus.Registerer
 	collectors []prometheus.Collector
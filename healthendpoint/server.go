@@ -10,12 +10,50 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// ServerOption is used to configure the health endpoint server.
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	checks   *Checks
+	handlers map[string]http.Handler
+}
+
+// WithChecks specifies the checks served as JSON on /live and /ready. By
+// default no checks are registered and both report ok.
+func WithChecks(c *Checks) ServerOption {
+	return func(sc *serverConfig) {
+		sc.checks = c
+	}
+}
+
+// WithHandler serves the given handler on the given path in addition to the
+// metrics and checks.
+func WithHandler(path string, h http.Handler) ServerOption {
+	return func(sc *serverConfig) {
+		sc.handlers[path] = h
+	}
+}
+
 // StartServer listens and serves the health endpoint HTTP handler on a given
-// address. If the server fails to listen or serve the process will exit with
-// a status code of 1.
-func StartServer(addr string, gatherer prometheus.Gatherer) net.Listener {
+// address. Besides the prometheus metrics on /health it serves the liveness
+// and readiness checks on /live and /ready. If the server fails to listen or
+// serve the process will exit with a status code of 1.
+func StartServer(addr string, gatherer prometheus.Gatherer, opts ...ServerOption) net.Listener {
+	sc := &serverConfig{
+		checks:   NewChecks(),
+		handlers: make(map[string]http.Handler),
+	}
+	for _, o := range opts {
+		o(sc)
+	}
+
 	router := http.NewServeMux()
 	router.Handle("/health", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	router.Handle("/live", sc.checks.LiveHandler())
+	router.Handle("/ready", sc.checks.ReadyHandler())
+	for path, h := range sc.handlers {
+		router.Handle(path, h)
+	}
 
 	server := http.Server{
 		Addr:         addr,
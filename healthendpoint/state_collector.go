@@ -0,0 +1,50 @@
+package healthendpoint
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StateCollector is a prometheus.Collector that reports the current state of
+// a set of named resources. Each resource is reported as a gauge with a value
+// of 1, labeled with the resource name and its state.
+type StateCollector struct {
+	desc   *prometheus.Desc
+	states func() map[string]string
+}
+
+// NewStateCollector returns a StateCollector that reads the current states
+// from the given function each time it is collected. The resource name is
+// reported with the given label.
+func NewStateCollector(
+	opts prometheus.GaugeOpts,
+	label string,
+	states func() map[string]string,
+) *StateCollector {
+	return &StateCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			[]string{label, "state"},
+			nil,
+		),
+		states: states,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, state := range c.states() {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc,
+			prometheus.GaugeValue,
+			1,
+			name,
+			state,
+		)
+	}
+}
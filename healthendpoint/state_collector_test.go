@@ -0,0 +1,57 @@
+package healthendpoint_test
+
+import (
+	"code.cloudfoundry.org/loggregator/healthendpoint"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StateCollector", func() {
+	It("reports each resource labeled with its state", func() {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(healthendpoint.NewStateCollector(
+			prometheus.GaugeOpts{
+				Namespace: "loggregator",
+				Subsystem: "test",
+				Name:      "routerState",
+				Help:      "State of each router",
+			},
+			"addr",
+			func() map[string]string {
+				return map[string]string{
+					"10.0.0.1:8082": "connected",
+					"10.0.0.2:8082": "open",
+				}
+			},
+		))
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		Expect(families[0].GetName()).To(Equal("loggregator_test_routerState"))
+
+		labels := make(map[string]string)
+		for _, m := range families[0].GetMetric() {
+			Expect(m.GetGauge().GetValue()).To(Equal(1.0))
+
+			var addr, state string
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "addr":
+					addr = l.GetValue()
+				case "state":
+					state = l.GetValue()
+				}
+			}
+			labels[addr] = state
+		}
+
+		Expect(labels).To(Equal(map[string]string{
+			"10.0.0.1:8082": "connected",
+			"10.0.0.2:8082": "open",
+		}))
+	})
+})
@@ -0,0 +1,49 @@
+package healthendpoint
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ValueCollector is a prometheus.Collector that reports a value for each of
+// a set of named resources. Each resource is reported as a gauge labeled
+// with the resource name.
+type ValueCollector struct {
+	desc   *prometheus.Desc
+	values func() map[string]float64
+}
+
+// NewValueCollector returns a ValueCollector that reads the current values
+// from the given function each time it is collected. The resource name is
+// reported with the given label alongside any constant labels of opts.
+func NewValueCollector(
+	opts prometheus.GaugeOpts,
+	label string,
+	values func() map[string]float64,
+) *ValueCollector {
+	return &ValueCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			[]string{label},
+			opts.ConstLabels,
+		),
+		values: values,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ValueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ValueCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, value := range c.values() {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc,
+			prometheus.GaugeValue,
+			value,
+			name,
+		)
+	}
+}
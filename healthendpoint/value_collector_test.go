@@ -0,0 +1,74 @@
+package healthendpoint_test
+
+import (
+	"code.cloudfoundry.org/loggregator/healthendpoint"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValueCollector", func() {
+	It("reports each resource with its value", func() {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(healthendpoint.NewValueCollector(
+			prometheus.GaugeOpts{
+				Namespace: "loggregator",
+				Subsystem: "test",
+				Name:      "certExpiry",
+				Help:      "Expiry of each certificate",
+			},
+			"cert",
+			func() map[string]float64 {
+				return map[string]float64{
+					"/some/cert.crt": 1234,
+				}
+			},
+		))
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		Expect(families[0].GetName()).To(Equal("loggregator_test_certExpiry"))
+
+		metrics := families[0].GetMetric()
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(1234.0))
+		Expect(metrics[0].GetLabel()).To(HaveLen(1))
+		Expect(metrics[0].GetLabel()[0].GetName()).To(Equal("cert"))
+		Expect(metrics[0].GetLabel()[0].GetValue()).To(Equal("/some/cert.crt"))
+	})
+
+	It("reports the constant labels", func() {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(healthendpoint.NewValueCollector(
+			prometheus.GaugeOpts{
+				Namespace:   "loggregator",
+				Subsystem:   "test",
+				Name:        "lag",
+				Help:        "Lag of each shard",
+				ConstLabels: prometheus.Labels{"quantile": "0.5"},
+			},
+			"shard_id",
+			func() map[string]float64 {
+				return map[string]float64{
+					"some-shard": 12,
+				}
+			},
+		))
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+
+		labels := make(map[string]string)
+		for _, l := range families[0].GetMetric()[0].GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		Expect(labels).To(Equal(map[string]string{
+			"quantile": "0.5",
+			"shard_id": "some-shard",
+		}))
+	})
+})
@@ -0,0 +1,73 @@
+package batching
+
+import (
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/golang/protobuf/proto"
+)
+
+// splitOverhead allows for the length prefixes of the payload and of the log
+// growing as the payload is added back to an envelope.
+const splitOverhead = 16
+
+// batchedSize returns the number of bytes an envelope adds to an encoded
+// EnvelopeBatch, including its field tag and length prefix.
+func batchedSize(e *loggregator_v2.Envelope) int {
+	n := proto.Size(e)
+	return 1 + proto.SizeVarint(uint64(n)) + n
+}
+
+// splitEnvelope splits a log envelope into several envelopes that each fit
+// in maxBytes. Each envelope keeps the metadata of the original and carries
+// a part of the payload. Payloads are split on UTF-8 boundaries where
+// possible. Envelopes that are not logs, or whose metadata alone does not fit
+// in maxBytes, are returned as is.
+func splitEnvelope(e *loggregator_v2.Envelope, maxBytes int) []*loggregator_v2.Envelope {
+	l := e.GetLog()
+	if l == nil {
+		return []*loggregator_v2.Envelope{e}
+	}
+
+	chunk := maxBytes - batchedSize(withPayload(e, nil)) - splitOverhead
+	if chunk <= 0 {
+		return []*loggregator_v2.Envelope{e}
+	}
+
+	var envs []*loggregator_v2.Envelope
+	payload := l.GetPayload()
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > chunk {
+			n = chunk
+			for n > 0 && !utf8.RuneStart(payload[n]) {
+				n--
+			}
+			if n == 0 {
+				n = chunk
+			}
+		}
+
+		envs = append(envs, withPayload(e, payload[:n]))
+		payload = payload[n:]
+	}
+
+	return envs
+}
+
+// withPayload returns a copy of the log envelope with the given payload.
+func withPayload(e *loggregator_v2.Envelope, payload []byte) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		Timestamp:      e.GetTimestamp(),
+		SourceId:       e.GetSourceId(),
+		InstanceId:     e.GetInstanceId(),
+		DeprecatedTags: e.GetDeprecatedTags(),
+		Tags:           e.GetTags(),
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: payload,
+				Type:    e.GetLog().GetType(),
+			},
+		},
+	}
+}
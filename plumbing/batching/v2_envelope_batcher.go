@@ -10,6 +10,23 @@ import (
 // V2EnvelopeBatcher batches slices of bytes.
 type V2EnvelopeBatcher struct {
 	*batching.Batcher
+
+	maxBytes     int
+	pendingBytes int
+}
+
+// V2EnvelopeBatcherOption configures a V2EnvelopeBatcher.
+type V2EnvelopeBatcherOption func(*V2EnvelopeBatcher)
+
+// WithMaxBatchBytes limits the encoded size of each batch. A batch is
+// flushed before an envelope that would take it over the limit is added. Log
+// envelopes that are larger than the limit on their own are split into
+// several envelopes. Other envelopes that are larger than the limit are sent
+// in a batch of their own. A limit of zero or less disables the check.
+func WithMaxBatchBytes(n int) V2EnvelopeBatcherOption {
+	return func(b *V2EnvelopeBatcher) {
+		b.maxBytes = n
+	}
 }
 
 // V2EnvelopeWriter is used to submit the completed batch of v2 envelopes. The
@@ -29,17 +46,29 @@ func (f V2EnvelopeWriterFunc) Write(batch []*loggregator_v2.Envelope) {
 }
 
 // NewV2EnvelopeBatcher creates a new ByteBatcher.
-func NewV2EnvelopeBatcher(size int, interval time.Duration, writer V2EnvelopeWriter) *V2EnvelopeBatcher {
+func NewV2EnvelopeBatcher(
+	size int,
+	interval time.Duration,
+	writer V2EnvelopeWriter,
+	opts ...V2EnvelopeBatcherOption,
+) *V2EnvelopeBatcher {
+	b := &V2EnvelopeBatcher{}
+	for _, o := range opts {
+		o(b)
+	}
+
 	genWriter := batching.WriterFunc(func(batch []interface{}) {
+		b.pendingBytes = 0
+
 		envBatch := make([]*loggregator_v2.Envelope, 0, len(batch))
 		for _, element := range batch {
 			envBatch = append(envBatch, element.(*loggregator_v2.Envelope))
 		}
 		writer.Write(envBatch)
 	})
-	return &V2EnvelopeBatcher{
-		Batcher: batching.NewBatcher(size, interval, genWriter),
-	}
+	b.Batcher = batching.NewBatcher(size, interval, genWriter)
+
+	return b
 }
 
 // Write stores data to the batch. It will not submit the batch to the writer
@@ -47,5 +76,27 @@ func NewV2EnvelopeBatcher(size int, interval time.Duration, writer V2EnvelopeWri
 // Write is *not* thread safe and should be called by the same goroutine that
 // calls Flush.
 func (b *V2EnvelopeBatcher) Write(data *loggregator_v2.Envelope) {
+	if b.maxBytes <= 0 {
+		b.Batcher.Write(data)
+		return
+	}
+
+	size := batchedSize(data)
+	if size <= b.maxBytes {
+		b.writeSized(data, size)
+		return
+	}
+
+	for _, e := range splitEnvelope(data, b.maxBytes) {
+		b.writeSized(e, batchedSize(e))
+	}
+}
+
+func (b *V2EnvelopeBatcher) writeSized(data *loggregator_v2.Envelope, size int) {
+	if b.pendingBytes > 0 && b.pendingBytes+size > b.maxBytes {
+		b.Batcher.ForcedFlush()
+	}
+
+	b.pendingBytes += size
 	b.Batcher.Write(data)
 }
@@ -1,7 +1,11 @@
 package batching_test
 
 import (
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -22,14 +26,98 @@ var _ = Describe("V2EnvelopeBatcher", func() {
 		Expect(writer.batch).To(HaveLen(1))
 		Expect(writer.batch[0].GetSourceId()).To(Equal("test-source-id"))
 	})
+
+	Context("with a byte limit", func() {
+		It("flushes before the batch would exceed the limit", func() {
+			writer := &spyV2EnvelopeWriter{}
+			b := batching.NewV2EnvelopeBatcher(
+				100,
+				time.Minute,
+				writer,
+				batching.WithMaxBatchBytes(150),
+			)
+
+			b.Write(buildLog(strings.Repeat("a", 100)))
+			Expect(writer.called).To(Equal(0))
+
+			b.Write(buildLog(strings.Repeat("b", 100)))
+			Expect(writer.called).To(Equal(1))
+			Expect(writer.batch).To(HaveLen(1))
+			Expect(string(writer.batch[0].GetLog().GetPayload())).To(Equal(strings.Repeat("a", 100)))
+		})
+
+		It("splits log envelopes that exceed the limit on their own", func() {
+			writer := &spyV2EnvelopeWriter{}
+			b := batching.NewV2EnvelopeBatcher(
+				100,
+				time.Minute,
+				writer,
+				batching.WithMaxBatchBytes(150),
+			)
+
+			payload := strings.Repeat("ü", 200)
+			b.Write(buildLog(payload))
+			b.ForcedFlush()
+
+			Expect(writer.batches).ToNot(BeEmpty())
+
+			var joined string
+			for _, batch := range writer.batches {
+				var size int
+				for _, e := range batch {
+					Expect(e.GetSourceId()).To(Equal("test-source-id"))
+					Expect(e.GetTags()).To(Equal(map[string]string{"a": "b"}))
+					Expect(utf8.Valid(e.GetLog().GetPayload())).To(BeTrue())
+					joined += string(e.GetLog().GetPayload())
+					size += proto.Size(e)
+				}
+				Expect(size).To(BeNumerically("<=", 150))
+			}
+			Expect(joined).To(Equal(payload))
+		})
+
+		It("sends other envelopes that exceed the limit in a batch of their own", func() {
+			writer := &spyV2EnvelopeWriter{}
+			b := batching.NewV2EnvelopeBatcher(
+				100,
+				time.Minute,
+				writer,
+				batching.WithMaxBatchBytes(150),
+			)
+
+			b.Write(buildLog("small"))
+			b.Write(&loggregator_v2.Envelope{
+				SourceId: strings.Repeat("s", 200),
+			})
+			b.ForcedFlush()
+
+			Expect(writer.batches).To(HaveLen(2))
+			Expect(writer.batches[1]).To(HaveLen(1))
+			Expect(writer.batches[1][0].GetSourceId()).To(HaveLen(200))
+		})
+	})
 })
 
+func buildLog(payload string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: "test-source-id",
+		Tags:     map[string]string{"a": "b"},
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{
+				Payload: []byte(payload),
+			},
+		},
+	}
+}
+
 type spyV2EnvelopeWriter struct {
-	batch  []*loggregator_v2.Envelope
-	called int
+	batch   []*loggregator_v2.Envelope
+	batches [][]*loggregator_v2.Envelope
+	called  int
 }
 
 func (w *spyV2EnvelopeWriter) Write(batch []*loggregator_v2.Envelope) {
 	w.batch = batch
+	w.batches = append(w.batches, batch)
 	w.called++
 }
@@ -0,0 +1,57 @@
+package plumbing
+
+import (
+	"fmt"
+	"sync"
+)
+
+// consumerRegistry tracks the live consumers of a GRPCConnector. A max of 0
+// or less means the number of consumers is not capped.
+type consumerRegistry struct {
+	max int
+
+	mu        sync.RWMutex
+	consumers map[*consumerState]struct{}
+}
+
+func newConsumerRegistry(max int) *consumerRegistry {
+	return &consumerRegistry{
+		max:       max,
+		consumers: make(map[*consumerState]struct{}),
+	}
+}
+
+// add registers the consumer. It returns an error if the registry is at
+// capacity.
+func (r *consumerRegistry) add(cs *consumerState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.max > 0 && len(r.consumers) >= r.max {
+		return fmt.Errorf("at connection limit: %d", r.max)
+	}
+	r.consumers[cs] = struct{}{}
+
+	return nil
+}
+
+func (r *consumerRegistry) remove(cs *consumerState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.consumers, cs)
+}
+
+// snapshot returns the registered consumers. The registry is not locked
+// while the caller works with the result.
+func (r *consumerRegistry) snapshot() []*consumerState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	consumers := make([]*consumerState, 0, len(r.consumers))
+	for cs := range r.consumers {
+		consumers = append(consumers, cs)
+	}
+
+	return consumers
+}
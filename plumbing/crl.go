@@ -0,0 +1,173 @@
+package plumbing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var revokedPeers uint64
+
+// RevokedPeers returns the number of peer certificates that have been
+// rejected because they were revoked by a CRL.
+func RevokedPeers() uint64 {
+	return atomic.LoadUint64(&revokedPeers)
+}
+
+// WithCRLFiles is used to reject peer certificates that have been revoked by
+// one of the given CRL files. The files may be PEM or DER encoded. They are
+// reloaded when they change and a reload that fails keeps the last good
+// CRLs. Nothing is fetched over the network.
+func WithCRLFiles(files ...string) ConfigOption {
+	return func(c *tls.Config) error {
+		if len(files) == 0 {
+			return nil
+		}
+
+		crls, err := newCRLReloader(files)
+		if err != nil {
+			return err
+		}
+		c.VerifyPeerCertificate = crls.verifyPeerCertificate
+
+		return nil
+	}
+}
+
+// crlReloader holds the CRLs loaded from a set of files. Before checking a
+// peer it reloads the files if any of them has changed.
+type crlReloader struct {
+	files []string
+
+	mu    sync.Mutex
+	stamp string
+
+	current atomic.Value
+}
+
+func newCRLReloader(files []string) (*crlReloader, error) {
+	r := &crlReloader{
+		files: files,
+	}
+
+	r.stamp = r.fileStamp()
+	crls, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(crls)
+
+	return r, nil
+}
+
+func (r *crlReloader) crls() []*pkix.CertificateList {
+	return r.current.Load().([]*pkix.CertificateList)
+}
+
+func (r *crlReloader) maybeReload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp := r.fileStamp()
+	if stamp == r.stamp {
+		return
+	}
+	r.stamp = stamp
+
+	crls, err := r.load()
+	if err != nil {
+		log.Printf("failed to reload CRLs, keeping the previous ones: %s", err)
+		return
+	}
+
+	r.current.Store(crls)
+	log.Printf("reloaded %d CRLs", len(crls))
+}
+
+func (r *crlReloader) fileStamp() string {
+	var stamp string
+	for _, f := range r.files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			stamp += "-;"
+			continue
+		}
+		stamp += fmt.Sprintf("%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+
+	return stamp
+}
+
+func (r *crlReloader) load() ([]*pkix.CertificateList, error) {
+	var crls []*pkix.CertificateList
+	for _, f := range r.files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CRL file: %s", err)
+		}
+
+		crl, err := x509.ParseCRL(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL file %s: %s", f, err)
+		}
+
+		if crl.HasExpired(time.Now()) {
+			log.Printf("CRL file %s is past its next update time", f)
+		}
+
+		crls = append(crls, crl)
+	}
+
+	return crls, nil
+}
+
+// verifyPeerCertificate rejects the peer if any certificate in a verified
+// chain has been revoked by a CRL signed by its issuer.
+func (r *crlReloader) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	r.maybeReload()
+	crls := r.crls()
+
+	for _, chain := range verifiedChains {
+		for i := 0; i < len(chain)-1; i++ {
+			cert, issuer := chain[i], chain[i+1]
+			if !revoked(cert, issuer, crls) {
+				continue
+			}
+
+			atomic.AddUint64(&revokedPeers, 1)
+			log.Printf(
+				"security: rejected revoked peer certificate serial=%s subject=%q",
+				cert.SerialNumber,
+				cert.Subject.CommonName,
+			)
+
+			return errors.New("peer certificate has been revoked")
+		}
+	}
+
+	return nil
+}
+
+func revoked(cert, issuer *x509.Certificate, crls []*pkix.CertificateList) bool {
+	for _, crl := range crls {
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			if rc.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+				continue
+			}
+
+			if issuer.CheckCRLSignature(crl) == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package plumbing_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+	"code.cloudfoundry.org/loggregator/testservers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithCRLFiles", func() {
+	var (
+		ca      *x509.Certificate
+		caKey   crypto.Signer
+		doppler *x509.Certificate
+		metron  *x509.Certificate
+		crlFile string
+	)
+
+	BeforeEach(func() {
+		caPair := loadCert("loggregator-ca")
+		var err error
+		ca, err = x509.ParseCertificate(caPair.Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		caKey = caPair.PrivateKey.(crypto.Signer)
+
+		doppler, err = x509.ParseCertificate(loadCert("doppler").Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		metron, err = x509.ParseCertificate(loadCert("metron").Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+
+		crlFile = writeFile("")
+		writeCRL(crlFile, ca, caKey, doppler)
+	})
+
+	It("rejects peers whose certificate has been revoked", func() {
+		conf, err := plumbing.NewServerMutualTLSConfig(
+			testservers.Cert("doppler.crt"),
+			testservers.Cert("doppler.key"),
+			testservers.Cert("loggregator-ca.crt"),
+			plumbing.WithCRLFiles(crlFile),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		before := plumbing.RevokedPeers()
+		err = conf.VerifyPeerCertificate(nil, [][]*x509.Certificate{{doppler, ca}})
+		Expect(err).To(MatchError("peer certificate has been revoked"))
+		Expect(plumbing.RevokedPeers()).To(Equal(before + 1))
+	})
+
+	It("accepts peers whose certificate has not been revoked", func() {
+		conf, err := plumbing.NewClientMutualTLSConfig(
+			testservers.Cert("doppler.crt"),
+			testservers.Cert("doppler.key"),
+			testservers.Cert("loggregator-ca.crt"),
+			"metron",
+			plumbing.WithCRLFiles(crlFile),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = conf.VerifyPeerCertificate(nil, [][]*x509.Certificate{{metron, ca}})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reloads the CRL when the file changes", func() {
+		conf, err := plumbing.NewServerMutualTLSConfig(
+			testservers.Cert("doppler.crt"),
+			testservers.Cert("doppler.key"),
+			testservers.Cert("loggregator-ca.crt"),
+			plumbing.WithCRLFiles(crlFile),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		writeCRL(crlFile, ca, caKey, doppler, metron)
+
+		err = conf.VerifyPeerCertificate(nil, [][]*x509.Certificate{{metron, ca}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keeps the last good CRL when the file is invalid", func() {
+		conf, err := plumbing.NewServerMutualTLSConfig(
+			testservers.Cert("doppler.crt"),
+			testservers.Cert("doppler.key"),
+			testservers.Cert("loggregator-ca.crt"),
+			plumbing.WithCRLFiles(crlFile),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(ioutil.WriteFile(crlFile, []byte("invalid"), 0600)).To(Succeed())
+
+		err = conf.VerifyPeerCertificate(nil, [][]*x509.Certificate{{doppler, ca}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("ignores CRLs that are not signed by the issuer", func() {
+		other := &x509.Certificate{
+			Subject: pkix.Name{CommonName: "other"},
+		}
+		conf := &tls.Config{}
+		Expect(plumbing.WithCRLFiles(crlFile)(conf)).To(Succeed())
+
+		err := conf.VerifyPeerCertificate(nil, [][]*x509.Certificate{{doppler, other}})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("returns an error when a CRL file can not be parsed", func() {
+		_, err := plumbing.NewServerMutualTLSConfig(
+			testservers.Cert("doppler.crt"),
+			testservers.Cert("doppler.key"),
+			testservers.Cert("loggregator-ca.crt"),
+			plumbing.WithCRLFiles(writeFile("invalid")),
+		)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func writeCRL(path string, ca *x509.Certificate, key crypto.Signer, revoked ...*x509.Certificate) {
+	var revokedCerts []pkix.RevokedCertificate
+	for _, c := range revoked {
+		revokedCerts = append(revokedCerts, pkix.RevokedCertificate{
+			SerialNumber:   c.SerialNumber,
+			RevocationTime: time.Now(),
+		})
+	}
+
+	crl, err := ca.CreateCRL(rand.Reader, key, revokedCerts, time.Now(), time.Now().Add(time.Hour))
+	Expect(err).ToNot(HaveOccurred())
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+	Expect(ioutil.WriteFile(path, data, 0600)).To(Succeed())
+}
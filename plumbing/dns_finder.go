@@ -0,0 +1,275 @@
+package plumbing
+
+import (
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultDNSRefreshInterval = 10 * time.Second
+	defaultDNSJitter          = 2 * time.Second
+	dnsLookupTimeout          = 5 * time.Second
+)
+
+// DNSResolver looks up the addresses for a host. It is satisfied by
+// *net.Resolver.
+type DNSResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSFinder periodically resolves a hostname and yields an Event each time
+// the set of resolved addresses changes. When resolution fails or yields no
+// addresses the last good set is kept.
+type DNSFinder struct {
+	host     string
+	port     string
+	interval time.Duration
+	jitter   time.Duration
+	resolver DNSResolver
+
+	event chan Event
+	done  chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+	current []string
+
+	// sendMu orders sends on event so that no addresses follow the final
+	// Event yielded by Stop.
+	sendMu sync.Mutex
+}
+
+// DNSFinderOption is used to configure a new DNSFinder.
+type DNSFinderOption func(*DNSFinder)
+
+// WithDNSRefreshInterval sets how often the hostname is resolved. It
+// defaults to 10 seconds.
+func WithDNSRefreshInterval(d time.Duration) DNSFinderOption {
+	return func(f *DNSFinder) {
+		f.interval = d
+	}
+}
+
+// WithDNSJitter sets the maximum random duration added to each refresh
+// interval. It defaults to 2 seconds.
+func WithDNSJitter(d time.Duration) DNSFinderOption {
+	return func(f *DNSFinder) {
+		f.jitter = d
+	}
+}
+
+// WithDNSResolver overrides the resolver used for lookups. It defaults to
+// net.DefaultResolver.
+func WithDNSResolver(r DNSResolver) DNSFinderOption {
+	return func(f *DNSFinder) {
+		f.resolver = r
+	}
+}
+
+// NewDNSFinder creates a new DNSFinder for the given address. If the address
+// has the form host:port, A and AAAA records of the host are resolved and
+// joined with the port. If the address has no port, SRV records for the
+// host are resolved and their targets and ports are used.
+func NewDNSFinder(addr string, opts ...DNSFinderOption) *DNSFinder {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+
+	f := &DNSFinder{
+		host:     host,
+		port:     port,
+		interval: defaultDNSRefreshInterval,
+		jitter:   defaultDNSJitter,
+		resolver: net.DefaultResolver,
+		event:    make(chan Event, 10),
+		done:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(f)
+	}
+
+	return f
+}
+
+// Start begins resolving the hostname. The first lookup happens
+// immediately.
+func (f *DNSFinder) Start() {
+	go f.run()
+}
+
+// Stop stops resolving the hostname and yields an Event with no addresses.
+// Stop does not block: if events are not being read, the oldest pending
+// event is dropped to make room.
+func (f *DNSFinder) Stop() {
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return
+	}
+	f.stopped = true
+	close(f.done)
+	f.mu.Unlock()
+
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	e := Event{
+		GRPCDopplers: []string{},
+	}
+	for {
+		select {
+		case f.event <- e:
+			return
+		default:
+		}
+
+		select {
+		case <-f.event:
+		default:
+		}
+	}
+}
+
+// Next blocks until the set of resolved addresses changes.
+func (f *DNSFinder) Next() Event {
+	return <-f.event
+}
+
+func (f *DNSFinder) run() {
+	for {
+		f.refresh()
+
+		t := time.NewTimer(f.nextInterval())
+		select {
+		case <-f.done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (f *DNSFinder) nextInterval() time.Duration {
+	if f.jitter <= 0 {
+		return f.interval
+	}
+
+	return f.interval + time.Duration(rand.Int63n(int64(f.jitter)))
+}
+
+func (f *DNSFinder) refresh() {
+	addrs, err := f.lookup()
+	if err != nil {
+		log.Printf("failed to resolve router addresses for %s: %s", f.host, err)
+		return
+	}
+
+	if len(addrs) == 0 {
+		log.Printf("no router addresses found for %s, keeping last known set", f.host)
+		return
+	}
+
+	f.mu.Lock()
+	if f.stopped || equalAddrs(f.current, addrs) {
+		f.mu.Unlock()
+		return
+	}
+	f.current = addrs
+	f.mu.Unlock()
+
+	f.send(Event{
+		GRPCDopplers: addrs,
+	})
+}
+
+// send yields the event unless the finder has been stopped. It gives up
+// waiting for a reader once Stop is called.
+func (f *DNSFinder) send(e Event) {
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+
+	select {
+	case f.event <- e:
+	case <-f.done:
+	}
+}
+
+func (f *DNSFinder) lookup() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	if f.port == "" {
+		return f.lookupSRV(ctx)
+	}
+
+	hosts, err := f.resolver.LookupHost(ctx, f.host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		addrs = append(addrs, net.JoinHostPort(h, f.port))
+	}
+
+	return uniqueSorted(addrs), nil
+}
+
+func (f *DNSFinder) lookupSRV(ctx context.Context) ([]string, error) {
+	_, srvs, err := f.resolver.LookupSRV(ctx, "", "", f.host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(srvs))
+	for _, s := range srvs {
+		target := strings.TrimSuffix(s.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(target, strconv.Itoa(int(s.Port))))
+	}
+
+	return uniqueSorted(addrs), nil
+}
+
+func uniqueSorted(addrs []string) []string {
+	sort.Strings(addrs)
+
+	unique := make([]string, 0, len(addrs))
+	for i, a := range addrs {
+		if i > 0 && addrs[i-1] == a {
+			continue
+		}
+		unique = append(unique, a)
+	}
+
+	return unique
+}
+
+func equalAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
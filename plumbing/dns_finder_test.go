@@ -0,0 +1,218 @@
+package plumbing_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNSFinder", func() {
+	var (
+		resolver *spyDNSResolver
+		finder   *plumbing.DNSFinder
+	)
+
+	BeforeEach(func() {
+		resolver = newSpyDNSResolver()
+	})
+
+	AfterEach(func() {
+		finder.Stop()
+	})
+
+	It("yields the resolved addresses joined with the port", func() {
+		resolver.setHosts([]string{"10.0.0.2", "10.0.0.1"}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler.service.cf.internal:8082",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(10*time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{
+			"10.0.0.1:8082",
+			"10.0.0.2:8082",
+		}))
+		Expect(resolver.lookupHostName()).To(Equal("doppler.service.cf.internal"))
+	})
+
+	It("uses SRV records when no port is given", func() {
+		resolver.setSRVs([]*net.SRV{
+			{Target: "router-1.service.cf.internal.", Port: 8082},
+			{Target: "router-0.service.cf.internal.", Port: 8083},
+		}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler.service.cf.internal",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(10*time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{
+			"router-0.service.cf.internal:8083",
+			"router-1.service.cf.internal:8082",
+		}))
+	})
+
+	It("yields a new event when the set changes", func() {
+		resolver.setHosts([]string{"10.0.0.1"}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler:8082",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(10*time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{"10.0.0.1:8082"}))
+
+		resolver.setHosts([]string{"10.0.0.1", "10.0.0.2"}, nil)
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{
+			"10.0.0.1:8082",
+			"10.0.0.2:8082",
+		}))
+	})
+
+	It("does not yield an event when the set is unchanged", func() {
+		resolver.setHosts([]string{"10.0.0.1"}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler:8082",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(10*time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+		finder.Next()
+
+		events := make(chan plumbing.Event, 10)
+		go func() {
+			events <- finder.Next()
+		}()
+
+		Consistently(events).ShouldNot(Receive())
+	})
+
+	It("keeps the last good set when resolution fails", func() {
+		resolver.setHosts([]string{"10.0.0.1"}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler:8082",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(10*time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+		finder.Next()
+
+		resolver.setHosts(nil, errors.New("some-error"))
+
+		events := make(chan plumbing.Event, 10)
+		go func() {
+			events <- finder.Next()
+		}()
+		Consistently(events).ShouldNot(Receive())
+
+		resolver.setHosts([]string{}, nil)
+		Consistently(events).ShouldNot(Receive())
+	})
+
+	It("yields no dopplers after stopping", func() {
+		resolver.setHosts([]string{"10.0.0.1"}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler:8082",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(10*time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+		finder.Next()
+		finder.Stop()
+
+		Expect(finder.Next().GRPCDopplers).To(HaveLen(0))
+	})
+
+	It("stops while events are not being read", func() {
+		resolver.setHosts([]string{"10.0.0.0"}, nil)
+		finder = plumbing.NewDNSFinder(
+			"doppler:8082",
+			plumbing.WithDNSResolver(resolver),
+			plumbing.WithDNSRefreshInterval(time.Millisecond),
+			plumbing.WithDNSJitter(0),
+		)
+		finder.Start()
+		for i := 1; i <= 20; i++ {
+			resolver.setHosts([]string{fmt.Sprintf("10.0.0.%d", i)}, nil)
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			finder.Stop()
+		}()
+		Eventually(stopped).Should(BeClosed())
+
+		var last plumbing.Event
+		for i := 0; i < 10; i++ {
+			last = finder.Next()
+			if len(last.GRPCDopplers) == 0 {
+				break
+			}
+		}
+		Expect(last.GRPCDopplers).To(HaveLen(0))
+	})
+})
+
+type spyDNSResolver struct {
+	mu       sync.Mutex
+	hosts    []string
+	srvs     []*net.SRV
+	err      error
+	hostName string
+}
+
+func newSpyDNSResolver() *spyDNSResolver {
+	return &spyDNSResolver{}
+}
+
+func (s *spyDNSResolver) setHosts(hosts []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts = hosts
+	s.err = err
+}
+
+func (s *spyDNSResolver) setSRVs(srvs []*net.SRV, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srvs = srvs
+	s.err = err
+}
+
+func (s *spyDNSResolver) lookupHostName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hostName
+}
+
+func (s *spyDNSResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hostName = host
+	return append([]string(nil), s.hosts...), s.err
+}
+
+func (s *spyDNSResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return "", s.srvs, s.err
+}
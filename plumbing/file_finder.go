@@ -0,0 +1,285 @@
+package plumbing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFilePollInterval = time.Second
+	defaultFileDebounce     = 2 * time.Second
+)
+
+// FileFinder reads router addresses from a file and yields an Event each
+// time the set of addresses in the file changes. The file may either be a
+// JSON array of strings or contain one address per line. Blank lines and
+// lines starting with # are ignored. Every address must be of the form
+// host:port.
+//
+// If the file can not be read or contains an invalid entry, the last good
+// set is kept.
+type FileFinder struct {
+	path         string
+	pollInterval time.Duration
+	debounce     time.Duration
+
+	event chan Event
+	done  chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+	loaded  bool
+	current []string
+
+	// sendMu orders sends on event so that no addresses follow the final
+	// Event yielded by Stop.
+	sendMu sync.Mutex
+}
+
+// FileFinderOption is used to configure a new FileFinder.
+type FileFinderOption func(*FileFinder)
+
+// WithFilePollInterval sets how often the file is checked for changes. It
+// defaults to 1 second.
+func WithFilePollInterval(d time.Duration) FileFinderOption {
+	return func(f *FileFinder) {
+		f.pollInterval = d
+	}
+}
+
+// WithFileDebounce sets how long the file must remain unchanged before a
+// change is read. It defaults to 2 seconds.
+func WithFileDebounce(d time.Duration) FileFinderOption {
+	return func(f *FileFinder) {
+		f.debounce = d
+	}
+}
+
+// NewFileFinder creates a new FileFinder for the file at the given path.
+func NewFileFinder(path string, opts ...FileFinderOption) *FileFinder {
+	f := &FileFinder{
+		path:         path,
+		pollInterval: defaultFilePollInterval,
+		debounce:     defaultFileDebounce,
+		event:        make(chan Event, 10),
+		done:         make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(f)
+	}
+
+	return f
+}
+
+// Start begins watching the file. The file is read immediately.
+func (f *FileFinder) Start() {
+	go f.run()
+}
+
+// Stop stops watching the file and yields an Event with no addresses.
+// Stop does not block: if events are not being read, the oldest pending
+// event is dropped to make room.
+func (f *FileFinder) Stop() {
+	f.mu.Lock()
+	if f.stopped {
+		f.mu.Unlock()
+		return
+	}
+	f.stopped = true
+	close(f.done)
+	f.mu.Unlock()
+
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	e := Event{
+		GRPCDopplers: []string{},
+	}
+	for {
+		select {
+		case f.event <- e:
+			return
+		default:
+		}
+
+		select {
+		case <-f.event:
+		default:
+		}
+	}
+}
+
+// Next blocks until the set of addresses in the file changes.
+func (f *FileFinder) Next() Event {
+	return <-f.event
+}
+
+// Addrs returns the current set of addresses.
+func (f *FileFinder) Addrs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.current...)
+}
+
+func (f *FileFinder) run() {
+	last, _ := f.stat()
+	f.reload()
+
+	var pendingSince time.Time
+	t := time.NewTicker(f.pollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-t.C:
+		}
+
+		current, err := f.stat()
+		if err != nil {
+			log.Printf("failed to stat router address file %s: %s", f.path, err)
+			continue
+		}
+
+		if current != last {
+			last = current
+			pendingSince = time.Now()
+			continue
+		}
+
+		if !pendingSince.IsZero() && time.Since(pendingSince) >= f.debounce {
+			pendingSince = time.Time{}
+			f.reload()
+		}
+	}
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func (f *FileFinder) stat() (fileVersion, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+
+	return fileVersion{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
+
+func (f *FileFinder) reload() {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		log.Printf("failed to read router address file %s: %s", f.path, err)
+		return
+	}
+
+	addrs, err := parseAddrFile(data)
+	if err != nil {
+		log.Printf("invalid router address file %s, keeping last known set: %s", f.path, err)
+		return
+	}
+
+	f.mu.Lock()
+	if f.stopped || (f.loaded && equalAddrs(f.current, addrs)) {
+		f.mu.Unlock()
+		return
+	}
+	f.loaded = true
+	f.current = addrs
+	f.mu.Unlock()
+
+	f.send(Event{
+		GRPCDopplers: addrs,
+	})
+}
+
+// send yields the event unless the finder has been stopped. It gives up
+// waiting for a reader once Stop is called.
+func (f *FileFinder) send(e Event) {
+	f.sendMu.Lock()
+	defer f.sendMu.Unlock()
+
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+
+	select {
+	case f.event <- e:
+	case <-f.done:
+	}
+}
+
+func parseAddrFile(data []byte) ([]string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	var entries []string
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if err := validateAddr(e); err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, e)
+	}
+
+	return uniqueSorted(addrs), nil
+}
+
+func validateAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %s", addr, err)
+	}
+
+	if host == "" {
+		return fmt.Errorf("invalid address %q: missing host", addr)
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid address %q: invalid port", addr)
+	}
+
+	return nil
+}
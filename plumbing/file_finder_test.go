@@ -0,0 +1,151 @@
+package plumbing_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileFinder", func() {
+	var (
+		dir    string
+		path   string
+		finder *plumbing.FileFinder
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "file-finder")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "routers")
+	})
+
+	AfterEach(func() {
+		finder.Stop()
+		os.RemoveAll(dir)
+	})
+
+	startFinder := func() {
+		finder = plumbing.NewFileFinder(
+			path,
+			plumbing.WithFilePollInterval(10*time.Millisecond),
+			plumbing.WithFileDebounce(50*time.Millisecond),
+		)
+		finder.Start()
+	}
+
+	writeFile := func(content string) {
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	It("reads newline delimited addresses", func() {
+		writeFile("10.0.0.2:8082\n# comment\n\n10.0.0.1:8082\n")
+		startFinder()
+
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{
+			"10.0.0.1:8082",
+			"10.0.0.2:8082",
+		}))
+		Expect(finder.Addrs()).To(Equal([]string{
+			"10.0.0.1:8082",
+			"10.0.0.2:8082",
+		}))
+	})
+
+	It("reads a JSON array of addresses", func() {
+		writeFile(`["10.0.0.1:8082", "10.0.0.2:8082"]`)
+		startFinder()
+
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{
+			"10.0.0.1:8082",
+			"10.0.0.2:8082",
+		}))
+	})
+
+	It("yields a new event when the file changes", func() {
+		writeFile("10.0.0.1:8082")
+		startFinder()
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{"10.0.0.1:8082"}))
+
+		writeFile("10.0.0.1:8082\n10.0.0.2:8082")
+		Expect(finder.Next().GRPCDopplers).To(Equal([]string{
+			"10.0.0.1:8082",
+			"10.0.0.2:8082",
+		}))
+	})
+
+	It("drains all routers when the file contains an empty JSON array", func() {
+		writeFile("10.0.0.1:8082")
+		startFinder()
+		finder.Next()
+
+		writeFile("[]")
+		Expect(finder.Next().GRPCDopplers).To(BeEmpty())
+	})
+
+	It("keeps the last good set when the file is invalid", func() {
+		writeFile("10.0.0.1:8082")
+		startFinder()
+		finder.Next()
+
+		events := make(chan plumbing.Event, 10)
+		go func() {
+			events <- finder.Next()
+		}()
+
+		writeFile("10.0.0.1:8082\nnot-an-address")
+		Consistently(events, 200*time.Millisecond).ShouldNot(Receive())
+
+		writeFile("")
+		Consistently(events, 200*time.Millisecond).ShouldNot(Receive())
+		Expect(finder.Addrs()).To(Equal([]string{"10.0.0.1:8082"}))
+	})
+
+	It("yields no dopplers after stopping", func() {
+		writeFile("10.0.0.1:8082")
+		startFinder()
+		finder.Next()
+		finder.Stop()
+
+		Expect(finder.Next().GRPCDopplers).To(HaveLen(0))
+	})
+
+	It("stops while events are not being read", func() {
+		writeFile("10.0.0.0:8082")
+		finder = plumbing.NewFileFinder(
+			path,
+			plumbing.WithFilePollInterval(time.Millisecond),
+			plumbing.WithFileDebounce(time.Millisecond),
+		)
+		finder.Start()
+		addrs := "10.0.0.0:8082"
+		for i := 1; i <= 20; i++ {
+			addrs += fmt.Sprintf("\n10.0.0.%d:8082", i)
+			writeFile(addrs)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			finder.Stop()
+		}()
+		Eventually(stopped).Should(BeClosed())
+
+		var last plumbing.Event
+		for i := 0; i < 10; i++ {
+			last = finder.Next()
+			if len(last.GRPCDopplers) == 0 {
+				break
+			}
+		}
+		Expect(last.GRPCDopplers).To(HaveLen(0))
+	})
+})
@@ -6,7 +6,6 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"code.cloudfoundry.org/loggregator/metricemitter"
 	"google.golang.org/grpc/codes"
@@ -16,13 +15,14 @@ import (
 )
 
 const (
-	maxConnections = 2000
+	defaultMaxConsumers = 2000
 )
 
 // DopplerPool creates a pool of doppler gRPC connections
 type DopplerPool interface {
 	RegisterDoppler(addr string)
 	Subscribe(dopplerAddr string, ctx context.Context, req *SubscriptionRequest) (Doppler_BatchSubscribeClient, error)
+	RecentLogs(dopplerAddr string, ctx context.Context, req *RecentLogsRequest) (*RecentLogsResponse, error)
 
 	Close(dopplerAddr string)
 }
@@ -42,18 +42,21 @@ type GRPCConnector struct {
 	mu      sync.RWMutex
 	clients []*dopplerClientInfo
 
-	pool           DopplerPool
-	finder         Finder
-	consumerStates []unsafe.Pointer
-	bufferSize     int
+	pool         DopplerPool
+	finder       Finder
+	consumers    *consumerRegistry
+	maxConsumers int
+	bufferSize   int
 
-	ingressMetric   *metricemitter.Counter
-	recentLogsError *metricemitter.Counter
+	ingressMetric      *metricemitter.Counter
+	recentLogsError    *metricemitter.Counter
+	routerStateMetrics map[RouterState]*metricemitter.Gauge
 }
 
 // MetricClient creates new CounterMetrics to be emitted periodically.
 type MetricClient interface {
 	NewCounter(name string, opts ...metricemitter.MetricOption) *metricemitter.Counter
+	NewGauge(name, unit string, opts ...metricemitter.MetricOption) *metricemitter.Gauge
 }
 
 // NewGRPCConnector creates a new GRPCConnector.
@@ -62,6 +65,7 @@ func NewGRPCConnector(
 	pool DopplerPool,
 	f Finder,
 	m MetricClient,
+	opts ...GRPCConnectorOption,
 ) *GRPCConnector {
 	ingressMetric := m.NewCounter("ingress",
 		metricemitter.WithTags(map[string]string{
@@ -77,17 +81,34 @@ func NewGRPCConnector(
 	)
 
 	c := &GRPCConnector{
-		bufferSize:      bufferSize,
-		pool:            pool,
-		finder:          f,
-		consumerStates:  make([]unsafe.Pointer, maxConnections),
-		ingressMetric:   ingressMetric,
-		recentLogsError: recentLogsError,
+		bufferSize:         bufferSize,
+		maxConsumers:       defaultMaxConsumers,
+		pool:               pool,
+		finder:             f,
+		ingressMetric:      ingressMetric,
+		recentLogsError:    recentLogsError,
+		routerStateMetrics: NewRouterStateGauges(m),
 	}
+	for _, o := range opts {
+		o(c)
+	}
+	c.consumers = newConsumerRegistry(c.maxConsumers)
+
 	go c.readFinder()
 	return c
 }
 
+// GRPCConnectorOption is used to configure a new GRPCConnector.
+type GRPCConnectorOption func(*GRPCConnector)
+
+// WithMaxConsumers sets the maximum number of concurrent subscriptions. A
+// value of 0 or less removes the limit. It defaults to 2000.
+func WithMaxConsumers(n int) GRPCConnectorOption {
+	return func(c *GRPCConnector) {
+		c.maxConsumers = n
+	}
+}
+
 // Subscribe returns a Receiver that yields all corresponding messages from Doppler
 func (c *GRPCConnector) Subscribe(ctx context.Context, req *SubscriptionRequest) (recv func() ([]byte, error), err error) {
 	cs := &consumerState{
@@ -98,16 +119,17 @@ func (c *GRPCConnector) Subscribe(ctx context.Context, req *SubscriptionRequest)
 		dopplers: make(map[string]bool),
 	}
 
+	err = c.consumers.add(cs)
+	if err != nil {
+		return nil, err
+	}
+
 	go func() {
 		<-cs.ctx.Done()
 		atomic.StoreInt64(&cs.dead, 1)
+		c.consumers.remove(cs)
 	}()
 
-	err = c.addConsumerState(cs)
-	if err != nil {
-		return nil, err
-	}
-
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	log.Printf("Connecting to %d dopplers", len(c.clients))
@@ -117,6 +139,98 @@ func (c *GRPCConnector) Subscribe(ctx context.Context, req *SubscriptionRequest)
 	return cs.Recv, nil
 }
 
+// RecentLogs queries every connected doppler concurrently for the recent
+// logs of the given app. The results are merged and sorted by timestamp.
+// Dopplers that fail to respond before the context is done are counted and
+// skipped. An error is only returned if every doppler failed.
+func (c *GRPCConnector) RecentLogs(ctx context.Context, appID string) ([][]byte, error) {
+	c.mu.RLock()
+	var addrs []string
+	for _, client := range c.clients {
+		if client.disconnect || client.breaker.State() == RouterOpen {
+			continue
+		}
+		addrs = append(addrs, client.uri)
+	}
+	c.mu.RUnlock()
+
+	type result struct {
+		payload [][]byte
+		err     error
+	}
+
+	results := make(chan result, len(addrs))
+	for _, addr := range addrs {
+		go func(addr string) {
+			resp, err := c.pool.RecentLogs(addr, ctx, &RecentLogsRequest{AppID: appID})
+			if err != nil {
+				results <- result{err: fmt.Errorf("%s: %s", addr, err)}
+				return
+			}
+			results <- result{payload: resp.GetPayload()}
+		}(addr)
+	}
+
+	var (
+		payloads [][]byte
+		failures int
+		lastErr  error
+	)
+	for range addrs {
+		r := <-results
+		if r.err != nil {
+			log.Printf("failed to query recent logs from doppler %s", r.err)
+
+			// metric-documentation-v2: (query_error) Number of failed recent
+			// logs queries to Dopplers.
+			c.recentLogsError.Increment(1)
+			failures++
+			lastErr = r.err
+			continue
+		}
+		payloads = append(payloads, r.payload...)
+	}
+
+	if len(addrs) > 0 && failures == len(addrs) {
+		return nil, fmt.Errorf("failed to query recent logs from any doppler: %s", lastErr)
+	}
+
+	sortByTimestamp(payloads)
+
+	return payloads, nil
+}
+
+// RouterStates returns the connection state of each doppler known to the
+// connector.
+func (c *GRPCConnector) RouterStates() map[string]RouterState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	states := make(map[string]RouterState, len(c.clients))
+	for _, client := range c.clients {
+		states[client.uri] = client.breaker.State()
+	}
+
+	return states
+}
+
+func (c *GRPCConnector) reportRouterStates() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.setRouterStateMetrics()
+}
+
+// setRouterStateMetrics must be called while holding c.mu.
+func (c *GRPCConnector) setRouterStateMetrics() {
+	states := make([]RouterState, 0, len(c.clients))
+	for _, client := range c.clients {
+		states = append(states, client.breaker.State())
+	}
+
+	SetRouterStateGauges(c.routerStateMetrics, states)
+}
+
 func (c *GRPCConnector) readFinder() {
 	for {
 		e := c.finder.Next()
@@ -130,21 +244,24 @@ func (c *GRPCConnector) handleFinderEvent(uris []string) {
 	defer c.mu.Unlock()
 
 	newURIs, deadClients := c.delta(uris)
+	consumers := c.consumers.snapshot()
 
 	for _, addr := range newURIs {
 		c.pool.RegisterDoppler(addr)
 		client := &dopplerClientInfo{
 			uri: addr,
+			breaker: NewRouterBreaker(
+				WithBreakerStateChange(func(_, _ RouterState) {
+					c.reportRouterStates()
+				}),
+			),
 		}
 
 		c.clients = append(c.clients, client)
 
-		for i := range c.consumerStates {
-			cs := atomic.LoadPointer(&c.consumerStates[i])
-			if cs != nil &&
-				(*consumerState)(cs) != nil &&
-				atomic.LoadInt64(&(*consumerState)(cs).dead) == 0 {
-				go c.consumeSubscription((*consumerState)(cs), client)
+		for _, cs := range consumers {
+			if atomic.LoadInt64(&cs.dead) == 0 {
+				go c.consumeSubscription(cs, client)
 			}
 		}
 	}
@@ -159,6 +276,8 @@ func (c *GRPCConnector) handleFinderEvent(uris []string) {
 			c.close(deadClient)
 		}
 	}
+
+	c.setRouterStateMetrics()
 }
 
 func (c *GRPCConnector) delta(uris []string) (add []string, dead []*dopplerClientInfo) {
@@ -207,13 +326,12 @@ func (c *GRPCConnector) consumeSubscription(cs *consumerState, dopplerClient *do
 			log.Printf("closing doppler connection %s...", dopplerClient.uri)
 			c.pool.Close(dopplerClient.uri)
 			c.close(dopplerClient)
+			c.setRouterStateMetrics()
 		}
 
 		cs.forgetDoppler(dopplerClient.uri)
 	}()
 
-	delay := time.Millisecond
-
 	tried := false
 	for {
 		ctxDisconnect := atomic.LoadInt64(&cs.dead)
@@ -224,25 +342,36 @@ func (c *GRPCConnector) consumeSubscription(cs *consumerState, dopplerClient *do
 			log.Printf("Disconnecting from stream (%s) (doppler.disconnect=%v) (ctx.disconnect=%d)", dopplerClient.uri, dopplerDisconnect, ctxDisconnect)
 			return
 		}
+
+		if ok, wait := dopplerClient.breaker.Allow(); !ok {
+			select {
+			case <-cs.ctx.Done():
+			case <-time.After(wait):
+			}
+			continue
+		}
 		tried = true
 
 		dopplerStream, err := c.pool.Subscribe(dopplerClient.uri, cs.ctx, cs.req)
 
 		if err != nil {
 			log.Printf("Unable to connect to doppler (%s): %s", dopplerClient.uri, err)
-			time.Sleep(delay)
-			if delay < time.Minute {
-				delay *= 10
+			if cs.ctx.Err() == nil {
+				dopplerClient.breaker.Failure()
 			}
 			continue
 		}
+		dopplerClient.breaker.Success()
 
-		delay = time.Millisecond
+		err = c.readStream(dopplerStream, cs)
 
-		if err := c.readStream(dopplerStream, cs); err != nil {
+		if err != nil {
 			status, ok := status.FromError(err)
 			if ok && status.Code() != codes.Canceled {
 				log.Printf("error getting logs from provider: %s", err)
+				if cs.ctx.Err() == nil {
+					dopplerClient.breaker.Failure()
+				}
 			}
 			continue
 		}
@@ -271,26 +400,11 @@ func (c *GRPCConnector) readStream(s Doppler_BatchSubscribeClient, cs *consumerS
 	}
 }
 
-func (c *GRPCConnector) addConsumerState(cs *consumerState) error {
-	for i := range c.consumerStates {
-		state := atomic.LoadPointer(&c.consumerStates[i])
-		if state == nil ||
-			(*consumerState)(state) == nil ||
-			atomic.LoadInt64(&(*consumerState)(state).dead) != 0 {
-
-			if atomic.CompareAndSwapPointer(&c.consumerStates[i], state, unsafe.Pointer(cs)) {
-				return nil
-			}
-		}
-	}
-
-	return fmt.Errorf("at connection limit: %d", maxConnections)
-}
-
 type dopplerClientInfo struct {
 	uri        string
 	disconnect bool
 	refCount   int64
+	breaker    *RouterBreaker
 }
 
 type consumerState struct {
@@ -0,0 +1,55 @@
+package plumbing_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func BenchmarkSubscribeUnsubscribe(b *testing.B) {
+	connector := newBenchmarkConnector()
+	req := &plumbing.SubscriptionRequest{ShardID: "some-shard"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		if _, err := connector.Subscribe(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+		cancel()
+	}
+}
+
+func BenchmarkSubscribeUnsubscribeParallel(b *testing.B) {
+	connector := newBenchmarkConnector()
+	req := &plumbing.SubscriptionRequest{ShardID: "some-shard"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ctx, cancel := context.WithCancel(context.Background())
+			if _, err := connector.Subscribe(ctx, req); err != nil {
+				b.Fatal(err)
+			}
+			cancel()
+		}
+	})
+}
+
+func newBenchmarkConnector() *plumbing.GRPCConnector {
+	return plumbing.NewGRPCConnector(
+		5,
+		plumbing.NewPool(1, grpc.WithInsecure()),
+		plumbing.NewStaticFinder(nil),
+		testhelper.NewMetricClient(),
+		plumbing.WithMaxConsumers(0),
+	)
+}
@@ -1,6 +1,7 @@
 package plumbing_test
 
 import (
+	"errors"
 	"net"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
+	"github.com/cloudfoundry/sonde-go/events"
 	"github.com/gogo/protobuf/proto"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -377,9 +379,114 @@ var _ = Describe("GRPCConnector", func() {
 				})
 			})
 		})
+
+		Context("when the consumer limit is reached", func() {
+			BeforeEach(func() {
+				connector = plumbing.NewGRPCConnector(
+					5,
+					plumbing.NewPool(2, grpc.WithInsecure()),
+					newMockFinder(),
+					metricClient,
+					plumbing.WithMaxConsumers(1),
+				)
+			})
+
+			It("returns an error", func() {
+				_, err := connector.Subscribe(ctx, req)
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = connector.Subscribe(context.Background(), req)
+				Expect(err).To(MatchError("at connection limit: 1"))
+			})
+
+			It("accepts new consumers once a consumer is cancelled", func() {
+				_, err := connector.Subscribe(ctx, req)
+				Expect(err).ToNot(HaveOccurred())
+				cancelCtx()
+
+				Eventually(func() error {
+					_, err := connector.Subscribe(context.Background(), req)
+					return err
+				}).Should(Succeed())
+			})
+		})
+	})
+
+	Describe("RecentLogs()", func() {
+		BeforeEach(func() {
+			mockFinder.NextOutput.Ret0 <- plumbing.Event{
+				GRPCDopplers: createGrpcURIs(listeners),
+			}
+
+			_, _, ready := readFromSubscription(context.Background(), req, connector)
+			Eventually(ready).Should(BeClosed())
+			Eventually(mockDopplerServerA.BatchSubscribeCalled).Should(Receive())
+			Eventually(mockDopplerServerB.BatchSubscribeCalled).Should(Receive())
+		})
+
+		It("returns the logs from every doppler sorted by timestamp", func() {
+			logA := buildLogMessage("a", 2)
+			logB := buildLogMessage("b", 1)
+			mockDopplerServerA.RecentLogsOutput.Resp <- &plumbing.RecentLogsResponse{
+				Payload: [][]byte{logA},
+			}
+			mockDopplerServerA.RecentLogsOutput.Err <- nil
+			mockDopplerServerB.RecentLogsOutput.Resp <- &plumbing.RecentLogsResponse{
+				Payload: [][]byte{logB},
+			}
+			mockDopplerServerB.RecentLogsOutput.Err <- nil
+
+			logs, err := connector.RecentLogs(context.Background(), "test-app-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logs).To(Equal([][]byte{logB, logA}))
+
+			var r *plumbing.RecentLogsRequest
+			Expect(mockDopplerServerA.RecentLogsInput.Req).To(Receive(&r))
+			Expect(r.AppID).To(Equal("test-app-id"))
+		})
+
+		It("skips dopplers that fail", func() {
+			logA := buildLogMessage("a", 1)
+			mockDopplerServerA.RecentLogsOutput.Resp <- &plumbing.RecentLogsResponse{
+				Payload: [][]byte{logA},
+			}
+			mockDopplerServerA.RecentLogsOutput.Err <- nil
+			mockDopplerServerB.RecentLogsOutput.Resp <- nil
+			mockDopplerServerB.RecentLogsOutput.Err <- errors.New("some-error")
+
+			logs, err := connector.RecentLogs(context.Background(), "test-app-id")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logs).To(Equal([][]byte{logA}))
+			Expect(metricClient.GetDelta("query_error")).To(Equal(uint64(1)))
+		})
+
+		It("returns an error when every doppler fails", func() {
+			for _, m := range []*mockDopplerServer{mockDopplerServerA, mockDopplerServerB} {
+				m.RecentLogsOutput.Resp <- nil
+				m.RecentLogsOutput.Err <- errors.New("some-error")
+			}
+
+			_, err := connector.RecentLogs(context.Background(), "test-app-id")
+			Expect(err).To(HaveOccurred())
+		})
 	})
 })
 
+func buildLogMessage(msg string, timestamp int64) []byte {
+	b, err := proto.Marshal(&events.Envelope{
+		Origin:    proto.String("some-origin"),
+		EventType: events.Envelope_LogMessage.Enum(),
+		Timestamp: proto.Int64(timestamp),
+		LogMessage: &events.LogMessage{
+			Message:     []byte(msg),
+			MessageType: events.LogMessage_OUT.Enum(),
+			Timestamp:   proto.Int64(timestamp),
+		},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return b
+}
+
 func readFromSubscription(ctx context.Context, req *plumbing.SubscriptionRequest, connector *plumbing.GRPCConnector) (<-chan []byte, <-chan error, chan struct{}) {
 	data := make(chan []byte, 100)
 	errs := make(chan error, 100)
@@ -0,0 +1,114 @@
+package plumbing
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthCheck reports why a component cannot serve. It returns nil when the
+// component is able to serve.
+type HealthCheck func() error
+
+// GRPCHealth serves the standard grpc.health.v1.Health service. The overall
+// serving status is SERVING while every check passes and NOT_SERVING
+// otherwise. Once draining it is NOT_SERVING regardless of the checks.
+type GRPCHealth struct {
+	server *health.Server
+	checks []HealthCheck
+
+	mu       sync.Mutex
+	serving  bool
+	draining bool
+	done     chan struct{}
+}
+
+// NewGRPCHealth creates a new GRPCHealth with the given checks. It reports
+// NOT_SERVING until the checks are first evaluated by Update or Start.
+func NewGRPCHealth(checks ...HealthCheck) *GRPCHealth {
+	h := &GRPCHealth{
+		server: health.NewServer(),
+		checks: checks,
+		done:   make(chan struct{}),
+	}
+	h.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return h
+}
+
+// Register registers the health service on the given gRPC server.
+func (h *GRPCHealth) Register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, h.server)
+}
+
+// Start evaluates the checks on the given interval until Drain is called.
+func (h *GRPCHealth) Start(interval time.Duration) {
+	h.Update()
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				h.Update()
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+// Update evaluates the checks and sets the serving status.
+func (h *GRPCHealth) Update() {
+	var reason error
+	for _, check := range h.checks {
+		if err := check(); err != nil {
+			reason = err
+			break
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return
+	}
+
+	serving := reason == nil
+	if serving == h.serving {
+		return
+	}
+	h.serving = serving
+
+	if !serving {
+		log.Printf("grpc health: not serving: %s", reason)
+		h.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		return
+	}
+
+	log.Print("grpc health: serving")
+	h.server.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+}
+
+// Drain reports NOT_SERVING from now on.
+func (h *GRPCHealth) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return
+	}
+	h.draining = true
+	h.serving = false
+	close(h.done)
+
+	log.Print("grpc health: draining")
+	h.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+}
@@ -0,0 +1,86 @@
+package plumbing_test
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GRPCHealth", func() {
+	var (
+		failing int32
+		health  *plumbing.GRPCHealth
+		server  *grpc.Server
+		conn    *grpc.ClientConn
+		client  healthpb.HealthClient
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&failing, 0)
+		health = plumbing.NewGRPCHealth(func() error {
+			if atomic.LoadInt32(&failing) == 1 {
+				return errors.New("failing")
+			}
+			return nil
+		})
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		server = grpc.NewServer()
+		health.Register(server)
+		go server.Serve(lis)
+
+		conn, err = grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		Expect(err).ToNot(HaveOccurred())
+		client = healthpb.NewHealthClient(conn)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	status := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		Expect(err).ToNot(HaveOccurred())
+		return resp.GetStatus()
+	}
+
+	It("is not serving until the checks are evaluated", func() {
+		Expect(status()).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+	})
+
+	It("is serving while every check passes", func() {
+		health.Update()
+		Expect(status()).To(Equal(healthpb.HealthCheckResponse_SERVING))
+
+		atomic.StoreInt32(&failing, 1)
+		health.Update()
+		Expect(status()).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+
+		atomic.StoreInt32(&failing, 0)
+		health.Update()
+		Expect(status()).To(Equal(healthpb.HealthCheckResponse_SERVING))
+	})
+
+	It("is not serving once draining", func() {
+		health.Start(time.Millisecond)
+		Eventually(status).Should(Equal(healthpb.HealthCheckResponse_SERVING))
+
+		health.Drain()
+		Expect(status()).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+
+		health.Update()
+		Consistently(status).Should(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+	})
+})
@@ -0,0 +1,48 @@
+package plumbing
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+)
+
+// MultiStatsHandler combines several stats.Handlers so that they can be
+// installed on a single gRPC client or server, which only accepts one.
+type MultiStatsHandler []stats.Handler
+
+// NewMultiStatsHandler creates a new MultiStatsHandler that passes each call
+// to the given handlers in order.
+func NewMultiStatsHandler(handlers ...stats.Handler) MultiStatsHandler {
+	return MultiStatsHandler(handlers)
+}
+
+// TagRPC implements stats.Handler.
+func (m MultiStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	for _, h := range m {
+		ctx = h.TagRPC(ctx, info)
+	}
+
+	return ctx
+}
+
+// HandleRPC implements stats.Handler.
+func (m MultiStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	for _, h := range m {
+		h.HandleRPC(ctx, s)
+	}
+}
+
+// TagConn implements stats.Handler.
+func (m MultiStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	for _, h := range m {
+		ctx = h.TagConn(ctx, info)
+	}
+
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (m MultiStatsHandler) HandleConn(ctx context.Context, s stats.ConnStats) {
+	for _, h := range m {
+		h.HandleConn(ctx, s)
+	}
+}
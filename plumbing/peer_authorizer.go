@@ -0,0 +1,127 @@
+package plumbing
+
+import (
+	"log"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerAuthorizer authorizes gRPC calls by the identity in the certificate of
+// the calling peer. The identities of a certificate are its common name, its
+// DNS SANs and its URI SANs, such as a SPIFFE ID.
+type PeerAuthorizer struct {
+	rules map[string]map[string]bool
+}
+
+// NewPeerAuthorizer returns a PeerAuthorizer for the given rules. Each rule
+// maps a method pattern to the identities allowed to call it. A pattern is
+// either a full method name such as /loggregator.v2.Ingress/Send or a
+// service followed by /* such as /loggregator.v2.Ingress/*. Full method
+// names take precedence over services. Calls to methods that do not match
+// any pattern are allowed.
+func NewPeerAuthorizer(rules map[string][]string) *PeerAuthorizer {
+	a := &PeerAuthorizer{
+		rules: make(map[string]map[string]bool),
+	}
+
+	for pattern, identities := range rules {
+		allowed := make(map[string]bool)
+		for _, id := range identities {
+			allowed[id] = true
+		}
+		a.rules[pattern] = allowed
+	}
+
+	return a
+}
+
+// UnaryServerInterceptor returns an interceptor that authorizes unary calls.
+func (a *PeerAuthorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := a.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that authorizes streaming
+// calls.
+func (a *PeerAuthorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := a.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (a *PeerAuthorizer) authorize(ctx context.Context, method string) error {
+	allowed, ok := a.rules[method]
+	if !ok {
+		allowed, ok = a.rules[method[:strings.LastIndex(method, "/")+1]+"*"]
+	}
+	if !ok {
+		return nil
+	}
+
+	var addr string
+	ids := peerIdentities(ctx)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+
+	for _, id := range ids {
+		if allowed[id] {
+			return nil
+		}
+	}
+
+	log.Printf("security: denied %s to peer %s with identities %v", method, addr, ids)
+
+	return status.Errorf(codes.PermissionDenied, "peer is not authorized to call %s", method)
+}
+
+// peerIdentities returns the identities in the leaf certificate of the peer.
+func peerIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+
+	cert := info.State.PeerCertificates[0]
+
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+
+	return ids
+}
@@ -0,0 +1,148 @@
+package plumbing_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerAuthorizer", func() {
+	var (
+		authorizer *plumbing.PeerAuthorizer
+		called     bool
+	)
+
+	unaryCall := func(ctx context.Context, method string) error {
+		called = false
+		_, err := authorizer.UnaryServerInterceptor()(
+			ctx,
+			nil,
+			&grpc.UnaryServerInfo{FullMethod: method},
+			func(context.Context, interface{}) (interface{}, error) {
+				called = true
+				return nil, nil
+			},
+		)
+		return err
+	}
+
+	streamCall := func(ctx context.Context, method string) error {
+		called = false
+		return authorizer.StreamServerInterceptor()(
+			nil,
+			&spyServerStream{ctx: ctx},
+			&grpc.StreamServerInfo{FullMethod: method},
+			func(interface{}, grpc.ServerStream) error {
+				called = true
+				return nil
+			},
+		)
+	}
+
+	BeforeEach(func() {
+		authorizer = plumbing.NewPeerAuthorizer(map[string][]string{
+			"/loggregator.v2.Ingress/*":              {"metron"},
+			"/loggregator.v2.Egress/*":               {"reverselogproxy", "spiffe://loggregator/trafficcontroller"},
+			"/loggregator.v2.Egress/BatchedReceiver": {"reverselogproxy"},
+		})
+	})
+
+	It("allows peers with an allowed common name", func() {
+		err := streamCall(peerContext(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "metron"},
+		}), "/loggregator.v2.Ingress/BatchSender")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(called).To(BeTrue())
+	})
+
+	It("allows peers with an allowed DNS SAN", func() {
+		err := unaryCall(peerContext(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "some-name"},
+			DNSNames: []string{"metron"},
+		}), "/loggregator.v2.Ingress/Send")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(called).To(BeTrue())
+	})
+
+	It("allows peers with an allowed URI SAN", func() {
+		u, err := url.Parse("spiffe://loggregator/trafficcontroller")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = streamCall(peerContext(&x509.Certificate{
+			URIs: []*url.URL{u},
+		}), "/loggregator.v2.Egress/Receiver")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(called).To(BeTrue())
+	})
+
+	It("denies peers that are not allowed", func() {
+		err := streamCall(peerContext(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "metron"},
+		}), "/loggregator.v2.Egress/Receiver")
+
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+		Expect(called).To(BeFalse())
+	})
+
+	It("prefers rules for the full method over the service", func() {
+		u, err := url.Parse("spiffe://loggregator/trafficcontroller")
+		Expect(err).ToNot(HaveOccurred())
+
+		err = streamCall(peerContext(&x509.Certificate{
+			URIs: []*url.URL{u},
+		}), "/loggregator.v2.Egress/BatchedReceiver")
+
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	It("denies peers without a certificate", func() {
+		err := unaryCall(context.Background(), "/loggregator.v2.Ingress/Send")
+
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+		Expect(called).To(BeFalse())
+	})
+
+	It("allows calls to methods without a rule", func() {
+		err := unaryCall(context.Background(), "/plumbing.Doppler/RecentLogs")
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(called).To(BeTrue())
+	})
+})
+
+func peerContext(cert *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+			},
+		},
+	})
+}
+
+type spyServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *spyServerStream) Context() context.Context {
+	return s.ctx
+}
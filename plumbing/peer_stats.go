@@ -0,0 +1,242 @@
+package plumbing
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+)
+
+// OtherPeers is the address and identity that peers are reported under once
+// a PeerStatsHandler is tracking its maximum number of peers.
+const OtherPeers = "other"
+
+const unknownPeer = "unknown"
+
+// PeerStat holds the payload bytes and messages exchanged with a peer over a
+// single RPC method.
+type PeerStat struct {
+	Addr     string
+	Identity string
+	Method   string
+
+	BytesIn     uint64
+	BytesOut    uint64
+	MessagesIn  uint64
+	MessagesOut uint64
+}
+
+// PeerStatsHandler implements google.golang.org/grpc/stats.Handler and
+// tracks the bytes and messages received and sent per peer and per RPC
+// method. A peer is identified by the host of its remote address and the
+// common name of its certificate. It can be used by both clients and
+// servers.
+type PeerStatsHandler struct {
+	maxPeers int
+
+	mu       sync.Mutex
+	peers    map[peerKey]bool
+	counters map[peerStatKey]*peerCounters
+}
+
+// PeerStatsOption configures a PeerStatsHandler.
+type PeerStatsOption func(*PeerStatsHandler)
+
+// WithMaxPeers bounds the number of distinct peers that are tracked. Once
+// the limit is reached, any new peer is counted under OtherPeers. A value of
+// 0 or less removes the limit. It defaults to 500.
+func WithMaxPeers(n int) PeerStatsOption {
+	return func(h *PeerStatsHandler) {
+		h.maxPeers = n
+	}
+}
+
+// NewPeerStatsHandler creates a new PeerStatsHandler.
+func NewPeerStatsHandler(opts ...PeerStatsOption) *PeerStatsHandler {
+	h := &PeerStatsHandler{
+		maxPeers: 500,
+		peers:    make(map[peerKey]bool),
+		counters: make(map[peerStatKey]*peerCounters),
+	}
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
+}
+
+// Stats returns the current totals for each peer and method, sorted by
+// address, identity and method.
+func (h *PeerStatsHandler) Stats() []PeerStat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]PeerStat, 0, len(h.counters))
+	for k, c := range h.counters {
+		result = append(result, PeerStat{
+			Addr:        k.addr,
+			Identity:    k.identity,
+			Method:      k.method,
+			BytesIn:     atomic.LoadUint64(&c.bytesIn),
+			BytesOut:    atomic.LoadUint64(&c.bytesOut),
+			MessagesIn:  atomic.LoadUint64(&c.messagesIn),
+			MessagesOut: atomic.LoadUint64(&c.messagesOut),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Addr != result[j].Addr {
+			return result[i].Addr < result[j].Addr
+		}
+		if result[i].Identity != result[j].Identity {
+			return result[i].Identity < result[j].Identity
+		}
+		return result[i].Method < result[j].Method
+	})
+
+	return result
+}
+
+// TagConn implements stats.Handler. It records the remote address of the
+// connection so that it is available to RPCs on a server.
+func (h *PeerStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	if info.RemoteAddr == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, connAddrKey{}, info.RemoteAddr)
+}
+
+// HandleConn implements stats.Handler.
+func (h *PeerStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// TagRPC implements stats.Handler.
+func (h *PeerStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, rpcTagKey{}, &rpcTag{method: info.FullMethodName})
+}
+
+// HandleRPC implements stats.Handler.
+func (h *PeerStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	var in bool
+	var length int
+	switch p := s.(type) {
+	case *stats.InPayload:
+		in, length = true, p.Length
+	case *stats.OutPayload:
+		length = p.Length
+	default:
+		return
+	}
+
+	tag, ok := ctx.Value(rpcTagKey{}).(*rpcTag)
+	if !ok {
+		return
+	}
+
+	c := tag.counters(ctx, h)
+	if in {
+		atomic.AddUint64(&c.bytesIn, uint64(length))
+		atomic.AddUint64(&c.messagesIn, 1)
+		return
+	}
+	atomic.AddUint64(&c.bytesOut, uint64(length))
+	atomic.AddUint64(&c.messagesOut, 1)
+}
+
+func (h *PeerStatsHandler) countersFor(p peerKey, method string) *peerCounters {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.peers[p] {
+		if h.maxPeers > 0 && len(h.peers) >= h.maxPeers {
+			p = peerKey{addr: OtherPeers, identity: OtherPeers}
+		}
+		h.peers[p] = true
+	}
+
+	k := peerStatKey{peerKey: p, method: method}
+	c, ok := h.counters[k]
+	if !ok {
+		c = &peerCounters{}
+		h.counters[k] = c
+	}
+
+	return c
+}
+
+type connAddrKey struct{}
+
+type rpcTagKey struct{}
+
+// rpcTag resolves the counters for an RPC on its first payload. The peer is
+// not known when a client RPC is tagged and may not be known until the
+// server responds.
+type rpcTag struct {
+	method string
+
+	mu sync.Mutex
+	c  *peerCounters
+}
+
+func (t *rpcTag) counters(ctx context.Context, h *PeerStatsHandler) *peerCounters {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.c != nil {
+		return t.c
+	}
+
+	p := peerFromContext(ctx)
+	c := h.countersFor(p, t.method)
+	if p.addr != unknownPeer {
+		t.c = c
+	}
+
+	return c
+}
+
+type peerKey struct {
+	addr     string
+	identity string
+}
+
+type peerStatKey struct {
+	peerKey
+	method string
+}
+
+type peerCounters struct {
+	bytesIn     uint64
+	bytesOut    uint64
+	messagesIn  uint64
+	messagesOut uint64
+}
+
+func peerFromContext(ctx context.Context) peerKey {
+	var addr net.Addr
+	var identity string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			identity = info.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	if addr == nil {
+		addr, _ = ctx.Value(connAddrKey{}).(net.Addr)
+	}
+
+	k := peerKey{addr: unknownPeer, identity: identity}
+	if addr != nil {
+		k.addr = addr.String()
+		if host, _, err := net.SplitHostPort(k.addr); err == nil {
+			k.addr = host
+		}
+	}
+
+	return k
+}
@@ -0,0 +1,119 @@
+package plumbing_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PeerStatsHandler", func() {
+	var h *plumbing.PeerStatsHandler
+
+	BeforeEach(func() {
+		h = plumbing.NewPeerStatsHandler(plumbing.WithMaxPeers(2))
+	})
+
+	It("counts bytes and messages per peer and method", func() {
+		ctx := rpcContext(h, "10.0.0.1:1234", "metron", "/loggregator.v2.Ingress/Sender")
+		h.HandleRPC(ctx, &stats.InPayload{Length: 100})
+		h.HandleRPC(ctx, &stats.InPayload{Length: 50})
+		h.HandleRPC(ctx, &stats.OutPayload{Length: 10})
+		h.HandleRPC(ctx, &stats.End{})
+
+		Expect(h.Stats()).To(ConsistOf(plumbing.PeerStat{
+			Addr:        "10.0.0.1",
+			Identity:    "metron",
+			Method:      "/loggregator.v2.Ingress/Sender",
+			BytesIn:     150,
+			BytesOut:    10,
+			MessagesIn:  2,
+			MessagesOut: 1,
+		}))
+	})
+
+	It("uses the remote address of the connection without a peer", func() {
+		ctx := h.TagConn(context.Background(), &stats.ConnTagInfo{
+			RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 1234},
+		})
+		ctx = h.TagRPC(ctx, &stats.RPCTagInfo{FullMethodName: "/a/b"})
+		h.HandleRPC(ctx, &stats.OutPayload{Length: 10})
+
+		Expect(h.Stats()).To(ConsistOf(plumbing.PeerStat{
+			Addr:        "10.0.0.2",
+			Method:      "/a/b",
+			BytesOut:    10,
+			MessagesOut: 1,
+		}))
+	})
+
+	It("counts peers over the limit as other", func() {
+		for _, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1", "10.0.0.4:1"} {
+			ctx := rpcContext(h, addr, "metron", "/a/b")
+			h.HandleRPC(ctx, &stats.InPayload{Length: 1})
+		}
+
+		var addrs []string
+		var other plumbing.PeerStat
+		for _, s := range h.Stats() {
+			addrs = append(addrs, s.Addr)
+			if s.Addr == plumbing.OtherPeers {
+				other = s
+			}
+		}
+		Expect(addrs).To(Equal([]string{"10.0.0.1", "10.0.0.2", plumbing.OtherPeers}))
+		Expect(other.MessagesIn).To(Equal(uint64(2)))
+	})
+
+	It("keeps counting peers that were seen before reaching the limit", func() {
+		for _, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1", "10.0.0.1:2"} {
+			ctx := rpcContext(h, addr, "metron", "/a/b")
+			h.HandleRPC(ctx, &stats.InPayload{Length: 1})
+		}
+
+		Expect(h.Stats()[0].Addr).To(Equal("10.0.0.1"))
+		Expect(h.Stats()[0].MessagesIn).To(Equal(uint64(2)))
+	})
+})
+
+var _ = Describe("MultiStatsHandler", func() {
+	It("passes stats to each handler", func() {
+		a := plumbing.NewPeerStatsHandler()
+		b := plumbing.NewSizeStatsHandler()
+		m := plumbing.NewMultiStatsHandler(a, b)
+
+		ctx := rpcContext(m, "10.0.0.1:1234", "metron", "/a/b")
+		m.HandleRPC(ctx, &stats.InPayload{Length: 100})
+
+		Expect(a.Stats()).To(HaveLen(1))
+		Expect(b.In().Snapshot().Count()).To(Equal(uint64(1)))
+	})
+})
+
+func rpcContext(h stats.Handler, addr, cn, method string) context.Context {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	Expect(err).ToNot(HaveOccurred())
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: tcpAddr,
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{
+					{Subject: pkix.Name{CommonName: cn}},
+				},
+			},
+		},
+	})
+
+	return h.TagRPC(ctx, &stats.RPCTagInfo{FullMethodName: method})
+}
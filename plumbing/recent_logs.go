@@ -0,0 +1,43 @@
+package plumbing
+
+import (
+	"sort"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+type timestampedPayload struct {
+	payload   []byte
+	timestamp int64
+}
+
+// sortByTimestamp sorts marshalled v1 envelopes by their timestamp, oldest
+// first. Log messages are sorted by the timestamp of the message rather than
+// the envelope. Envelopes that can not be unmarshalled are sorted first.
+func sortByTimestamp(payloads [][]byte) {
+	sorted := make([]timestampedPayload, 0, len(payloads))
+	for _, p := range payloads {
+		var e events.Envelope
+		var ts int64
+		if err := proto.Unmarshal(p, &e); err == nil {
+			ts = e.GetTimestamp()
+			if e.GetLogMessage() != nil {
+				ts = e.GetLogMessage().GetTimestamp()
+			}
+		}
+
+		sorted = append(sorted, timestampedPayload{
+			payload:   p,
+			timestamp: ts,
+		})
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].timestamp < sorted[j].timestamp
+	})
+
+	for i, s := range sorted {
+		payloads[i] = s.payload
+	}
+}
@@ -0,0 +1,32 @@
+package plumbing
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ReportingFinder wraps a Finder and records each set of router addresses
+// it yields as a gauge labeled with the address.
+type ReportingFinder struct {
+	Finder
+	addrs *prometheus.GaugeVec
+}
+
+// NewReportingFinder returns a ReportingFinder that records the addresses
+// yielded by f in addrs. addrs must have a single label for the address.
+func NewReportingFinder(f Finder, addrs *prometheus.GaugeVec) *ReportingFinder {
+	return &ReportingFinder{
+		Finder: f,
+		addrs:  addrs,
+	}
+}
+
+// Next returns the next event of the wrapped Finder and records its
+// addresses.
+func (f *ReportingFinder) Next() Event {
+	e := f.Finder.Next()
+
+	f.addrs.Reset()
+	for _, addr := range e.GRPCDopplers {
+		f.addrs.WithLabelValues(addr).Set(1)
+	}
+
+	return e
+}
@@ -0,0 +1,45 @@
+package plumbing_test
+
+import (
+	"code.cloudfoundry.org/loggregator/plumbing"
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReportingFinder", func() {
+	It("records the addresses of the latest event", func() {
+		addrs := prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{Name: "routerAddrs"},
+			[]string{"addr"},
+		)
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(addrs)
+
+		static := plumbing.NewStaticFinder([]string{"1.1.1.1:1", "2.2.2.2:2"})
+		finder := plumbing.NewReportingFinder(static, addrs)
+
+		event := finder.Next()
+		Expect(event.GRPCDopplers).To(Equal([]string{"1.1.1.1:1", "2.2.2.2:2"}))
+		Expect(reportedAddrs(registry)).To(ConsistOf("1.1.1.1:1", "2.2.2.2:2"))
+
+		static.Stop()
+		finder.Next()
+		Expect(reportedAddrs(registry)).To(BeEmpty())
+	})
+})
+
+func reportedAddrs(g prometheus.Gatherer) []string {
+	families, err := g.Gather()
+	Expect(err).ToNot(HaveOccurred())
+
+	var addrs []string
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			addrs = append(addrs, m.GetLabel()[0].GetValue())
+		}
+	}
+
+	return addrs
+}
@@ -0,0 +1,242 @@
+package plumbing
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/metricemitter"
+)
+
+const (
+	defaultBreakerMinDelay      = 10 * time.Millisecond
+	defaultBreakerMaxDelay      = time.Minute
+	defaultBreakerOpenThreshold = 5
+)
+
+// RouterState is the connection state of a router as tracked by a
+// RouterBreaker.
+type RouterState int
+
+const (
+	// RouterConnected means the last attempt to subscribe to the router
+	// succeeded.
+	RouterConnected RouterState = iota
+
+	// RouterBackingOff means a recent attempt to subscribe to the router
+	// failed. Once the backoff delay has elapsed a single attempt is allowed
+	// to probe the router.
+	RouterBackingOff
+
+	// RouterOpen means several consecutive attempts to subscribe to the
+	// router failed. It is probed like RouterBackingOff but reported
+	// separately since the router is likely down.
+	RouterOpen
+)
+
+func (s RouterState) String() string {
+	switch s {
+	case RouterConnected:
+		return "connected"
+	case RouterBackingOff:
+		return "backing_off"
+	case RouterOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the state as its name, for example in JSON.
+func (s RouterState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// RouterBreaker is a circuit breaker for a single router. It is shared by
+// every subscription to the router so that failing routers are retried with
+// a jittered exponential backoff rather than by every subscription at once.
+type RouterBreaker struct {
+	minDelay      time.Duration
+	maxDelay      time.Duration
+	openThreshold int
+	onChange      func(from, to RouterState)
+
+	mu       sync.Mutex
+	state    RouterState
+	failures int
+	delay    time.Duration
+	retryAt  time.Time
+	probing  bool
+	probedAt time.Time
+}
+
+// RouterBreakerOption is used to configure a new RouterBreaker.
+type RouterBreakerOption func(*RouterBreaker)
+
+// WithBreakerDelays sets the minimum and maximum backoff delay. They default
+// to 10 milliseconds and 1 minute.
+func WithBreakerDelays(min, max time.Duration) RouterBreakerOption {
+	return func(b *RouterBreaker) {
+		b.minDelay = min
+		b.maxDelay = max
+	}
+}
+
+// WithBreakerOpenThreshold sets the number of consecutive failures after
+// which the circuit is opened. It defaults to 5.
+func WithBreakerOpenThreshold(n int) RouterBreakerOption {
+	return func(b *RouterBreaker) {
+		b.openThreshold = n
+	}
+}
+
+// WithBreakerStateChange sets a callback that is invoked each time the state
+// of the breaker changes.
+func WithBreakerStateChange(f func(from, to RouterState)) RouterBreakerOption {
+	return func(b *RouterBreaker) {
+		b.onChange = f
+	}
+}
+
+// NewRouterBreaker creates a new RouterBreaker in the connected state.
+func NewRouterBreaker(opts ...RouterBreakerOption) *RouterBreaker {
+	b := &RouterBreaker{
+		minDelay:      defaultBreakerMinDelay,
+		maxDelay:      defaultBreakerMaxDelay,
+		openThreshold: defaultBreakerOpenThreshold,
+	}
+	for _, o := range opts {
+		o(b)
+	}
+
+	return b
+}
+
+// Allow reports whether an attempt to subscribe to the router may be made.
+// If not, it returns how long to wait before asking again.
+func (b *RouterBreaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == RouterConnected {
+		return true, 0
+	}
+
+	now := time.Now()
+	if now.Before(b.retryAt) {
+		return false, b.retryAt.Sub(now) + jitter(b.delay/2)
+	}
+
+	// Only a single probe is allowed so that the subscriptions waiting on
+	// the router do not all retry at once. A probe that has not reported
+	// back within the maximum delay is assumed to be lost and another one is
+	// allowed.
+	if b.probing && now.Sub(b.probedAt) < b.maxDelay {
+		return false, b.delay + jitter(b.delay/2)
+	}
+	b.probing = true
+	b.probedAt = now
+
+	return true, 0
+}
+
+// Success records a successful attempt and closes the circuit.
+func (b *RouterBreaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.state = RouterConnected
+	b.failures = 0
+	b.delay = 0
+	b.probing = false
+	b.mu.Unlock()
+
+	b.changed(from, RouterConnected)
+}
+
+// Failure records a failed attempt. Failures reported while the breaker is
+// already waiting out a backoff delay are ignored, so that many
+// subscriptions failing at once only count as a single failure.
+func (b *RouterBreaker) Failure() {
+	b.mu.Lock()
+	from := b.state
+	now := time.Now()
+	if from != RouterConnected && now.Before(b.retryAt) {
+		b.mu.Unlock()
+		return
+	}
+
+	b.failures++
+	b.probing = false
+
+	if b.delay == 0 {
+		b.delay = b.minDelay
+	} else {
+		b.delay *= 2
+	}
+	if b.delay > b.maxDelay {
+		b.delay = b.maxDelay
+	}
+	b.retryAt = now.Add(b.delay/2 + jitter(b.delay/2))
+
+	b.state = RouterBackingOff
+	if b.failures >= b.openThreshold {
+		b.state = RouterOpen
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.changed(from, to)
+}
+
+// State returns the current state of the breaker.
+func (b *RouterBreaker) State() RouterState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *RouterBreaker) changed(from, to RouterState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// NewRouterStateGauges creates a gauge for each RouterState that counts the
+// routers in that state.
+func NewRouterStateGauges(m MetricClient) map[RouterState]*metricemitter.Gauge {
+	gauges := make(map[RouterState]*metricemitter.Gauge)
+	for _, state := range []RouterState{RouterConnected, RouterBackingOff, RouterOpen} {
+		// metric-documentation-v2: (log_routers) Number of routers in each
+		// connection state.
+		gauges[state] = m.NewGauge("log_routers", "routers",
+			metricemitter.WithVersion(2, 0),
+			metricemitter.WithTags(map[string]string{
+				"state": state.String(),
+			}),
+		)
+	}
+
+	return gauges
+}
+
+// SetRouterStateGauges sets each gauge to the number of the given states
+// that match it.
+func SetRouterStateGauges(gauges map[RouterState]*metricemitter.Gauge, states []RouterState) {
+	counts := make(map[RouterState]float64)
+	for _, s := range states {
+		counts[s]++
+	}
+
+	for state, g := range gauges {
+		g.Set(counts[state])
+	}
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
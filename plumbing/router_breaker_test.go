@@ -0,0 +1,134 @@
+package plumbing_test
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RouterBreaker", func() {
+	var (
+		breaker *plumbing.RouterBreaker
+		changes *spyStateChanges
+	)
+
+	BeforeEach(func() {
+		changes = &spyStateChanges{}
+		breaker = plumbing.NewRouterBreaker(
+			plumbing.WithBreakerDelays(50*time.Millisecond, time.Second),
+			plumbing.WithBreakerOpenThreshold(2),
+			plumbing.WithBreakerStateChange(changes.record),
+		)
+	})
+
+	It("starts connected and allows attempts", func() {
+		Expect(breaker.State()).To(Equal(plumbing.RouterConnected))
+
+		ok, wait := breaker.Allow()
+		Expect(ok).To(BeTrue())
+		Expect(wait).To(BeZero())
+	})
+
+	It("backs off after a failure", func() {
+		breaker.Failure()
+		Expect(breaker.State()).To(Equal(plumbing.RouterBackingOff))
+
+		ok, wait := breaker.Allow()
+		Expect(ok).To(BeFalse())
+		Expect(wait).To(BeNumerically(">", 0))
+
+		Eventually(func() bool {
+			ok, _ := breaker.Allow()
+			return ok
+		}).Should(BeTrue())
+	})
+
+	It("only counts one failure per backoff period", func() {
+		breaker.Failure()
+		breaker.Failure()
+		breaker.Failure()
+
+		Expect(breaker.State()).To(Equal(plumbing.RouterBackingOff))
+	})
+
+	It("opens the circuit after consecutive failures", func() {
+		breaker.Failure()
+		Eventually(func() bool {
+			ok, _ := breaker.Allow()
+			return ok
+		}).Should(BeTrue())
+		breaker.Failure()
+
+		Expect(breaker.State()).To(Equal(plumbing.RouterOpen))
+	})
+
+	It("allows a single probe while backing off", func() {
+		breaker.Failure()
+		Eventually(func() bool {
+			ok, _ := breaker.Allow()
+			return ok
+		}).Should(BeTrue())
+
+		ok, _ := breaker.Allow()
+		Expect(ok).To(BeFalse())
+		Expect(breaker.State()).To(Equal(plumbing.RouterBackingOff))
+
+		breaker.Success()
+		ok, _ = breaker.Allow()
+		Expect(ok).To(BeTrue())
+	})
+
+	It("allows a single probe when the circuit is open", func() {
+		breaker.Failure()
+		Eventually(func() bool {
+			ok, _ := breaker.Allow()
+			return ok
+		}).Should(BeTrue())
+		breaker.Failure()
+
+		Eventually(func() bool {
+			ok, _ := breaker.Allow()
+			return ok
+		}).Should(BeTrue())
+
+		ok, _ := breaker.Allow()
+		Expect(ok).To(BeFalse())
+
+		breaker.Success()
+		Expect(breaker.State()).To(Equal(plumbing.RouterConnected))
+
+		ok, _ = breaker.Allow()
+		Expect(ok).To(BeTrue())
+	})
+
+	It("reports state changes", func() {
+		breaker.Failure()
+		breaker.Success()
+
+		Expect(changes.get()).To(Equal([]plumbing.RouterState{
+			plumbing.RouterBackingOff,
+			plumbing.RouterConnected,
+		}))
+	})
+})
+
+type spyStateChanges struct {
+	mu     sync.Mutex
+	states []plumbing.RouterState
+}
+
+func (s *spyStateChanges) record(from, to plumbing.RouterState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = append(s.states, to)
+}
+
+func (s *spyStateChanges) get() []plumbing.RouterState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]plumbing.RouterState(nil), s.states...)
+}
@@ -0,0 +1,266 @@
+package plumbing
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/loggregator/metricemitter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	// minSizeBucketBits and maxSizeBucketBits are the powers of two of the
+	// smallest (64B) and largest (64MB) bucket bounds.
+	minSizeBucketBits = 6
+	maxSizeBucketBits = 26
+
+	// numSizeBuckets includes a final bucket for sizes above the largest
+	// bound.
+	numSizeBuckets = maxSizeBucketBits - minSizeBucketBits + 2
+)
+
+// SizeBucketBounds returns the upper bound in bytes of each bucket of a
+// SizeHistogram, except the last bucket which has no upper bound.
+func SizeBucketBounds() []float64 {
+	bounds := make([]float64, 0, numSizeBuckets-1)
+	for b := minSizeBucketBits; b <= maxSizeBucketBits; b++ {
+		bounds = append(bounds, float64(uint64(1)<<uint(b)))
+	}
+
+	return bounds
+}
+
+// SizeHistogram counts sizes in fixed exponential buckets from 64B to 64MB.
+// It is safe to use from several go-routines without locking.
+//
+// Note: Observe is on a very "hot" path.
+// Care should be taken while altering any algorithms, and performance
+// must be considered.
+type SizeHistogram struct {
+	// counts and total must be accessed via atomics
+	counts [numSizeBuckets]uint64
+	total  uint64
+}
+
+// NewSizeHistogram creates a new SizeHistogram.
+func NewSizeHistogram() *SizeHistogram {
+	return &SizeHistogram{}
+}
+
+// Observe adds the given size (in bytes) to the histogram.
+func (h *SizeHistogram) Observe(size int) {
+	atomic.AddUint64(&h.counts[sizeBucket(size)], 1)
+	atomic.AddUint64(&h.total, uint64(size))
+}
+
+// Snapshot returns the counts observed since the histogram was created.
+func (h *SizeHistogram) Snapshot() SizeSnapshot {
+	var s SizeSnapshot
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	s.Total = atomic.LoadUint64(&h.total)
+
+	return s
+}
+
+// Start invokes the given callback with the sizes observed over each
+// interval until the returned stop func is called.
+func (h *SizeHistogram) Start(interval time.Duration, f func(SizeSnapshot)) (stop func()) {
+	done := make(chan struct{})
+	prev := h.Snapshot()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				current := h.Snapshot()
+				f(current.Sub(prev))
+				prev = current
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// EmitMetrics emits the 50th, 95th and 99th percentile and the count of each
+// bucket over each interval as gauges prefixed with the given name. Bucket
+// counts are tagged with the upper bound of the bucket as le. Emitting stops
+// when the returned stop func is called.
+func (h *SizeHistogram) EmitMetrics(
+	m MetricClient,
+	name string,
+	interval time.Duration,
+	opts ...metricemitter.MetricOption,
+) (stop func()) {
+	percentiles := map[float64]*metricemitter.Gauge{
+		50: m.NewGauge(name+"_p50", "bytes", opts...),
+		95: m.NewGauge(name+"_p95", "bytes", opts...),
+		99: m.NewGauge(name+"_p99", "bytes", opts...),
+	}
+
+	var buckets [numSizeBuckets]*metricemitter.Gauge
+	bounds := SizeBucketBounds()
+	for i := range buckets {
+		le := "+Inf"
+		if i < len(bounds) {
+			le = fmt.Sprintf("%.0f", bounds[i])
+		}
+
+		bucketOpts := append([]metricemitter.MetricOption{
+			metricemitter.WithTags(map[string]string{"le": le}),
+		}, opts...)
+		buckets[i] = m.NewGauge(name+"_bucket", "messages", bucketOpts...)
+	}
+
+	return h.Start(interval, func(s SizeSnapshot) {
+		for p, g := range percentiles {
+			g.Set(s.Percentile(p))
+		}
+		for i, g := range buckets {
+			g.Set(float64(s.Counts[i]))
+		}
+	})
+}
+
+// SizeSnapshot holds the bucket counts and the total of the sizes observed
+// by a SizeHistogram.
+type SizeSnapshot struct {
+	Counts [numSizeBuckets]uint64
+	Total  uint64
+}
+
+// Sub returns the counts observed since prev was taken.
+func (s SizeSnapshot) Sub(prev SizeSnapshot) SizeSnapshot {
+	var d SizeSnapshot
+	for i := range s.Counts {
+		d.Counts[i] = s.Counts[i] - prev.Counts[i]
+	}
+	d.Total = s.Total - prev.Total
+
+	return d
+}
+
+// Count returns the number of observed sizes.
+func (s SizeSnapshot) Count() uint64 {
+	var count uint64
+	for _, c := range s.Counts {
+		count += c
+	}
+
+	return count
+}
+
+// Buckets returns the cumulative count of observed sizes at or below each
+// bucket bound.
+func (s SizeSnapshot) Buckets() map[float64]uint64 {
+	buckets := make(map[float64]uint64, numSizeBuckets-1)
+
+	var cumulative uint64
+	for i, bound := range SizeBucketBounds() {
+		cumulative += s.Counts[i]
+		buckets[bound] = cumulative
+	}
+
+	return buckets
+}
+
+// Percentile returns the upper bound of the bucket that holds the given
+// percentile (0-100). Sizes above the largest bound are reported as the
+// largest bound. It returns 0 if no sizes were observed.
+func (s SizeSnapshot) Percentile(p float64) float64 {
+	count := s.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := uint64(p / 100 * float64(count))
+	if rank == 0 {
+		rank = 1
+	}
+
+	bounds := SizeBucketBounds()
+	var cumulative uint64
+	for i, c := range s.Counts {
+		cumulative += c
+		if cumulative >= rank && i < len(bounds) {
+			return bounds[i]
+		}
+	}
+
+	return bounds[len(bounds)-1]
+}
+
+func sizeBucket(size int) int {
+	if size <= 1<<minSizeBucketBits {
+		return 0
+	}
+
+	i := bits.Len64(uint64(size-1)) - minSizeBucketBits
+	if i >= numSizeBuckets {
+		return numSizeBuckets - 1
+	}
+
+	return i
+}
+
+// SizeStatsHandler implements google.golang.org/grpc/stats.Handler and
+// tracks the sizes of the messages received and sent over gRPC. It can be
+// used by both clients and servers.
+type SizeStatsHandler struct {
+	in  *SizeHistogram
+	out *SizeHistogram
+}
+
+// NewSizeStatsHandler creates a new SizeStatsHandler.
+func NewSizeStatsHandler() *SizeStatsHandler {
+	return &SizeStatsHandler{
+		in:  NewSizeHistogram(),
+		out: NewSizeHistogram(),
+	}
+}
+
+// In returns the histogram of received message sizes.
+func (h *SizeStatsHandler) In() *SizeHistogram {
+	return h.in
+}
+
+// Out returns the histogram of sent message sizes.
+func (h *SizeStatsHandler) Out() *SizeHistogram {
+	return h.out
+}
+
+// TagRPC implements stats.Handler.
+func (h *SizeStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC implements stats.Handler.
+func (h *SizeStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.InPayload:
+		h.in.Observe(p.Length)
+	case *stats.OutPayload:
+		h.out.Observe(p.Length)
+	}
+}
+
+// TagConn implements stats.Handler.
+func (h *SizeStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements stats.Handler.
+func (h *SizeStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,124 @@
+package plumbing_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SizeHistogram", func() {
+	var h *plumbing.SizeHistogram
+
+	BeforeEach(func() {
+		h = plumbing.NewSizeHistogram()
+	})
+
+	It("counts sizes in exponential buckets", func() {
+		h.Observe(10)
+		h.Observe(64)
+		h.Observe(65)
+		h.Observe(128)
+		h.Observe(100 * 1024 * 1024)
+
+		s := h.Snapshot()
+		Expect(s.Count()).To(Equal(uint64(5)))
+		Expect(s.Total).To(Equal(uint64(10 + 64 + 65 + 128 + 100*1024*1024)))
+
+		buckets := s.Buckets()
+		Expect(buckets[64]).To(Equal(uint64(2)))
+		Expect(buckets[128]).To(Equal(uint64(4)))
+		Expect(buckets[64*1024*1024]).To(Equal(uint64(4)))
+	})
+
+	It("does not wrap after many observations", func() {
+		for i := 0; i < 70000; i++ {
+			h.Observe(100)
+		}
+
+		Expect(h.Snapshot().Count()).To(Equal(uint64(70000)))
+	})
+
+	It("reports percentiles as bucket bounds", func() {
+		for i := 0; i < 98; i++ {
+			h.Observe(100)
+		}
+		h.Observe(5000)
+		h.Observe(5 * 1024 * 1024)
+
+		s := h.Snapshot()
+		Expect(s.Percentile(50)).To(Equal(128.0))
+		Expect(s.Percentile(99)).To(Equal(8192.0))
+		Expect(s.Percentile(100)).To(Equal(8.0 * 1024 * 1024))
+	})
+
+	It("reports 0 for percentiles when nothing was observed", func() {
+		Expect(h.Snapshot().Percentile(99)).To(Equal(0.0))
+	})
+
+	It("reports the sizes observed over each interval", func() {
+		snapshots := make(chan plumbing.SizeSnapshot, 100)
+		stop := h.Start(10*time.Millisecond, func(s plumbing.SizeSnapshot) {
+			snapshots <- s
+		})
+		defer stop()
+
+		h.Observe(100)
+
+		count := func(s plumbing.SizeSnapshot) uint64 {
+			return s.Count()
+		}
+		Eventually(snapshots).Should(Receive(WithTransform(count, Equal(uint64(1)))))
+
+		var s plumbing.SizeSnapshot
+		Eventually(snapshots).Should(Receive(&s))
+		Expect(s.Count()).To(BeZero())
+	})
+
+	It("stops reporting once stopped", func() {
+		snapshots := make(chan plumbing.SizeSnapshot, 100)
+		stop := h.Start(10*time.Millisecond, func(s plumbing.SizeSnapshot) {
+			snapshots <- s
+		})
+		Eventually(snapshots).Should(Receive())
+
+		stop()
+		stop()
+
+		Eventually(snapshots).ShouldNot(Receive())
+		Consistently(snapshots, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("emits percentiles and bucket counts as gauges", func() {
+		spyMetricClient := testhelper.NewMetricClient()
+		stop := h.EmitMetrics(spyMetricClient, "message_size", 10*time.Millisecond)
+		defer stop()
+
+		h.Observe(100)
+
+		Eventually(func() float64 {
+			return spyMetricClient.GetValue("message_size_p99")
+		}).Should(Equal(128.0))
+		Expect(spyMetricClient.GetEnvelopes("message_size_bucket")).To(HaveLen(len(plumbing.SizeBucketBounds()) + 1))
+	})
+})
+
+var _ = Describe("SizeStatsHandler", func() {
+	It("tracks the sizes of received and sent messages", func() {
+		h := plumbing.NewSizeStatsHandler()
+
+		h.HandleRPC(context.Background(), &stats.InPayload{Length: 100})
+		h.HandleRPC(context.Background(), &stats.OutPayload{Length: 1000})
+		h.HandleRPC(context.Background(), &stats.OutPayload{Length: 2000})
+
+		Expect(h.In().Snapshot().Count()).To(Equal(uint64(1)))
+		Expect(h.Out().Snapshot().Count()).To(Equal(uint64(2)))
+		Expect(h.Out().Snapshot().Total).To(Equal(uint64(3000)))
+	})
+})
@@ -2,11 +2,6 @@ package plumbing
 
 import (
 	"crypto/tls"
-	"crypto/x509"
-	"errors"
-	"fmt"
-	"io/ioutil"
-	"log"
 
 	"google.golang.org/grpc/credentials"
 )
@@ -27,72 +22,66 @@ func NewTLSConfig() *tls.Config {
 
 // NewServerTLSConfig creates a new tls.Config that is intended to be used
 // with a non-mutual auth server. The config will be loaded with the provided
-// cert and key.
+// cert and key. The cert and key are reloaded when the files change.
 func NewServerTLSConfig(certFile, keyFile string) (*tls.Config, error) {
-	tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	r, err := newTLSReloader(certFile, keyFile, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to load keypair: %s", err)
+		return nil, err
 	}
 
 	tlsConfig := NewTLSConfig()
 
-	tlsConfig.Certificates = []tls.Certificate{tlsCert}
+	tlsConfig.Certificates = []tls.Certificate{*r.material().cert}
+	tlsConfig.GetConfigForClient = r.configForClient(tlsConfig)
 
 	return tlsConfig, nil
 }
 
-var cipherMap = map[string]uint16{
-	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-}
-
 // ConfigOption is used when configuring a new tls.Config.
-type ConfigOption func(*tls.Config)
-
-// WithCipherSuites is used to override the default cipher suites.
-func WithCipherSuites(ciphers []string) ConfigOption {
-	return func(c *tls.Config) {
-		var configuredCiphers []uint16
-		for _, c := range ciphers {
-			cipher, ok := cipherMap[c]
-			if !ok {
-				continue
-			}
-			configuredCiphers = append(configuredCiphers, cipher)
-		}
-		c.CipherSuites = configuredCiphers
-		if len(c.CipherSuites) == 0 {
-			log.Panic("no valid ciphers provided for TLS configuration")
-		}
-	}
-}
+type ConfigOption func(*tls.Config) error
 
 // NewClientMutualTLSConfig returns a tls.Config with certs loaded from files and
-// the ServerName set.
+// the ServerName set. The client certificate is reloaded when the files
+// change. The RootCAs are fixed when the config is created, use
+// NewClientCredentials for gRPC clients that should pick up a new CA.
 func NewClientMutualTLSConfig(
 	certFile string,
 	keyFile string,
 	caCertFile string,
 	serverName string,
+	opts ...ConfigOption,
 ) (*tls.Config, error) {
-	return newMutualTLSConfig(
+	tlsConfig, _, err := newMutualTLSConfig(
 		certFile,
 		keyFile,
 		caCertFile,
 		serverName,
 		true,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		if err := opt(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
 }
 
 // NewServerMutualTLSConfig returns a tls.Config with certs loaded from files.
-// The returned tls.Config has configured list of cipher suites.
+// The returned tls.Config has configured list of cipher suites. The
+// certificate and the CA used to verify clients are reloaded when the files
+// change.
 func NewServerMutualTLSConfig(
 	certFile string,
 	keyFile string,
 	caCertFile string,
 	opts ...ConfigOption,
 ) (*tls.Config, error) {
-	tlsConfig, err := newMutualTLSConfig(
+	tlsConfig, _, err := newMutualTLSConfig(
 		certFile,
 		keyFile,
 		caCertFile,
@@ -105,30 +94,42 @@ func NewServerMutualTLSConfig(
 
 	tlsConfig.CipherSuites = defaultServerCipherSuites
 	for _, opt := range opts {
-		opt(tlsConfig)
+		if err := opt(tlsConfig); err != nil {
+			return nil, err
+		}
 	}
 
 	return tlsConfig, nil
 }
 
-// NewClientCredentials returns gRPC credentials for dialing.
+// NewClientCredentials returns gRPC credentials for dialing. The client
+// certificate and the CA used to verify servers are reloaded when the files
+// change.
 func NewClientCredentials(
 	certFile string,
 	keyFile string,
 	caCertFile string,
 	serverName string,
+	opts ...ConfigOption,
 ) (credentials.TransportCredentials, error) {
-	tlsConfig, err := NewClientMutualTLSConfig(
+	tlsConfig, r, err := newMutualTLSConfig(
 		certFile,
 		keyFile,
 		caCertFile,
 		serverName,
+		true,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return credentials.NewTLS(tlsConfig), nil
+	for _, opt := range opts {
+		if err := opt(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return newReloadingCredentials(tlsConfig, r), nil
 }
 
 // NewServerCredentials returns gRPC credentials for a server.
@@ -148,65 +149,43 @@ func NewServerCredentials(
 		return nil, err
 	}
 
-	return credentials.NewTLS(tlsConfig), nil
-}
-
-func setCA(tlsConfig *tls.Config, tlsCert tls.Certificate, caCertFile string, isClient bool) error {
-	certBytes, err := ioutil.ReadFile(caCertFile)
-	if err != nil {
-		return fmt.Errorf("failed to read ca cert file: %s", err)
-	}
-
-	caCertPool := x509.NewCertPool()
-	if ok := caCertPool.AppendCertsFromPEM(certBytes); !ok {
-		return errors.New("unable to load ca cert file")
-	}
-	if isClient {
-		tlsConfig.RootCAs = caCertPool
-	} else {
-		tlsConfig.ClientCAs = caCertPool
-	}
-
-	verifier, err := x509.ParseCertificate(tlsCert.Certificate[0])
-	if err != nil {
-		return err
-	}
+	// gRPC adds h2 to the NextProtos of its own copy of the config. Add it
+	// here so the configs served for each client include it too.
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2")
 
-	verifyOptions := x509.VerifyOptions{
-		Roots: caCertPool,
-		KeyUsages: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageAny,
-		},
-	}
-	_, err = verifier.Verify(verifyOptions)
-
-	if err != nil {
-		return err
-	}
-	return nil
+	return credentials.NewTLS(tlsConfig), nil
 }
 
-func newMutualTLSConfig(certFile, keyFile, caCertFile, serverName string, isClient bool) (*tls.Config, error) {
-	tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+func newMutualTLSConfig(
+	certFile string,
+	keyFile string,
+	caCertFile string,
+	serverName string,
+	isClient bool,
+) (*tls.Config, *tlsReloader, error) {
+	r, err := newTLSReloader(certFile, keyFile, caCertFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load keypair: %s", err)
+		return nil, nil, err
 	}
+	m := r.material()
 
 	tlsConfig := NewTLSConfig()
 
-	tlsConfig.Certificates = []tls.Certificate{tlsCert}
+	tlsConfig.Certificates = []tls.Certificate{*m.cert}
 
 	if isClient {
 		tlsConfig.ServerName = serverName
+		tlsConfig.GetClientCertificate = r.getClientCertificate
+		if m.pool != nil {
+			tlsConfig.RootCAs = m.pool
+		}
 	} else {
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	}
-
-	if caCertFile != "" {
-		if err := setCA(tlsConfig, tlsCert, caCertFile, isClient); err != nil {
-			return nil, err
+		tlsConfig.GetConfigForClient = r.configForClient(tlsConfig)
+		if m.pool != nil {
+			tlsConfig.ClientCAs = m.pool
 		}
 	}
 
-	return tlsConfig, err
+	return tlsConfig, r, nil
 }
@@ -0,0 +1,140 @@
+package plumbing
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+var cipherMap = map[string]uint16{
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":          tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":        tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// tls13CipherSuites are the TLS 1.3 cipher suites. Go enables all of them
+// whenever TLS 1.3 is negotiated and does not allow them to be configured.
+// They are accepted in a cipher suite list so that a policy can name them.
+var tls13CipherSuites = map[string]bool{
+	"TLS_AES_128_GCM_SHA256":       true,
+	"TLS_AES_256_GCM_SHA384":       true,
+	"TLS_CHACHA20_POLY1305_SHA256": true,
+}
+
+var versionMap = map[string]uint16{
+	"TLS1.2": tls.VersionTLS12,
+	"TLS1.3": tls.VersionTLS13,
+}
+
+var curveMap = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// TLSPolicy describes the protocol versions, cipher suites and curves a
+// tls.Config accepts. Cipher suites use their IANA names, versions are one
+// of TLS1.2 or TLS1.3 and curves are one of X25519, P256, P384 or P521.
+// Empty fields keep the defaults.
+type TLSPolicy struct {
+	CipherSuites     []string
+	MinVersion       string
+	MaxVersion       string
+	CurvePreferences []string
+}
+
+// Validate returns an error if the policy names an unknown cipher suite,
+// version or curve, if the minimum version is above the maximum or if only
+// TLS 1.3 cipher suites are named while TLS 1.2 is allowed.
+func (p TLSPolicy) Validate() error {
+	return WithTLSPolicy(p)(NewTLSConfig())
+}
+
+// WithTLSPolicy is used to apply a TLSPolicy to a tls.Config.
+func WithTLSPolicy(p TLSPolicy) ConfigOption {
+	return func(c *tls.Config) error {
+		if p.MinVersion != "" {
+			v, ok := versionMap[p.MinVersion]
+			if !ok {
+				return fmt.Errorf("unknown TLS version: %s", p.MinVersion)
+			}
+			c.MinVersion = v
+		}
+
+		if p.MaxVersion != "" {
+			v, ok := versionMap[p.MaxVersion]
+			if !ok {
+				return fmt.Errorf("unknown TLS version: %s", p.MaxVersion)
+			}
+			c.MaxVersion = v
+		}
+
+		if c.MaxVersion != 0 && c.MinVersion > c.MaxVersion {
+			return fmt.Errorf(
+				"minimum TLS version %s is above maximum TLS version %s",
+				p.MinVersion,
+				p.MaxVersion,
+			)
+		}
+
+		// The cipher suites are applied after the versions since whether
+		// TLS 1.2 suites are required depends on the minimum version.
+		if len(p.CipherSuites) > 0 {
+			if err := WithCipherSuites(p.CipherSuites)(c); err != nil {
+				return err
+			}
+		}
+
+		if len(p.CurvePreferences) > 0 {
+			var curves []tls.CurveID
+			for _, name := range p.CurvePreferences {
+				curve, ok := curveMap[name]
+				if !ok {
+					return fmt.Errorf("unknown curve: %s", name)
+				}
+				curves = append(curves, curve)
+			}
+			c.CurvePreferences = curves
+		}
+
+		return nil
+	}
+}
+
+// WithCipherSuites is used to override the default cipher suites. It returns
+// an error if a cipher suite is unknown or none are given. Unless the
+// minimum version is TLS 1.3 at least one TLS 1.2 cipher suite is required
+// since TLS 1.3 cipher suites can not be configured.
+func WithCipherSuites(ciphers []string) ConfigOption {
+	return func(c *tls.Config) error {
+		if len(ciphers) == 0 {
+			return errors.New("no valid ciphers provided for TLS configuration")
+		}
+
+		var configuredCiphers []uint16
+		for _, name := range ciphers {
+			if tls13CipherSuites[name] {
+				continue
+			}
+
+			cipher, ok := cipherMap[name]
+			if !ok {
+				return fmt.Errorf("unknown cipher suite: %s", name)
+			}
+			configuredCiphers = append(configuredCiphers, cipher)
+		}
+
+		if len(configuredCiphers) == 0 && c.MinVersion < tls.VersionTLS13 {
+			return errors.New("no TLS 1.2 cipher suites provided while the minimum TLS version is below TLS1.3")
+		}
+		c.CipherSuites = configuredCiphers
+
+		return nil
+	}
+}
@@ -0,0 +1,253 @@
+package plumbing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+)
+
+// reloaders holds every tlsReloader created by the TLS helpers. Several
+// reloaders may share a certificate file, for example when server and
+// client credentials are built from the same files.
+var reloaders = struct {
+	sync.Mutex
+	m map[*tlsReloader]struct{}
+}{m: make(map[*tlsReloader]struct{})}
+
+// CertExpiries returns the expiry time of every certificate loaded by the TLS
+// helpers in this package, keyed by the path of the certificate file. Each
+// certificate is reloaded from disk first if its files have changed. When a
+// file is loaded more than once the earliest expiry is reported so that a
+// copy that failed to reload is not hidden.
+func CertExpiries() map[string]time.Time {
+	reloaders.Lock()
+	rs := make([]*tlsReloader, 0, len(reloaders.m))
+	for r := range reloaders.m {
+		rs = append(rs, r)
+	}
+	reloaders.Unlock()
+
+	expiries := make(map[string]time.Time, len(rs))
+	for _, r := range rs {
+		r.maybeReload()
+		expiry := r.material().expiry
+		if e, ok := expiries[r.certFile]; ok && e.Before(expiry) {
+			continue
+		}
+		expiries[r.certFile] = expiry
+	}
+
+	return expiries
+}
+
+// tlsMaterial is a certificate and CA pool that were loaded together.
+type tlsMaterial struct {
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	expiry time.Time
+}
+
+// tlsReloader holds the certificate, key and CA loaded from a set of files.
+// Before handing out any material it checks whether the files have changed
+// and reloads them if so. A reload that fails is logged and the last good
+// material is kept.
+type tlsReloader struct {
+	certFile   string
+	keyFile    string
+	caCertFile string
+
+	mu    sync.Mutex
+	stamp string
+
+	current atomic.Value
+}
+
+func newTLSReloader(certFile, keyFile, caCertFile string) (*tlsReloader, error) {
+	r := &tlsReloader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		caCertFile: caCertFile,
+	}
+
+	r.stamp = r.fileStamp()
+	m, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(m)
+
+	reloaders.Lock()
+	reloaders.m[r] = struct{}{}
+	reloaders.Unlock()
+
+	return r, nil
+}
+
+func (r *tlsReloader) material() *tlsMaterial {
+	return r.current.Load().(*tlsMaterial)
+}
+
+// maybeReload reloads the material if any of the files has been modified
+// since it was last loaded.
+func (r *tlsReloader) maybeReload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp := r.fileStamp()
+	if stamp == r.stamp {
+		return
+	}
+	r.stamp = stamp
+
+	m, err := r.load()
+	if err != nil {
+		log.Printf("failed to reload TLS certificate %s, keeping the previous one: %s", r.certFile, err)
+		return
+	}
+
+	r.current.Store(m)
+	log.Printf("reloaded TLS certificate %s, expires %s", r.certFile, m.expiry)
+}
+
+// fileStamp summarizes the modification time and size of each file.
+func (r *tlsReloader) fileStamp() string {
+	var stamp string
+	for _, f := range []string{r.certFile, r.keyFile, r.caCertFile} {
+		if f == "" {
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			stamp += "-;"
+			continue
+		}
+		stamp += fmt.Sprintf("%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+
+	return stamp
+}
+
+func (r *tlsReloader) load() (*tlsMaterial, error) {
+	tlsCert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keypair: %s", err)
+	}
+
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	m := &tlsMaterial{
+		cert:   &tlsCert,
+		expiry: leaf.NotAfter,
+	}
+
+	if r.caCertFile == "" {
+		return m, nil
+	}
+
+	certBytes, err := ioutil.ReadFile(r.caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca cert file: %s", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if ok := caCertPool.AppendCertsFromPEM(certBytes); !ok {
+		return nil, errors.New("unable to load ca cert file")
+	}
+
+	verifyOptions := x509.VerifyOptions{
+		Roots: caCertPool,
+		KeyUsages: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageAny,
+		},
+	}
+	if _, err := leaf.Verify(verifyOptions); err != nil {
+		return nil, err
+	}
+	m.pool = caCertPool
+
+	return m, nil
+}
+
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	return r.material().cert, nil
+}
+
+// configForClient returns a tls.Config.GetConfigForClient func that serves
+// the current certificate and CA pool with the rest of the settings taken
+// from base.
+func (r *tlsReloader) configForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.maybeReload()
+		m := r.material()
+
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*m.cert}
+		if m.pool != nil {
+			c.ClientCAs = m.pool
+		}
+
+		return c, nil
+	}
+}
+
+// reloadingCredentials are client transport credentials that verify the
+// server against the current CA pool of the reloader on every handshake.
+type reloadingCredentials struct {
+	credentials.TransportCredentials
+
+	config   *tls.Config
+	reloader *tlsReloader
+}
+
+func newReloadingCredentials(c *tls.Config, r *tlsReloader) credentials.TransportCredentials {
+	return &reloadingCredentials{
+		TransportCredentials: credentials.NewTLS(c),
+		config:               c,
+		reloader:             r,
+	}
+}
+
+func (c *reloadingCredentials) ClientHandshake(
+	ctx context.Context,
+	authority string,
+	rawConn net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	c.reloader.maybeReload()
+
+	conf := c.config.Clone()
+	if pool := c.reloader.material().pool; pool != nil {
+		conf.RootCAs = pool
+	}
+
+	return credentials.NewTLS(conf).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		config:               c.config.Clone(),
+		reloader:             c.reloader,
+	}
+}
+
+func (c *reloadingCredentials) OverrideServerName(serverNameOverride string) error {
+	c.config.ServerName = serverNameOverride
+	return c.TransportCredentials.OverrideServerName(serverNameOverride)
+}
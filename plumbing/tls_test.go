@@ -2,6 +2,7 @@ package plumbing_test
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"code.cloudfoundry.org/loggregator/testservers"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 
 	"code.cloudfoundry.org/loggregator/plumbing"
@@ -142,8 +144,8 @@ var _ = Describe("TLS", func() {
 			))
 		})
 
-		It("ignores garbage CIPHERs in favor of valid ones", func() {
-			conf, err := plumbing.NewServerMutualTLSConfig(
+		It("returns an error for unknown CIPHERs", func() {
+			_, err := plumbing.NewServerMutualTLSConfig(
 				testservers.Cert("doppler.crt"),
 				testservers.Cert("doppler.key"),
 				testservers.Cert("loggregator-ca.crt"),
@@ -152,22 +154,17 @@ var _ = Describe("TLS", func() {
 					"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
 				}),
 			)
-			Expect(err).NotTo(HaveOccurred())
-
-			Expect(conf.CipherSuites).To(ConsistOf(
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			))
+			Expect(err).To(MatchError("unknown cipher suite: GARBAGE"))
 		})
 
-		It("panics if no ciphers are provided", func() {
-			Expect(func() {
-				plumbing.NewServerMutualTLSConfig(
-					testservers.Cert("doppler.crt"),
-					testservers.Cert("doppler.key"),
-					testservers.Cert("loggregator-ca.crt"),
-					plumbing.WithCipherSuites([]string{}),
-				)
-			}).Should(Panic())
+		It("returns an error if no ciphers are provided", func() {
+			_, err := plumbing.NewServerMutualTLSConfig(
+				testservers.Cert("doppler.crt"),
+				testservers.Cert("doppler.key"),
+				testservers.Cert("loggregator-ca.crt"),
+				plumbing.WithCipherSuites([]string{}),
+			)
+			Expect(err).To(MatchError("no valid ciphers provided for TLS configuration"))
 		})
 
 		It("maintains the order of the ciphers provided", func() {
@@ -189,6 +186,99 @@ var _ = Describe("TLS", func() {
 		})
 	})
 
+	Context("WithTLSPolicy", func() {
+		It("applies the cipher suites, versions and curves", func() {
+			conf, err := plumbing.NewServerMutualTLSConfig(
+				testservers.Cert("doppler.crt"),
+				testservers.Cert("doppler.key"),
+				testservers.Cert("loggregator-ca.crt"),
+				plumbing.WithTLSPolicy(plumbing.TLSPolicy{
+					CipherSuites: []string{
+						"TLS_AES_128_GCM_SHA256",
+						"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+						"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+					},
+					MinVersion:       "TLS1.2",
+					MaxVersion:       "TLS1.3",
+					CurvePreferences: []string{"X25519", "P256"},
+				}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(conf.CipherSuites).To(Equal([]uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			}))
+			Expect(conf.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+			Expect(conf.MaxVersion).To(Equal(uint16(tls.VersionTLS13)))
+			Expect(conf.CurvePreferences).To(Equal([]tls.CurveID{tls.X25519, tls.CurveP256}))
+		})
+
+		It("accepts only TLS 1.3 cipher suites when the minimum version is TLS1.3", func() {
+			conf, err := plumbing.NewServerMutualTLSConfig(
+				testservers.Cert("doppler.crt"),
+				testservers.Cert("doppler.key"),
+				testservers.Cert("loggregator-ca.crt"),
+				plumbing.WithTLSPolicy(plumbing.TLSPolicy{
+					CipherSuites: []string{"TLS_AES_256_GCM_SHA384"},
+					MinVersion:   "TLS1.3",
+				}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(conf.CipherSuites).To(BeEmpty())
+			Expect(conf.MinVersion).To(Equal(uint16(tls.VersionTLS13)))
+		})
+
+		It("keeps the defaults for empty fields", func() {
+			conf, err := plumbing.NewServerMutualTLSConfig(
+				testservers.Cert("doppler.crt"),
+				testservers.Cert("doppler.key"),
+				testservers.Cert("loggregator-ca.crt"),
+				plumbing.WithTLSPolicy(plumbing.TLSPolicy{}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(conf.CipherSuites).To(HaveLen(2))
+			Expect(conf.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+			Expect(conf.MaxVersion).To(BeZero())
+			Expect(conf.CurvePreferences).To(BeEmpty())
+		})
+
+		DescribeTable("validation errors",
+			func(p plumbing.TLSPolicy, msg string) {
+				Expect(p.Validate()).To(MatchError(msg))
+			},
+			Entry("unknown cipher suite",
+				plumbing.TLSPolicy{CipherSuites: []string{"GARBAGE"}},
+				"unknown cipher suite: GARBAGE",
+			),
+			Entry("only TLS 1.3 cipher suites with TLS1.2 allowed",
+				plumbing.TLSPolicy{
+					CipherSuites: []string{"TLS_AES_128_GCM_SHA256", "TLS_AES_256_GCM_SHA384"},
+					MinVersion:   "TLS1.2",
+				},
+				"no TLS 1.2 cipher suites provided while the minimum TLS version is below TLS1.3",
+			),
+			Entry("unknown minimum version",
+				plumbing.TLSPolicy{MinVersion: "TLS1.0"},
+				"unknown TLS version: TLS1.0",
+			),
+			Entry("unknown maximum version",
+				plumbing.TLSPolicy{MaxVersion: "SSL3"},
+				"unknown TLS version: SSL3",
+			),
+			Entry("minimum above maximum",
+				plumbing.TLSPolicy{MinVersion: "TLS1.3", MaxVersion: "TLS1.2"},
+				"minimum TLS version TLS1.3 is above maximum TLS version TLS1.2",
+			),
+			Entry("unknown curve",
+				plumbing.TLSPolicy{CurvePreferences: []string{"P224"}},
+				"unknown curve: P224",
+			),
+		)
+	})
+
 	Context("NewTLSConfig", func() {
 		It("returns basic TLS config", func() {
 			tlsConf := plumbing.NewTLSConfig()
@@ -221,6 +311,125 @@ var _ = Describe("TLS", func() {
 		})
 	})
 
+	Context("when the certificate files change", func() {
+		var (
+			certFile string
+			keyFile  string
+		)
+
+		BeforeEach(func() {
+			certFile = testservers.Cert("doppler.crt")
+			keyFile = testservers.Cert("doppler.key")
+		})
+
+		It("reloads the client certificate", func() {
+			conf, err := plumbing.NewClientMutualTLSConfig(
+				certFile,
+				keyFile,
+				testservers.Cert("loggregator-ca.crt"),
+				"test-server-name",
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			copyFile(testservers.Cert("metron.crt"), certFile)
+			copyFile(testservers.Cert("metron.key"), keyFile)
+
+			cert, err := conf.GetClientCertificate(&tls.CertificateRequestInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert.Certificate).To(Equal(loadCert("metron").Certificate))
+		})
+
+		It("serves the new certificate to clients", func() {
+			conf, err := plumbing.NewServerMutualTLSConfig(
+				certFile,
+				keyFile,
+				testservers.Cert("loggregator-ca.crt"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			copyFile(testservers.Cert("metron.crt"), certFile)
+			copyFile(testservers.Cert("metron.key"), keyFile)
+
+			clientConf, err := conf.GetConfigForClient(&tls.ClientHelloInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(clientConf.Certificates).To(HaveLen(1))
+			Expect(clientConf.Certificates[0].Certificate).To(Equal(loadCert("metron").Certificate))
+			Expect(clientConf.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+			Expect(string(clientConf.ClientCAs.Subjects()[0])).To(ContainSubstring("loggregatorCA"))
+		})
+
+		It("keeps the last good certificate when the new one is invalid", func() {
+			conf, err := plumbing.NewClientMutualTLSConfig(
+				certFile,
+				keyFile,
+				testservers.Cert("loggregator-ca.crt"),
+				"test-server-name",
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ioutil.WriteFile(certFile, []byte("invalid"), 0600)).To(Succeed())
+
+			cert, err := conf.GetClientCertificate(&tls.CertificateRequestInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert.Certificate).To(Equal(loadCert("doppler").Certificate))
+		})
+
+		It("reports the expiry of the current certificate", func() {
+			_, err := plumbing.NewClientMutualTLSConfig(
+				certFile,
+				keyFile,
+				testservers.Cert("loggregator-ca.crt"),
+				"test-server-name",
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			leaf, err := x509.ParseCertificate(loadCert("doppler").Certificate[0])
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(plumbing.CertExpiries()).To(HaveKeyWithValue(certFile, leaf.NotAfter))
+		})
+
+		It("reports every config built from the same files", func() {
+			staleCA := testservers.Cert("loggregator-ca.crt")
+			stale, err := plumbing.NewClientMutualTLSConfig(
+				certFile,
+				keyFile,
+				staleCA,
+				"test-server-name",
+			)
+			Expect(err).ToNot(HaveOccurred())
+			current, err := plumbing.NewClientMutualTLSConfig(
+				certFile,
+				keyFile,
+				testservers.Cert("loggregator-ca.crt"),
+				"test-server-name",
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ioutil.WriteFile(staleCA, []byte("invalid"), 0600)).To(Succeed())
+			copyFile(testservers.Cert("metron.crt"), certFile)
+			copyFile(testservers.Cert("metron.key"), keyFile)
+
+			cert, err := stale.GetClientCertificate(&tls.CertificateRequestInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert.Certificate).To(Equal(loadCert("doppler").Certificate))
+			cert, err = current.GetClientCertificate(&tls.CertificateRequestInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert.Certificate).To(Equal(loadCert("metron").Certificate))
+
+			dopplerLeaf, err := x509.ParseCertificate(loadCert("doppler").Certificate[0])
+			Expect(err).ToNot(HaveOccurred())
+			metronLeaf, err := x509.ParseCertificate(loadCert("metron").Certificate[0])
+			Expect(err).ToNot(HaveOccurred())
+			earliest := dopplerLeaf.NotAfter
+			if metronLeaf.NotAfter.Before(earliest) {
+				earliest = metronLeaf.NotAfter
+			}
+
+			Expect(plumbing.CertExpiries()).To(HaveKeyWithValue(certFile, earliest))
+		})
+	})
+
 	Context("NewClientCredentials", func() {
 		It("returns transport credentials", func() {
 			creds, err := plumbing.NewClientCredentials(
@@ -278,6 +487,21 @@ func writeFile(data string) string {
 	return f.Name()
 }
 
+func copyFile(src, dst string) {
+	data, err := ioutil.ReadFile(src)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(dst, data, 0600)).To(Succeed())
+}
+
+func loadCert(name string) tls.Certificate {
+	cert, err := tls.LoadX509KeyPair(
+		testservers.Cert(name+".crt"),
+		testservers.Cert(name+".key"),
+	)
+	Expect(err).ToNot(HaveOccurred())
+	return cert
+}
+
 func wrongCA() string {
 	someCA := `
 -----BEGIN CERTIFICATE-----
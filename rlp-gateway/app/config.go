@@ -41,7 +41,8 @@ type Config struct {
 	LogsProviderCommonName     string `env:"LOGS_PROVIDER_COMMON_NAME, report"`
 	SkipCertVerify             bool   `env:"SKIP_CERT_VERIFY, report"`
 
-	PProfPort uint32 `env:"PPROF_PORT"`
+	PProfPort  uint32 `env:"PPROF_PORT"`
+	HealthAddr string `env:"HEALTH_ADDR, report"`
 
 	LogAccessAuthorization LogAccessAuthorization
 	LogAdminAuthorization  LogAdminAuthorization
@@ -59,6 +60,7 @@ func LoadConfig() Config {
 			GatewayAddr: "127.0.0.1:8088",
 		},
 		LogsProviderCommonName: "reverselogproxy",
+		HealthAddr:             "localhost:14826",
 		StreamTimeout:          14 * time.Minute,
 	}
 
@@ -9,12 +9,14 @@ import (
 	"net/http"
 	"time"
 
+	"code.cloudfoundry.org/loggregator/healthendpoint"
 	"code.cloudfoundry.org/loggregator/plumbing"
 	"code.cloudfoundry.org/loggregator/rlp-gateway/internal/auth"
 	"code.cloudfoundry.org/loggregator/rlp-gateway/internal/ingress"
 	"code.cloudfoundry.org/loggregator/rlp-gateway/internal/metrics"
 	"code.cloudfoundry.org/loggregator/rlp-gateway/internal/web"
 	"github.com/gorilla/handlers"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Gateway provides a high level for running the RLP gateway
@@ -25,6 +27,7 @@ type Gateway struct {
 	log           *log.Logger
 	metrics       *metrics.Metrics
 	httpLogOutput io.Writer
+	checks        *healthendpoint.Checks
 }
 
 // NewGateway creates a new Gateway
@@ -78,6 +81,8 @@ func (g *Gateway) Start(blocking bool) {
 	)
 
 	lc := ingress.NewLogClient(creds, g.cfg.LogsProviderAddr)
+	g.startHealthEndpoint(lc)
+
 	stack := handlers.RecoveryHandler(handlers.PrintRecoveryStack(true))(
 		handlers.LoggingHandler(
 			g.httpLogOutput,
@@ -110,9 +115,28 @@ func (g *Gateway) Start(blocking bool) {
 
 // Stop closes the server connection
 func (g *Gateway) Stop() {
+	if g.checks != nil {
+		g.checks.Shutdown()
+	}
 	_ = g.server.Close()
 }
 
+// startHealthEndpoint serves the liveness and readiness checks when a health
+// address is configured.
+func (g *Gateway) startHealthEndpoint(lc *ingress.LogClient) {
+	if g.cfg.HealthAddr == "" {
+		return
+	}
+
+	g.checks = healthendpoint.NewChecks()
+	g.checks.AddReadiness(healthendpoint.NewCheck("logs_provider", lc.Ready))
+	healthendpoint.StartServer(
+		g.cfg.HealthAddr,
+		prometheus.NewRegistry(),
+		healthendpoint.WithChecks(g.checks),
+	)
+}
+
 // Addr returns the address the gateway HTTP listener is bound to
 func (g *Gateway) Addr() string {
 	if g.listener == nil {
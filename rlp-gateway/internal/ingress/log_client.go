@@ -2,18 +2,47 @@ package ingress
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	throughputlb "code.cloudfoundry.org/grpc-throughputlb"
 	"code.cloudfoundry.org/loggregator/rlp-gateway/internal/web"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// identityMetadataKey is the gRPC metadata key the logs provider reads the
+// forwarded client identity from.
+const identityMetadataKey = "loggregator-client-identity"
+
+// fieldsMetadataKey is the gRPC metadata key the logs provider reads the
+// field mask of a stream from.
+const fieldsMetadataKey = "loggregator-fields"
+
+// sequenceMetadataKey is the gRPC metadata key that asks the logs provider
+// to end every batch with the stream position.
+const sequenceMetadataKey = "loggregator-stream-sequence"
+
+// admittedMetadataKey is the gRPC header the logs provider sends once it
+// admitted a stream.
+const admittedMetadataKey = "loggregator-admitted"
+
+// retryAfterMetadataKey is the trailing gRPC metadata key that holds the
+// seconds to wait before retrying when the logs provider rejected a stream
+// because it is overloaded.
+const retryAfterMetadataKey = "loggregator-retry-after"
+
 // LogClient handles dialing and opening streams to the logs provider.
 type LogClient struct {
-	c loggregator_v2.EgressClient
+	conn *grpc.ClientConn
+	c    loggregator_v2.EgressClient
 }
 
 // NewClient dials the logs provider and returns a new log client.
@@ -28,16 +57,85 @@ func NewLogClient(creds credentials.TransportCredentials, logsProviderAddr strin
 	}
 	client := loggregator_v2.NewEgressClient(conn)
 	return &LogClient{
-		c: client,
+		conn: conn,
+		c:    client,
 	}
 }
 
-// Stream opens a new stream on the log client.
-func (c *LogClient) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) web.Receiver {
+// Stream opens a new stream on the log client. The identity of the client
+// the stream is opened for is passed on to the logs provider so that it can
+// apply its stream quotas. The field mask of the stream is passed on as
+// well. The stream asks for stream positions, which the read handler turns
+// into event IDs.
+//
+// Stream waits until the logs provider admitted the stream. If it rejected
+// the stream because it is overloaded a *web.UnavailableError is returned.
+func (c *LogClient) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (web.Receiver, error) {
+	if identity := web.ClientIdentity(ctx); identity != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, identityMetadataKey, identity)
+	}
+	if fields := web.Fields(ctx); fields != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, fieldsMetadataKey, fields)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, sequenceMetadataKey, "true")
+
 	receiver, err := c.c.BatchedReceiver(ctx, req)
 	if err != nil {
 		log.Printf("failed to open stream from logs provider: %s", err)
+		return nil, err
+	}
+
+	md, err := receiver.Header()
+	if err == nil && len(md[admittedMetadataKey]) > 0 {
+		return receiver.Recv, nil
+	}
+
+	// The stream ended without being admitted, or the logs provider does
+	// not send the admitted header. The first batch tells which.
+	batch, err := receiver.Recv()
+	if err != nil {
+		if status.Code(err) == codes.Unavailable {
+			return nil, &web.UnavailableError{
+				RetryAfter: retryAfter(receiver.Trailer()),
+			}
+		}
+
+		return func() (*loggregator_v2.EnvelopeBatch, error) {
+			return nil, err
+		}, nil
+	}
+
+	return func() (*loggregator_v2.EnvelopeBatch, error) {
+		if batch != nil {
+			b := batch
+			batch = nil
+			return b, nil
+		}
+
+		return receiver.Recv()
+	}, nil
+}
+
+func retryAfter(md metadata.MD) time.Duration {
+	if len(md[retryAfterMetadataKey]) == 0 {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(md[retryAfterMetadataKey][0])
+	if err != nil || seconds < 0 {
+		return 0
 	}
 
-	return receiver.Recv
+	return time.Duration(seconds) * time.Second
+}
+
+// Ready returns an error if the connection to the logs provider has failed
+// or has been closed.
+func (c *LogClient) Ready() error {
+	switch state := c.conn.GetState(); state {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return fmt.Errorf("logs provider connection is %s", state)
+	default:
+		return nil
+	}
 }
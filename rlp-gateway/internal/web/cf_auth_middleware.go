@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"regexp"
@@ -75,8 +76,23 @@ func (m CFAuthMiddlewareProvider) Middleware(h http.Handler) http.Handler {
 			}
 		}
 
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, r.WithContext(WithClientIdentity(r.Context(), c.ClientID)))
 	})
 
 	return router
 }
+
+type clientIdentityKey struct{}
+
+// WithClientIdentity returns a context that carries the identity of the
+// authenticated client.
+func WithClientIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, identity)
+}
+
+// ClientIdentity returns the identity of the authenticated client carried by
+// the context, or an empty string.
+func ClientIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(clientIdentityKey{}).(string)
+	return identity
+}
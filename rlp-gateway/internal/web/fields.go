@@ -0,0 +1,46 @@
+package web
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// BuildFields returns the field mask given with the fields query parameter.
+// It returns an empty mask if the parameter is missing. The mask is a comma
+// separated list of instance_id, tags and tags.<key>. The gateway always
+// sends preferred tags so deprecated_tags is rejected.
+func BuildFields(v url.Values) (string, error) {
+	var fields []string
+	for _, f := range v["fields"] {
+		fields = append(fields, strings.Split(f, ",")...)
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	for _, f := range fields {
+		switch {
+		case f == "instance_id", f == "tags":
+		case strings.HasPrefix(f, "tags.") && len(f) > len("tags."):
+		default:
+			return "", errInvalidFields
+		}
+	}
+
+	return strings.Join(fields, ","), nil
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context that carries the field mask of a stream.
+func WithFields(ctx context.Context, fields string) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// Fields returns the field mask carried by the context, or an empty string.
+func Fields(ctx context.Context) string {
+	fields, _ := ctx.Value(fieldsKey{}).(string)
+	return fields
+}
@@ -0,0 +1,38 @@
+package web_test
+
+import (
+	"net/url"
+
+	"code.cloudfoundry.org/loggregator/rlp-gateway/internal/web"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildFields", func() {
+	It("returns an empty mask without the fields parameter", func() {
+		fields, err := web.BuildFields(url.Values{"log": {}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(BeEmpty())
+	})
+
+	It("joins every fields parameter", func() {
+		fields, err := web.BuildFields(url.Values{
+			"fields": {"instance_id,tags.job", "tags.deployment"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal("instance_id,tags.job,tags.deployment"))
+	})
+
+	DescribeTable("rejects invalid fields", func(fields string) {
+		_, err := web.BuildFields(url.Values{"fields": {fields}})
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("unknown field", "payload"),
+		Entry("deprecated tags", "deprecated_tags"),
+		Entry("empty tag key", "tags."),
+		Entry("empty field", "tags,"),
+		Entry("empty parameter", ""),
+	)
+})
@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -14,7 +15,19 @@ type Receiver func() (*loggregator_v2.EnvelopeBatch, error)
 // LogsProvder defines the interface for opening streams to the
 // logs provider
 type LogsProvider interface {
-	Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) Receiver
+	Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (Receiver, error)
+}
+
+// UnavailableError is returned by a LogsProvider when the logs provider
+// rejected the stream because it is overloaded. RetryAfter is how long the
+// client should wait before it retries, or 0 if the logs provider did not
+// say.
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("logs provider is unavailable, retry after %s", e.RetryAfter)
 }
 
 // Handler defines a struct for servering http endpoints
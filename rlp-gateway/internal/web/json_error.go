@@ -12,8 +12,11 @@ var (
 	errMissingType                = newJSONError(http.StatusBadRequest, "missing_envelope_type", "query must provide at least one envelope type")
 	errCounterNamePresentButEmpty = newJSONError(http.StatusBadRequest, "missing_counter_name", "counter.name is invalid without value")
 	errGaugeNamePresentButEmpty   = newJSONError(http.StatusBadRequest, "missing_gauge_name", "gauge.name is invalid without value")
+	errInvalidFields              = newJSONError(http.StatusBadRequest, "invalid_fields", "fields must be instance_id, tags or tags.<key>")
 	errStreamingUnsupported       = newJSONError(http.StatusInternalServerError, "streaming_unsupported", "request does not support streaming")
 	errNotFound                   = newJSONError(http.StatusNotFound, "not_found", "resource not found")
+	errUnavailable                = newJSONError(http.StatusServiceUnavailable, "unavailable", "logs provider is overloaded, retry later")
+	errStreamFailed               = newJSONError(http.StatusBadGateway, "stream_failed", "unable to open stream to logs provider")
 )
 
 type jsonError struct {
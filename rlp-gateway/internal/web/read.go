@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
@@ -13,6 +14,16 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+const (
+	// streamDroppedName is the name of the counter the logs provider ends a
+	// batch with to report the stream position.
+	streamDroppedName = "rlp_stream_dropped"
+
+	// streamSequenceTag is the tag of the stream position counter that
+	// holds the sequence number of the batch.
+	streamSequenceTag = "sequence"
+)
+
 var marshaler = jsonpb.Marshaler{
 	EmitDefaults: true,
 }
@@ -21,9 +32,16 @@ var marshaler = jsonpb.Marshaler{
 // events. Logs are streamed from the logs provider and written to the client
 // connection. The format of the envelopes is as follows:
 //
+//     id: <SEQUENCE>-<DROPPED>
 //     data: <JSON ENVELOPE BATCH>
 //
+//     id: <SEQUENCE>-<DROPPED>
 //     data: <JSON ENVELOPE BATCH>
+//
+// The event ID is present when the logs provider reports stream positions.
+// SEQUENCE increases by one for every batch of the stream and DROPPED is the
+// number of envelopes dropped for the stream so far, so a client can detect
+// loss.
 func ReadHandler(
 	lp LogsProvider,
 	heartbeat time.Duration,
@@ -46,19 +64,22 @@ func ReadHandler(
 			return
 		}
 
+		fields, err := BuildFields(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if fields != "" {
+			ctx = WithFields(ctx, fields)
+		}
+
 		flusher, ok := w.(http.Flusher)
 		if !ok {
 			errStreamingUnsupported.Write(w)
 			return
 		}
 
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-
-		flusher.Flush()
-
-		recv := lp.Stream(
+		recv, err := lp.Stream(
 			ctx,
 			&loggregator_v2.EgressBatchRequest{
 				ShardId:           query.Get("shard_id"),
@@ -67,6 +88,16 @@ func ReadHandler(
 				Selectors:         s,
 			},
 		)
+		if err != nil {
+			writeStreamError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		flusher.Flush()
 
 		data := make(chan *loggregator_v2.EnvelopeBatch)
 		errs := make(chan error)
@@ -108,12 +139,17 @@ func ReadHandler(
 
 				return
 			case batch := <-data:
+				batch, id, ok := streamPosition(batch)
+
 				d, err := marshaler.MarshalToString(batch)
 				if err != nil {
 					log.Printf("error marshaling envelope batch to string: %s", err)
 					return
 				}
 
+				if ok {
+					fmt.Fprintf(w, "id: %s\n", id)
+				}
 				fmt.Fprintf(w, "data: %s\n\n", d)
 				flusher.Flush()
 
@@ -134,6 +170,43 @@ func ReadHandler(
 	}
 }
 
+// writeStreamError responds to a request whose stream could not be opened.
+// A stream the logs provider rejected because it is overloaded is reported
+// as unavailable with the Retry-After hint of the logs provider.
+func writeStreamError(w http.ResponseWriter, err error) {
+	if u, ok := err.(*UnavailableError); ok {
+		if u.RetryAfter > 0 {
+			seconds := int64((u.RetryAfter + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		}
+		errUnavailable.Write(w)
+		return
+	}
+
+	log.Printf("error opening stream to logs provider: %s", err)
+	errStreamFailed.Write(w)
+}
+
+// streamPosition returns the batch without the stream position envelope the
+// logs provider ends it with and the stream position as an event ID. It
+// returns the batch unchanged and false if the batch does not end with a
+// stream position.
+func streamPosition(batch *loggregator_v2.EnvelopeBatch) (*loggregator_v2.EnvelopeBatch, string, bool) {
+	n := len(batch.GetBatch())
+	if n == 0 {
+		return batch, "", false
+	}
+
+	last := batch.Batch[n-1]
+	if last.GetCounter().GetName() != streamDroppedName {
+		return batch, "", false
+	}
+
+	id := fmt.Sprintf("%s-%d", last.GetTags()[streamSequenceTag], last.GetCounter().GetTotal())
+
+	return &loggregator_v2.EnvelopeBatch{Batch: batch.Batch[:n-1]}, id, true
+}
+
 func isDone(ctx context.Context) bool {
 	select {
 	case <-ctx.Done():
@@ -311,6 +311,77 @@ var _ = Describe("Read", func() {
 		}).Should(Equal(io.EOF))
 	})
 
+	It("sends the stream position as the event ID", func() {
+		lp._batchResponse = &loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{
+				{
+					SourceId: "source-id-a",
+				},
+				{
+					Tags: map[string]string{"sequence": "7"},
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{
+							Name:  "rlp_stream_dropped",
+							Total: 42,
+						},
+					},
+				},
+			},
+		}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/read?log", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		req = req.WithContext(ctx)
+
+		resp, err := server.Client().Do(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		buf := bufio.NewReader(resp.Body)
+
+		line, err := buf.ReadBytes('\n')
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(line)).To(Equal("id: 7-42\n"))
+
+		line, err = buf.ReadBytes('\n')
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(line)).To(HavePrefix("data: "))
+		Expect(string(line[6:])).To(MatchJSON(`{
+			"batch": [
+				{
+					"source_id":"source-id-a",
+					"timestamp": "0",
+					"instance_id": "",
+					"tags": {},
+					"deprecated_tags": {}
+				}
+			]
+		}`))
+	})
+
+	It("passes the field mask to the logs provider", func() {
+		req, err := http.NewRequest(
+			http.MethodGet,
+			server.URL+"/v2/read?log&fields=instance_id,tags.deployment",
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = server.Client().Do(req.WithContext(ctx))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(lp.fields).Should(Equal([]string{"instance_id,tags.deployment"}))
+	})
+
+	It("returns a bad request for an invalid field mask", func() {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/read?log&fields=payload", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := server.Client().Do(req.WithContext(ctx))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
 	It("closes the SSE stream if the envelope stream returns any error", func() {
 		lp._batchResponse = nil
 		lp._errorResponse = errors.New("an error")
@@ -330,6 +401,37 @@ var _ = Describe("Read", func() {
 		}).Should(Equal(io.EOF))
 	})
 
+	It("returns 503 with Retry-After if the logs provider is overloaded", func() {
+		lp._streamError = &web.UnavailableError{RetryAfter: 10 * time.Second}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/read?log", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := server.Client().Do(req.WithContext(ctx))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("10"))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(MatchJSON(`{
+			"error": "unavailable",
+			"message": "logs provider is overloaded, retry later"
+		}`))
+	})
+
+	It("returns 502 if the stream cannot be opened", func() {
+		lp._streamError = errors.New("an error")
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/read?log", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		resp, err := server.Client().Do(req.WithContext(ctx))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+	})
+
 	It("returns a bad request if no selectors are provided in url", func() {
 		req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/read", nil)
 		Expect(err).ToNot(HaveOccurred())
@@ -382,8 +484,10 @@ var _ = Describe("Read", func() {
 type stubLogsProvider struct {
 	mu             sync.Mutex
 	_requests      []*loggregator_v2.EgressBatchRequest
+	_fields        []string
 	_batchResponse *loggregator_v2.EnvelopeBatch
 	_errorResponse error
+	_streamError   error
 	block          bool
 }
 
@@ -391,10 +495,15 @@ func newStubLogsProvider() *stubLogsProvider {
 	return &stubLogsProvider{}
 }
 
-func (s *stubLogsProvider) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) web.Receiver {
+func (s *stubLogsProvider) Stream(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (web.Receiver, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s._requests = append(s._requests, req)
+	s._fields = append(s._fields, web.Fields(ctx))
+
+	if s._streamError != nil {
+		return nil, s._streamError
+	}
 
 	return func() (*loggregator_v2.EnvelopeBatch, error) {
 		if s.block {
@@ -403,7 +512,14 @@ func (s *stubLogsProvider) Stream(ctx context.Context, req *loggregator_v2.Egres
 		}
 
 		return s._batchResponse, s._errorResponse
-	}
+	}, nil
+}
+
+func (s *stubLogsProvider) fields() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s._fields...)
 }
 
 func (s *stubLogsProvider) requests() []*loggregator_v2.EgressBatchRequest {
@@ -1,43 +1,193 @@
 package app
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/loggregator/plumbing"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
 )
 
 // GRPC stores the configuration for the RLP as a server using a PORT with
 // mTLS certs and as a client also using mTSL certs for emitting metrics and
 // for connecting to the Router.
 type GRPC struct {
-	Port         int      `env:"RLP_PORT"`
-	CertFile     string   `env:"RLP_CERT_FILE"`
-	KeyFile      string   `env:"RLP_KEY_FILE"`
-	CAFile       string   `env:"RLP_CA_FILE"`
-	CipherSuites []string `env:"RLP_CIPHER_SUITES"`
+	Port             int      `env:"RLP_PORT"`
+	CertFile         string   `env:"RLP_CERT_FILE"`
+	KeyFile          string   `env:"RLP_KEY_FILE"`
+	CAFile           string   `env:"RLP_CA_FILE"`
+	CipherSuites     []string `env:"RLP_CIPHER_SUITES"`
+	MinTLSVersion    string   `env:"RLP_MIN_TLS_VERSION"`
+	MaxTLSVersion    string   `env:"RLP_MAX_TLS_VERSION"`
+	CurvePreferences []string `env:"RLP_CURVE_PREFERENCES"`
+	CRLFiles         []string `env:"RLP_CRL_FILES"`
+
+	// EgressAllowedPeers are the certificate identities allowed to read from
+	// the RLP. When empty any peer with a certificate signed by the CA is
+	// allowed.
+	EgressAllowedPeers []string `env:"RLP_EGRESS_ALLOWED_PEERS"`
+}
+
+// TLSPolicy returns the TLS policy for the RLP server.
+func (g GRPC) TLSPolicy() plumbing.TLSPolicy {
+	return plumbing.TLSPolicy{
+		CipherSuites:     g.CipherSuites,
+		MinVersion:       g.MinTLSVersion,
+		MaxVersion:       g.MaxTLSVersion,
+		CurvePreferences: g.CurvePreferences,
+	}
+}
+
+// AuthzRules returns the peer authorization rules for the RLP server.
+func (g GRPC) AuthzRules() map[string][]string {
+	rules := make(map[string][]string)
+	if len(g.EgressAllowedPeers) > 0 {
+		rules["/loggregator.v2.Egress/*"] = g.EgressAllowedPeers
+	}
+
+	return rules
 }
 
 // Config stores all configurations options for RLP.
 type Config struct {
-	PProfPort             uint32        `env:"RLP_PPROF_PORT"`
-	HealthAddr            string        `env:"RLP_HEALTH_ADDR"`
-	MetricEmitterInterval time.Duration `env:"RLP_METRIC_EMITTER_INTERVAL"`
-	MetricSourceID        string        `env:"RLP_METRIC_SOURCE_ID"`
-	RouterAddrs           []string      `env:"ROUTER_ADDRS, required"`
-	AgentAddr             string        `env:"AGENT_ADDR"`
-	MaxEgressStreams      int64         `env:"MAX_EGRESS_STREAMS"`
-	GRPC                  GRPC
+	PProfPort              uint32        `env:"RLP_PPROF_PORT"`
+	HealthAddr             string        `env:"RLP_HEALTH_ADDR"`
+	MetricEmitterInterval  time.Duration `env:"RLP_METRIC_EMITTER_INTERVAL"`
+	MetricSourceID         string        `env:"RLP_METRIC_SOURCE_ID"`
+	RouterAddrs            []string      `env:"ROUTER_ADDRS"`
+	RouterDNSAddr          string        `env:"ROUTER_DNS_ADDR"`
+	RouterAddrsFile        string        `env:"ROUTER_ADDRS_FILE"`
+	RouterDNSInterval      time.Duration `env:"ROUTER_DNS_INTERVAL"`
+	RouterDNSJitter        time.Duration `env:"ROUTER_DNS_JITTER"`
+	AgentAddr              string        `env:"AGENT_ADDR"`
+	MaxEgressStreams       int64         `env:"MAX_EGRESS_STREAMS"`
+	MaxRouterSubscriptions int           `env:"MAX_ROUTER_SUBSCRIPTIONS"`
+	MaxEgressBatchBytes    int           `env:"MAX_EGRESS_BATCH_BYTES"`
+	MaxStatsPeers          int           `env:"MAX_STATS_PEERS"`
+	MinReadyRouters        int           `env:"MIN_READY_ROUTERS"`
+	GRPC                   GRPC
+
+	// MaxStreamsPerIdentity and MaxStreamsPerShard are the default limits
+	// on egress streams per client identity and per shard ID. A limit of 0
+	// is unlimited.
+	MaxStreamsPerIdentity int `env:"MAX_EGRESS_STREAMS_PER_IDENTITY"`
+	MaxStreamsPerShard    int `env:"MAX_EGRESS_STREAMS_PER_SHARD"`
+
+	// IdentityStreamQuotas and ShardStreamQuotas override the default limits
+	// for specific identities and shard IDs. Each entry is of the form
+	// name:limit.
+	IdentityStreamQuotas []string `env:"EGRESS_IDENTITY_STREAM_QUOTAS"`
+	ShardStreamQuotas    []string `env:"EGRESS_SHARD_STREAM_QUOTAS"`
+
+	// TrustedForwarders are the certificate common names of peers, such as
+	// the RLP gateway, that may pass on the identity of their clients.
+	TrustedForwarders []string `env:"EGRESS_TRUSTED_FORWARDERS"`
+
+	// DedupeWindow is the window within which envelopes received from more
+	// than one router are suppressed. A window of 0 disables deduplication.
+	// DedupeMaxEntries bounds the envelopes each subscription remembers and
+	// must be positive when deduplication is enabled.
+	DedupeWindow     time.Duration `env:"DEDUPE_WINDOW"`
+	DedupeMaxEntries int           `env:"DEDUPE_MAX_ENTRIES"`
+
+	// IngressBufferSize is the number of envelopes buffered for each
+	// subscription to the routers.
+	IngressBufferSize int `env:"INGRESS_BUFFER_SIZE"`
+
+	// MinEgressBufferSize and MaxEgressBufferSize bound the envelope buffer
+	// size a subscriber may ask for. A max of 0 removes the upper bound.
+	MinEgressBufferSize int `env:"EGRESS_MIN_BUFFER_SIZE"`
+	MaxEgressBufferSize int `env:"EGRESS_MAX_BUFFER_SIZE"`
+
+	// AdmissionMaxDropRate, AdmissionMaxHeapBytes and
+	// AdmissionMaxGoroutines are the levels of load above which new egress
+	// streams are rejected. The drop rate is the fraction of envelopes
+	// dropped for subscribers over the last second. A value of 0 disables
+	// the check. Rejected subscribers are asked to retry after
+	// AdmissionRetryAfter.
+	AdmissionMaxDropRate   float64       `env:"ADMISSION_MAX_DROP_RATE"`
+	AdmissionMaxHeapBytes  uint64        `env:"ADMISSION_MAX_HEAP_BYTES"`
+	AdmissionMaxGoroutines int           `env:"ADMISSION_MAX_GOROUTINES"`
+	AdmissionRetryAfter    time.Duration `env:"ADMISSION_RETRY_AFTER"`
+}
+
+// AdmissionThresholds returns the load above which new egress streams are
+// rejected.
+func (c Config) AdmissionThresholds() egress.AdmissionThresholds {
+	return egress.AdmissionThresholds{
+		DropRate:   c.AdmissionMaxDropRate,
+		HeapBytes:  c.AdmissionMaxHeapBytes,
+		Goroutines: c.AdmissionMaxGoroutines,
+		RetryAfter: c.AdmissionRetryAfter,
+	}
+}
+
+// StreamQuotas returns the limits on egress streams per client identity and
+// per shard ID.
+func (c Config) StreamQuotas() (egress.StreamQuotas, error) {
+	identities, err := parseQuotas(c.IdentityStreamQuotas)
+	if err != nil {
+		return egress.StreamQuotas{}, err
+	}
+
+	shards, err := parseQuotas(c.ShardStreamQuotas)
+	if err != nil {
+		return egress.StreamQuotas{}, err
+	}
+
+	return egress.StreamQuotas{
+		PerIdentity:       c.MaxStreamsPerIdentity,
+		PerShard:          c.MaxStreamsPerShard,
+		Identities:        identities,
+		Shards:            shards,
+		TrustedForwarders: c.TrustedForwarders,
+	}, nil
+}
+
+// parseQuotas parses entries of the form name:limit. The name may itself
+// contain colons, such as a SPIFFE ID.
+func parseQuotas(entries []string) (map[string]int, error) {
+	quotas := make(map[string]int, len(entries))
+	for _, e := range entries {
+		i := strings.LastIndex(e, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid stream quota %q, expected name:limit", e)
+		}
+
+		limit, err := strconv.Atoi(e[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream quota %q: %s", e, err)
+		}
+		quotas[e[:i]] = limit
+	}
+
+	return quotas, nil
 }
 
 // LoadConfig reads from the environment to create a Config.
 func LoadConfig() (*Config, error) {
 	conf := Config{
-		PProfPort:             6061,
-		HealthAddr:            "localhost:14825",
-		MetricEmitterInterval: time.Minute,
-		MetricSourceID:        "reverse_log_proxy",
-		AgentAddr:             "localhost:3458",
-		MaxEgressStreams:      500,
+		PProfPort:              6061,
+		HealthAddr:             "localhost:14825",
+		MetricEmitterInterval:  time.Minute,
+		MetricSourceID:         "reverse_log_proxy",
+		AgentAddr:              "localhost:3458",
+		MaxEgressStreams:       500,
+		MaxRouterSubscriptions: 2000,
+		MaxEgressBatchBytes:    3 * 1024 * 1024,
+		MaxStatsPeers:          500,
+		MinReadyRouters:        1,
+		DedupeMaxEntries:       10000,
+		IngressBufferSize:      1000,
+		MinEgressBufferSize:    1,
+		MaxEgressBufferSize:    10000,
+		AdmissionRetryAfter:    10 * time.Second,
+		RouterDNSInterval:      10 * time.Second,
+		RouterDNSJitter:        2 * time.Second,
 	}
 
 	err := envstruct.Load(&conf)
@@ -45,5 +195,33 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if len(conf.RouterAddrs) == 0 && conf.RouterDNSAddr == "" && conf.RouterAddrsFile == "" {
+		return nil, errors.New("one of ROUTER_ADDRS, ROUTER_DNS_ADDR or ROUTER_ADDRS_FILE is required")
+	}
+
+	if err := conf.GRPC.TLSPolicy().Validate(); err != nil {
+		return nil, err
+	}
+
+	if conf.DedupeWindow > 0 && conf.DedupeMaxEntries <= 0 {
+		return nil, errors.New("DEDUPE_MAX_ENTRIES must be positive when DEDUPE_WINDOW is set")
+	}
+
+	if conf.IngressBufferSize <= 0 {
+		return nil, errors.New("INGRESS_BUFFER_SIZE must be positive")
+	}
+
+	if conf.MinEgressBufferSize < 1 {
+		return nil, errors.New("EGRESS_MIN_BUFFER_SIZE must be at least 1")
+	}
+
+	if conf.MaxEgressBufferSize > 0 && conf.MaxEgressBufferSize < conf.MinEgressBufferSize {
+		return nil, errors.New("EGRESS_MAX_BUFFER_SIZE must not be less than EGRESS_MIN_BUFFER_SIZE")
+	}
+
+	if _, err := conf.StreamQuotas(); err != nil {
+		return nil, err
+	}
+
 	return &conf, nil
 }
@@ -28,30 +28,61 @@ type MetricClient interface {
 	NewGauge(name, unit string, opts ...metricemitter.MetricOption) *metricemitter.Gauge
 }
 
+// Finder yields events that tell the RLP which routers are available.
+type Finder interface {
+	Start()
+	Stop()
+	Next() plumbing.Event
+}
+
+// healthCheckInterval is how often the conditions reported by the gRPC
+// health service are evaluated.
+const healthCheckInterval = 5 * time.Second
+
 // RLP represents the reverse log proxy component. It connects to various gRPC
 // servers to ingress data and opens a gRPC server to egress data.
 type RLP struct {
 	ctx       context.Context
 	ctxCancel func()
 
-	egressPort           int
-	egressServerOpts     []grpc.ServerOption
-	maxEgressConnections int
-	maxEgressStreams     int64
+	egressPort              int
+	egressServerOpts        []grpc.ServerOption
+	maxEgressConnections    int
+	maxEgressStreams        int64
+	maxIngressSubscriptions int
+	maxEgressBatchBytes     int
+	sizeMetricsInterval     time.Duration
+	minReadyRouters         int
+	streamQuotas            egress.StreamQuotas
+	dedupeWindow            time.Duration
+	dedupeMaxEntries        int
+	ingressBufferSize       int
+	minEgressBufferSize     int
+	maxEgressBufferSize     int
+	admission               egress.AdmissionThresholds
 
 	ingressAddrs    []string
 	ingressDialOpts []grpc.DialOption
 
 	ingressPool *ingress.Pool
 	connector   *ingress.GRPCConnector
-	finder      *plumbing.StaticFinder
+	finder      Finder
 
 	egressAddr     net.Addr
 	egressListener net.Listener
 	egressServer   *grpc.Server
-
-	healthAddr string
-	health     *healthendpoint.Registrar
+	egress         *egress.Server
+	grpcHealth     *plumbing.GRPCHealth
+	checks         *healthendpoint.Checks
+	routerStatus   *routerStatusHandler
+
+	healthAddr   string
+	health       *healthendpoint.Registrar
+	sizeStats    *plumbing.SizeStatsHandler
+	stopSizes    []func()
+	peerStats    *plumbing.PeerStatsHandler
+	promRegistry *prometheus.Registry
+	routerAddrs  *prometheus.GaugeVec
 
 	metricClient MetricClient
 }
@@ -60,15 +91,23 @@ type RLP struct {
 func NewRLP(m MetricClient, opts ...RLPOption) *RLP {
 	ctx, cancel := context.WithCancel(context.Background())
 	rlp := &RLP{
-		ingressAddrs:         []string{"doppler.service.cf.internal"},
-		ingressDialOpts:      []grpc.DialOption{grpc.WithInsecure()},
-		egressServerOpts:     []grpc.ServerOption{},
-		maxEgressConnections: 500,
-		maxEgressStreams:     500,
-		metricClient:         m,
-		healthAddr:           "localhost:0",
-		ctx:                  ctx,
-		ctxCancel:            cancel,
+		ingressAddrs:            []string{"doppler.service.cf.internal"},
+		ingressDialOpts:         []grpc.DialOption{grpc.WithInsecure()},
+		egressServerOpts:        []grpc.ServerOption{},
+		maxEgressConnections:    500,
+		maxEgressStreams:        500,
+		maxIngressSubscriptions: 2000,
+		maxEgressBatchBytes:     3 * 1024 * 1024,
+		ingressBufferSize:       1000,
+		minEgressBufferSize:     1,
+		maxEgressBufferSize:     10000,
+		sizeMetricsInterval:     time.Minute,
+		minReadyRouters:         1,
+		peerStats:               plumbing.NewPeerStatsHandler(),
+		metricClient:            m,
+		healthAddr:              "localhost:0",
+		ctx:                     ctx,
+		ctxCancel:               cancel,
 	}
 	for _, o := range opts {
 		o(rlp)
@@ -104,6 +143,14 @@ func WithIngressAddrs(addrs []string) RLPOption {
 	}
 }
 
+// WithIngressFinder specifies the Finder used to discover the addresses to
+// connect to for ingress data. It takes precedence over WithIngressAddrs.
+func WithIngressFinder(f Finder) RLPOption {
+	return func(r *RLP) {
+		r.finder = f
+	}
+}
+
 // WithIngressDialOptions specifies the dial options used when connecting to
 // the gRPC server to ingress data.
 func WithIngressDialOptions(opts ...grpc.DialOption) RLPOption {
@@ -135,6 +182,91 @@ func WithMaxEgressStreams(max int64) RLPOption {
 	}
 }
 
+// WithMaxEgressBatchBytes specifies the maximum encoded size of a batch sent
+// to a subscriber. A value of 0 or less removes the limit.
+func WithMaxEgressBatchBytes(n int) RLPOption {
+	return func(r *RLP) {
+		r.maxEgressBatchBytes = n
+	}
+}
+
+// WithSizeMetricsInterval specifies how often the message size percentiles
+// and bucket counts are emitted.
+func WithSizeMetricsInterval(d time.Duration) RLPOption {
+	return func(r *RLP) {
+		r.sizeMetricsInterval = d
+	}
+}
+
+// WithMinReadyRouters specifies the number of routers the RLP must be
+// subscribed to before it reports itself as ready. It defaults to 1.
+func WithMinReadyRouters(n int) RLPOption {
+	return func(r *RLP) {
+		r.minReadyRouters = n
+	}
+}
+
+// WithEgressStreamQuotas specifies the limits on the number of egress
+// streams per client identity and per shard ID.
+func WithEgressStreamQuotas(q egress.StreamQuotas) RLPOption {
+	return func(r *RLP) {
+		r.streamQuotas = q
+	}
+}
+
+// WithPeerStats specifies the handler used to track the bytes and messages
+// exchanged with each router and subscriber. It is reported on the health
+// endpoint.
+func WithPeerStats(h *plumbing.PeerStatsHandler) RLPOption {
+	return func(r *RLP) {
+		r.peerStats = h
+	}
+}
+
+// WithMaxIngressSubscriptions specifies the number of subscriptions the RLP
+// will open to routers. A value of 0 or less removes the limit.
+func WithMaxIngressSubscriptions(max int) RLPOption {
+	return func(r *RLP) {
+		r.maxIngressSubscriptions = max
+	}
+}
+
+// WithDedupe specifies the window within which envelopes received from more
+// than one router are suppressed and the number of envelopes each
+// subscription remembers. A window of 0 or less disables deduplication.
+// maxEntries must be positive when deduplication is enabled.
+func WithDedupe(window time.Duration, maxEntries int) RLPOption {
+	return func(r *RLP) {
+		r.dedupeWindow = window
+		r.dedupeMaxEntries = maxEntries
+	}
+}
+
+// WithIngressBufferSize specifies the number of envelopes buffered for each
+// subscription between the routers and the egress stream.
+func WithIngressBufferSize(n int) RLPOption {
+	return func(r *RLP) {
+		r.ingressBufferSize = n
+	}
+}
+
+// WithEgressBufferSizeBounds specifies the bounds of the envelope buffer
+// size a subscriber may ask for on its egress stream.
+func WithEgressBufferSizeBounds(min, max int) RLPOption {
+	return func(r *RLP) {
+		r.minEgressBufferSize = min
+		r.maxEgressBufferSize = max
+	}
+}
+
+// WithAdmissionThresholds specifies the load above which the RLP rejects new
+// egress streams.
+func WithAdmissionThresholds(t egress.AdmissionThresholds) RLPOption {
+	return func(r *RLP) {
+		r.admission = t
+	}
+}
+
 // EgressAddr returns the address used for the egress server.
 func (r *RLP) EgressAddr() net.Addr {
 	return r.egressAddr
@@ -144,8 +276,10 @@ func (r *RLP) EgressAddr() net.Addr {
 // listens for gRPC connections for egressing data.
 func (r *RLP) Start() {
 	r.setupHealthEndpoint()
+	r.setupSizeStats()
 	r.setupIngress()
 	r.setupEgress()
+	r.grpcHealth.Start(healthCheckInterval)
 	r.serveEgress()
 }
 
@@ -153,6 +287,8 @@ func (r *RLP) Start() {
 // and drains existing ones. Stop will not return until existing connections
 // are drained or timeout has elapsed.
 func (r *RLP) Stop() {
+	r.grpcHealth.Drain()
+	r.checks.Shutdown()
 	r.ctxCancel()
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -162,19 +298,123 @@ func (r *RLP) Stop() {
 		r.egressServer.GracefulStop()
 	}()
 
+	// Routers may have been discovered by the finder rather than
+	// configured, so the connections to close are taken from the connector.
+	routers := r.connector.RouterStates()
+
 	// Stop reconnects to ingress servers
 	r.finder.Stop()
 
 	// Close current connections to ingress servers
-	for _, addr := range r.ingressAddrs {
+	for addr := range routers {
 		r.ingressPool.Close(addr)
 	}
+
+	for _, stop := range r.stopSizes {
+		stop()
+	}
 }
 
 func (r *RLP) setupIngress() {
-	r.finder = plumbing.NewStaticFinder(r.ingressAddrs)
-	r.ingressPool = ingress.NewPool(20, r.ingressDialOpts...)
-	r.connector = ingress.NewGRPCConnector(1000, r.ingressPool, r.finder, r.metricClient)
+	if r.finder == nil {
+		r.finder = plumbing.NewStaticFinder(r.ingressAddrs)
+	}
+	r.finder.Start()
+
+	dialOpts := append(r.ingressDialOpts, grpc.WithStatsHandler(
+		plumbing.NewMultiStatsHandler(r.sizeStats, r.peerStats),
+	))
+	r.ingressPool = ingress.NewPool(20, dialOpts...)
+	r.connector = ingress.NewGRPCConnector(
+		r.ingressBufferSize,
+		r.ingressPool,
+		plumbing.NewReportingFinder(r.finder, r.routerAddrs),
+		r.metricClient,
+		ingress.WithMaxConsumers(r.maxIngressSubscriptions),
+		ingress.WithDedupe(r.dedupeWindow, r.dedupeMaxEntries),
+	)
+
+	r.checks.AddReadiness(healthendpoint.NewCheck("routers_connected", r.routersConnected))
+
+	// metric-documentation-health: (routerState)
+	// Connection state of each router
+	r.promRegistry.MustRegister(healthendpoint.NewStateCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      "routerState",
+			Help:      "Connection state of each router",
+		},
+		"addr",
+		func() map[string]string {
+			states := make(map[string]string)
+			for addr, state := range r.connector.RouterStates() {
+				states[addr] = state.String()
+			}
+			return states
+		},
+	))
+
+	r.routerStatus.setSource(r.connector.RouterStatuses)
+
+	// metric-documentation-health: (routerConnections)
+	// Number of established connections to each router
+	r.promRegistry.MustRegister(r.routerStatusCollector(
+		"routerConnections",
+		"Number of established connections to each router",
+		func(s ingress.RouterStatus) float64 {
+			return float64(s.Connections)
+		},
+	))
+
+	// metric-documentation-health: (routerStreams)
+	// Number of subscriptions streaming from each router
+	r.promRegistry.MustRegister(r.routerStatusCollector(
+		"routerStreams",
+		"Number of subscriptions streaming from each router",
+		func(s ingress.RouterStatus) float64 {
+			return float64(s.Streams)
+		},
+	))
+
+	// metric-documentation-health: (routerLastConnect)
+	// Time of the last successful subscription to each router, as a unix
+	// timestamp
+	r.promRegistry.MustRegister(r.routerStatusCollector(
+		"routerLastConnect",
+		"Time of the last successful subscription to each router, as a unix timestamp",
+		func(s ingress.RouterStatus) float64 {
+			if s.LastConnect == nil {
+				return 0
+			}
+			return float64(s.LastConnect.Unix())
+		},
+	))
+}
+
+// routerStatusCollector returns a collector reporting a value of the status
+// of each router labeled with its address.
+func (r *RLP) routerStatusCollector(
+	name string,
+	help string,
+	value func(ingress.RouterStatus) float64,
+) *healthendpoint.ValueCollector {
+	return healthendpoint.NewValueCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      name,
+			Help:      help,
+		},
+		"addr",
+		func() map[string]float64 {
+			values := make(map[string]float64)
+			for _, s := range r.connector.RouterStatuses() {
+				values[s.Addr] = value(s)
+			}
+			return values
+		},
+	)
 }
 
 func (r *RLP) startEgressListener() {
@@ -188,25 +428,119 @@ func (r *RLP) startEgressListener() {
 }
 
 func (r *RLP) setupEgress() {
-	r.egressServer = grpc.NewServer(r.egressServerOpts...)
-	loggregator_v2.RegisterEgressServer(
-		r.egressServer,
-		egress.NewServer(
-			r.connector,
-			r.metricClient,
-			r.health,
-			r.ctx,
-			100,
-			100*time.Millisecond,
-			egress.WithMaxStreams(r.maxEgressStreams),
-		),
+	opts := append(r.egressServerOpts, grpc.StatsHandler(
+		plumbing.NewMultiStatsHandler(r.sizeStats, r.peerStats),
+	))
+	r.egressServer = grpc.NewServer(opts...)
+	r.grpcHealth = plumbing.NewGRPCHealth(r.routersConnected)
+	r.grpcHealth.Register(r.egressServer)
+	r.egress = egress.NewServer(
+		r.connector,
+		r.metricClient,
+		r.health,
+		r.ctx,
+		100,
+		100*time.Millisecond,
+		egress.WithMaxStreams(r.maxEgressStreams),
+		egress.WithMaxBatchBytes(r.maxEgressBatchBytes),
+		egress.WithStreamQuotas(r.streamQuotas),
+		egress.WithBufferSizeBounds(r.minEgressBufferSize, r.maxEgressBufferSize),
+		egress.WithLagInterval(r.sizeMetricsInterval),
+		egress.WithAdmissionThresholds(r.admission),
 	)
+	loggregator_v2.RegisterEgressServer(r.egressServer, r.egress)
+
+	// metric-documentation-health: (identityStreams)
+	// Number of open egress streams per client identity
+	r.promRegistry.MustRegister(healthendpoint.NewValueCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      "identityStreams",
+			Help:      "Number of open egress streams per client identity",
+		},
+		"identity",
+		func() map[string]float64 {
+			return toFloats(r.egress.StreamUsage().Identities)
+		},
+	))
+
+	// metric-documentation-health: (shardStreams)
+	// Number of open egress streams per shard ID
+	r.promRegistry.MustRegister(healthendpoint.NewValueCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      "shardStreams",
+			Help:      "Number of open egress streams per shard ID",
+		},
+		"shard_id",
+		func() map[string]float64 {
+			return toFloats(r.egress.StreamUsage().Shards)
+		},
+	))
+
+	// metric-documentation-health: (streamLag)
+	// Percentiles of the milliseconds from envelope timestamp to send per
+	// shard ID, labeled with the quantile
+	for quantile, percentile := range map[string]func(egress.StreamLag) time.Duration{
+		"0.5":  func(l egress.StreamLag) time.Duration { return l.P50 },
+		"0.95": func(l egress.StreamLag) time.Duration { return l.P95 },
+		"0.99": func(l egress.StreamLag) time.Duration { return l.P99 },
+	} {
+		percentile := percentile
+		r.promRegistry.MustRegister(healthendpoint.NewValueCollector(
+			prometheus.GaugeOpts{
+				Namespace:   "loggregator",
+				Subsystem:   "reverseLogProxy",
+				Name:        "streamLag",
+				Help:        "Percentiles of the milliseconds from envelope timestamp to send per shard ID",
+				ConstLabels: prometheus.Labels{"quantile": quantile},
+			},
+			"shard_id",
+			func() map[string]float64 {
+				lag := make(map[string]float64)
+				for shardID, l := range r.egress.StreamLag() {
+					lag[shardID] = float64(percentile(l) / time.Millisecond)
+				}
+				return lag
+			},
+		))
+	}
+}
+
+// routersConnected returns an error unless the RLP is subscribed to at least
+// the minimum number of routers.
+func (r *RLP) routersConnected() error {
+	var connected int
+	for _, state := range r.connector.RouterStates() {
+		if state == plumbing.RouterConnected {
+			connected++
+		}
+	}
+
+	if connected < r.minReadyRouters {
+		return fmt.Errorf(
+			"%d routers are connected, at least %d are required",
+			connected,
+			r.minReadyRouters,
+		)
+	}
+
+	return nil
 }
 
 func (r *RLP) setupHealthEndpoint() {
-	promRegistry := prometheus.NewRegistry()
-	healthendpoint.StartServer(r.healthAddr, promRegistry)
-	r.health = healthendpoint.New(promRegistry, map[string]prometheus.Gauge{
+	r.promRegistry = prometheus.NewRegistry()
+	r.checks = healthendpoint.NewChecks()
+	r.routerStatus = &routerStatusHandler{}
+	healthendpoint.StartServer(
+		r.healthAddr,
+		r.promRegistry,
+		healthendpoint.WithChecks(r.checks),
+		healthendpoint.WithHandler("/routers", r.routerStatus),
+	)
+	r.health = healthendpoint.New(r.promRegistry, map[string]prometheus.Gauge{
 		// metric-documentation-health: (subscriptionCount)
 		// Number of open subscriptions
 		"subscriptionCount": prometheus.NewGauge(
@@ -218,6 +552,106 @@ func (r *RLP) setupHealthEndpoint() {
 			},
 		),
 	})
+
+	// metric-documentation-health: (routerAddrs)
+	// Router addresses currently known to the RLP
+	r.routerAddrs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      "routerAddrs",
+			Help:      "Router addresses currently known to the RLP",
+		},
+		[]string{"addr"},
+	)
+	r.promRegistry.MustRegister(r.routerAddrs)
+
+	// metric-documentation-health: (revokedPeers)
+	// Number of peers rejected because their certificate was revoked
+	r.promRegistry.MustRegister(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      "revokedPeers",
+			Help:      "Number of peers rejected because their certificate was revoked",
+		},
+		func() float64 {
+			return float64(plumbing.RevokedPeers())
+		},
+	))
+
+	// metric-documentation-health: (peerBytes)
+	// Payload bytes exchanged with each gRPC peer
+	// metric-documentation-health: (peerMessages)
+	// Messages exchanged with each gRPC peer
+	r.promRegistry.MustRegister(healthendpoint.NewPeerStatsCollector(
+		"loggregator",
+		"reverseLogProxy",
+		r.peerStats.Stats,
+	))
+
+	// metric-documentation-health: (tlsCertExpiry)
+	// Expiry of each TLS certificate in use, as a unix timestamp
+	r.promRegistry.MustRegister(healthendpoint.NewValueCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "reverseLogProxy",
+			Name:      "tlsCertExpiry",
+			Help:      "Expiry of each TLS certificate in use, as a unix timestamp",
+		},
+		"cert",
+		func() map[string]float64 {
+			expiries := make(map[string]float64)
+			for cert, expiry := range plumbing.CertExpiries() {
+				expiries[cert] = float64(expiry.Unix())
+			}
+			return expiries
+		},
+	))
+}
+
+// setupSizeStats creates the stats handler that records the size of the
+// messages received from routers and sent to subscribers.
+func (r *RLP) setupSizeStats() {
+	r.sizeStats = plumbing.NewSizeStatsHandler()
+
+	for direction, hist := range map[string]*plumbing.SizeHistogram{
+		"in":  r.sizeStats.In(),
+		"out": r.sizeStats.Out(),
+	} {
+		// metric-documentation-v2: (loggregator.rlp.message_size_p50) 50th
+		// percentile of gRPC message sizes in bytes per interval.
+		// metric-documentation-v2: (loggregator.rlp.message_size_p95) 95th
+		// percentile of gRPC message sizes in bytes per interval.
+		// metric-documentation-v2: (loggregator.rlp.message_size_p99) 99th
+		// percentile of gRPC message sizes in bytes per interval.
+		// metric-documentation-v2: (loggregator.rlp.message_size_bucket)
+		// Number of gRPC messages per size bucket per interval.
+		stop := hist.EmitMetrics(r.metricClient, "message_size", r.sizeMetricsInterval,
+			metricemitter.WithVersion(2, 0),
+			metricemitter.WithTags(map[string]string{
+				"direction": direction,
+			}),
+		)
+		r.stopSizes = append(r.stopSizes, stop)
+
+		hist := hist
+		// metric-documentation-health: (messageSize)
+		// Size of gRPC messages in bytes
+		r.promRegistry.MustRegister(healthendpoint.NewHistogramCollector(
+			prometheus.HistogramOpts{
+				Namespace:   "loggregator",
+				Subsystem:   "reverseLogProxy",
+				Name:        "messageSize",
+				Help:        "Size of gRPC messages in bytes",
+				ConstLabels: prometheus.Labels{"direction": direction},
+			},
+			func() (uint64, float64, map[float64]uint64) {
+				s := hist.Snapshot()
+				return s.Count(), float64(s.Total), s.Buckets()
+			},
+		))
+	}
 }
 
 func (r *RLP) serveEgress() {
@@ -226,6 +660,15 @@ func (r *RLP) serveEgress() {
 	}
 }
 
+func toFloats(m map[string]int) map[string]float64 {
+	f := make(map[string]float64, len(m))
+	for k, v := range m {
+		f[k] = float64(v)
+	}
+
+	return f
+}
+
 func (r *RLP) isDone() bool {
 	select {
 	case <-r.ctx.Done():
@@ -13,9 +13,11 @@ import (
 	"code.cloudfoundry.org/loggregator/testservers"
 
 	app "code.cloudfoundry.org/loggregator/rlp/app"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/cloudfoundry/sonde-go/events"
@@ -63,6 +65,47 @@ var _ = Describe("Start", func() {
 		Eventually(f, 2).Should(BeNumerically(">", 10))
 	}, 10)
 
+	It("reports the routers a subscription is attached to", func(done Done) {
+		defer close(done)
+		_, _, dopplerLis := setupDoppler()
+		defer func() {
+			Expect(dopplerLis.Close()).To(Succeed())
+		}()
+
+		egressAddr, _ := setupRLP(dopplerLis, "127.0.0.1:0")
+
+		egressClient, cleanup := setupRLPClient(egressAddr)
+		defer cleanup()
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			egress.SequenceMetadataKey, "true",
+		)
+		var egressStream loggregator_v2.Egress_BatchedReceiverClient
+		Eventually(func() error {
+			var err error
+			egressStream, err = egressClient.BatchedReceiver(ctx, &loggregator_v2.EgressBatchRequest{
+				UsePreferredTags: true,
+				Selectors: []*loggregator_v2.Selector{
+					{
+						Message: &loggregator_v2.Selector_Log{
+							Log: &loggregator_v2.LogSelector{},
+						},
+					},
+				},
+			})
+			return err
+		}, 5).ShouldNot(HaveOccurred())
+
+		Eventually(func() string {
+			batch, err := egressStream.Recv()
+			Expect(err).ToNot(HaveOccurred())
+
+			last := batch.GetBatch()[len(batch.GetBatch())-1]
+			return last.GetTags()[egress.StreamRoutersTag]
+		}, 5).Should(Equal("1"))
+	}, 10)
+
 	It("limits the number of allowed connections", func() {
 		doppler, _, dopplerLis := setupDoppler()
 
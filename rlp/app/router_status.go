@@ -0,0 +1,44 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"code.cloudfoundry.org/loggregator/rlp/internal/ingress"
+)
+
+// routerStatusHandler serves the connection status of each router as JSON.
+// The health server starts before the RLP connects to routers, so it serves
+// an empty list until a source is set.
+type routerStatusHandler struct {
+	mu       sync.RWMutex
+	statuses func() []ingress.RouterStatus
+}
+
+func (h *routerStatusHandler) setSource(statuses func() []ingress.RouterStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.statuses = statuses
+}
+
+func (h *routerStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	source := h.statuses
+	h.mu.RUnlock()
+
+	statuses := []ingress.RouterStatus{}
+	if source != nil {
+		statuses = source()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		Routers []ingress.RouterStatus `json:"routers"`
+	}{statuses})
+	if err != nil {
+		log.Printf("failed to write router status: %s", err)
+	}
+}
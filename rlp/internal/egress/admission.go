@@ -0,0 +1,173 @@
+package egress
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryAfterMetadataKey is the trailing gRPC metadata key that holds the
+// number of seconds a subscriber rejected because the RLP is overloaded
+// should wait before it retries.
+const RetryAfterMetadataKey = "loggregator-retry-after"
+
+// AdmittedMetadataKey is the gRPC header the RLP sends once a stream is
+// admitted. A subscriber that waits for headers can tell an admitted stream
+// from a rejected one without waiting for envelopes.
+const AdmittedMetadataKey = "loggregator-admitted"
+
+// Reasons a stream is rejected because the RLP is overloaded, reported as
+// the reason tag of the rejected_streams metric.
+const (
+	rejectedDropRate   = "drop_rate"
+	rejectedHeap       = "heap"
+	rejectedGoroutines = "goroutines"
+)
+
+const (
+	defaultAdmissionInterval = time.Second
+	defaultRetryAfter        = 10 * time.Second
+)
+
+// AdmissionThresholds are the levels of load above which the RLP rejects
+// new streams. Existing streams are not affected. A threshold of 0 is
+// disabled.
+type AdmissionThresholds struct {
+	// DropRate is the fraction of envelopes dropped for subscribers over
+	// the last interval, between 0 and 1.
+	DropRate float64
+
+	// HeapBytes is the number of bytes of allocated heap objects.
+	HeapBytes uint64
+
+	// Goroutines is the number of goroutines.
+	Goroutines int
+
+	// Interval is how often the load is sampled. It defaults to a second.
+	Interval time.Duration
+
+	// RetryAfter is how long a rejected subscriber is asked to wait before
+	// it retries. It defaults to 10 seconds.
+	RetryAfter time.Duration
+}
+
+func (t AdmissionThresholds) enabled() bool {
+	return t.DropRate > 0 || t.HeapBytes > 0 || t.Goroutines > 0
+}
+
+// loadMonitor samples the load of the process every interval and decides
+// whether new streams are admitted.
+type loadMonitor struct {
+	thresholds AdmissionThresholds
+
+	// sent and dropped must be accessed via atomics
+	sent    uint64
+	dropped uint64
+
+	// lastSent and lastDropped are only accessed by the sampling go-routine.
+	lastSent    uint64
+	lastDropped uint64
+
+	mu     sync.Mutex
+	reason string
+}
+
+func newLoadMonitor(t AdmissionThresholds) *loadMonitor {
+	if t.Interval <= 0 {
+		t.Interval = defaultAdmissionInterval
+	}
+	if t.RetryAfter <= 0 {
+		t.RetryAfter = defaultRetryAfter
+	}
+
+	return &loadMonitor{
+		thresholds: t,
+	}
+}
+
+func (m *loadMonitor) send(n int) {
+	atomic.AddUint64(&m.sent, uint64(n))
+}
+
+func (m *loadMonitor) drop() {
+	atomic.AddUint64(&m.dropped, 1)
+}
+
+// start samples the load right away and then every interval until the
+// given context is done. Sampling on a ticker keeps reading the memory
+// statistics, which stops the world, off the path of new streams. It is a
+// no-op if no threshold is enabled.
+func (m *loadMonitor) start(ctx context.Context) {
+	if !m.thresholds.enabled() {
+		return
+	}
+
+	m.update()
+	go func() {
+		t := time.NewTicker(m.thresholds.Interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				m.update()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (m *loadMonitor) update() {
+	reason := m.sample()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reason = reason
+}
+
+// overloaded returns the reason new streams are rejected as of the last
+// sample or an empty string if they are admitted.
+func (m *loadMonitor) overloaded() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.reason
+}
+
+func (m *loadMonitor) sample() string {
+	sent := atomic.LoadUint64(&m.sent)
+	dropped := atomic.LoadUint64(&m.dropped)
+	deltaSent, deltaDropped := sent-m.lastSent, dropped-m.lastDropped
+	m.lastSent, m.lastDropped = sent, dropped
+
+	if m.thresholds.DropRate > 0 && deltaSent+deltaDropped > 0 {
+		rate := float64(deltaDropped) / float64(deltaSent+deltaDropped)
+		if rate > m.thresholds.DropRate {
+			return rejectedDropRate
+		}
+	}
+
+	if m.thresholds.HeapBytes > 0 {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		if ms.HeapAlloc > m.thresholds.HeapBytes {
+			return rejectedHeap
+		}
+	}
+
+	if m.thresholds.Goroutines > 0 && runtime.NumGoroutine() > m.thresholds.Goroutines {
+		return rejectedGoroutines
+	}
+
+	return ""
+}
+
+// retryAfter returns the number of seconds a rejected subscriber should
+// wait, rounded up.
+func (m *loadMonitor) retryAfter() int64 {
+	return int64((m.thresholds.RetryAfter + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,103 @@
+package egress_test
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admission", func() {
+	request := &loggregator_v2.EgressBatchRequest{
+		Selectors: []*loggregator_v2.Selector{
+			{
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	}
+
+	newServer := func(r egress.Receiver, batchSize int, t egress.AdmissionThresholds) *egress.Server {
+		return egress.NewServer(
+			r,
+			testhelper.NewMetricClient(),
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			batchSize,
+			time.Nanosecond,
+			egress.WithAdmissionThresholds(t),
+		)
+	}
+
+	DescribeTable("rejects new streams above a threshold", func(t egress.AdmissionThresholds) {
+		server := newServer(&listReceiver{}, 100, t)
+
+		err := server.BatchedReceiver(request, newSpyBatchedReceiverServer(nil))
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+
+		err = server.Receiver(&loggregator_v2.EgressRequest{
+			Selectors: request.Selectors,
+		}, newSpyReceiverServer(nil))
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+	},
+		Entry("goroutines", egress.AdmissionThresholds{Goroutines: 1}),
+		Entry("heap", egress.AdmissionThresholds{HeapBytes: 1}),
+	)
+
+	It("admits streams below the thresholds", func() {
+		server := newServer(&listReceiver{}, 100, egress.AdmissionThresholds{
+			Goroutines: 1000000,
+			HeapBytes:  1 << 40,
+			DropRate:   0.5,
+		})
+
+		Expect(server.BatchedReceiver(request, newSpyBatchedReceiverServer(nil))).To(Succeed())
+	})
+
+	It("rejects new streams while envelopes are dropped", func() {
+		receiver := newSpyReceiver(1000000)
+		defer receiver.stop()
+		server := newServer(&switchingReceiver{
+			first: receiver,
+			rest:  &listReceiver{},
+		}, 1, egress.AdmissionThresholds{
+			DropRate: 0.5,
+			Interval: time.Millisecond,
+		})
+
+		slow := newSpyBatchedReceiverServer(nil)
+		slow.delay = 100 * time.Millisecond
+		go server.BatchedReceiver(request, slow)
+
+		Eventually(func() codes.Code {
+			err := server.BatchedReceiver(request, newSpyBatchedReceiverServer(nil))
+			return status.Code(err)
+		}, 3).Should(Equal(codes.Unavailable))
+	})
+})
+
+// switchingReceiver subscribes the first stream to one receiver and any
+// later stream to another.
+type switchingReceiver struct {
+	first, rest egress.Receiver
+	subscribed  int32
+}
+
+func (r *switchingReceiver) Subscribe(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (func() (*loggregator_v2.Envelope, error), error) {
+	if atomic.AddInt32(&r.subscribed, 1) == 1 {
+		return r.first.Subscribe(ctx, req)
+	}
+
+	return r.rest.Subscribe(ctx, req)
+}
@@ -0,0 +1,336 @@
+package egress
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AggregateMetadataKey is the gRPC metadata key a subscriber of the batched
+// receiver uses to ask for aggregated metrics. The value is a JSON object,
+// for example:
+//
+//	{"window": "10s", "tags": ["deployment", "job"]}
+//
+// Counters and gauges are grouped by source ID, name and the values of the
+// given tags and one envelope is sent per group and window. A counter sums
+// the deltas and the last totals of the instances in its group that
+// reported within the window. Instances are told apart by instance ID and
+// the tags that are not grouped on. A gauge reports the
+// last, min, max and mean value of each metric as the metrics <name>,
+// <name>.min, <name>.max and <name>.mean. Other envelopes are sent
+// unchanged.
+const AggregateMetadataKey = "loggregator-aggregate"
+
+const (
+	minAggregateWindow = time.Second
+	maxAggregateWindow = 5 * time.Minute
+	maxAggregateTags   = 16
+
+	// maxAggregateGroups bounds the memory used by the aggregation of a
+	// stream. Envelopes of groups beyond the limit are dropped. It also
+	// bounds the counter instances a stream keeps totals for.
+	maxAggregateGroups = 10000
+)
+
+type aggregateExpression struct {
+	Window string   `json:"window"`
+	Tags   []string `json:"tags"`
+}
+
+// aggregator sums counters and summarizes gauges of a stream over a window.
+type aggregator struct {
+	window       time.Duration
+	tags         []string
+	usePreferred bool
+
+	counters  map[string]*counterAggregate
+	gauges    map[string]*gaugeAggregate
+	instances int
+}
+
+type counterAggregate struct {
+	sourceID string
+	name     string
+	tags     []string
+	delta    uint64
+
+	// totals holds the last total of each instance in the group so that a
+	// counter that resets only affects its own instance.
+	totals map[string]uint64
+}
+
+type gaugeAggregate struct {
+	sourceID string
+	name     string
+	unit     string
+	tags     []string
+	last     float64
+	min      float64
+	max      float64
+	sum      float64
+	count    int
+}
+
+// aggregatorFromContext returns the aggregator asked for with the request of
+// the given context. It returns nil if there is none and an InvalidArgument
+// error if the expression is invalid.
+func aggregatorFromContext(ctx context.Context, usePreferred bool) (*aggregator, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[AggregateMetadataKey]) == 0 || md[AggregateMetadataKey][0] == "" {
+		return nil, nil
+	}
+
+	a, err := parseAggregator(md[AggregateMetadataKey][0], usePreferred)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid aggregation: %s", err)
+	}
+
+	return a, nil
+}
+
+func parseAggregator(expr string, usePreferred bool) (*aggregator, error) {
+	if len(expr) > maxFilterBytes {
+		return nil, fmt.Errorf("aggregation exceeds %d bytes", maxFilterBytes)
+	}
+
+	var ae aggregateExpression
+	if err := json.Unmarshal([]byte(expr), &ae); err != nil {
+		return nil, err
+	}
+
+	window, err := time.ParseDuration(ae.Window)
+	if err != nil {
+		return nil, err
+	}
+	if window < minAggregateWindow || window > maxAggregateWindow {
+		return nil, fmt.Errorf("window must be between %s and %s", minAggregateWindow, maxAggregateWindow)
+	}
+
+	if len(ae.Tags) > maxAggregateTags {
+		return nil, fmt.Errorf("more than %d tags", maxAggregateTags)
+	}
+
+	return &aggregator{
+		window:       window,
+		tags:         ae.Tags,
+		usePreferred: usePreferred,
+		counters:     make(map[string]*counterAggregate),
+		gauges:       make(map[string]*gaugeAggregate),
+	}, nil
+}
+
+// aggregatable reports whether the envelope is aggregated rather than sent
+// unchanged.
+func aggregatable(e *loggregator_v2.Envelope) bool {
+	return e.GetCounter() != nil || e.GetGauge() != nil
+}
+
+// add adds a counter or gauge envelope to its groups. It returns false if
+// the envelope was dropped because the stream has too many groups.
+func (a *aggregator) add(e *loggregator_v2.Envelope) bool {
+	tags := make([]string, len(a.tags))
+	for i, t := range a.tags {
+		tags[i], _ = tagValue(e, t)
+	}
+
+	if c := e.GetCounter(); c != nil {
+		key := a.key(e.GetSourceId(), c.GetName(), tags)
+		instance := a.instanceKey(e)
+		ca, ok := a.counters[key]
+		seen := false
+		if ok {
+			_, seen = ca.totals[instance]
+		}
+		if !seen && a.instances >= maxAggregateGroups {
+			return false
+		}
+		if !ok {
+			if a.full() {
+				return false
+			}
+			ca = &counterAggregate{
+				sourceID: e.GetSourceId(),
+				name:     c.GetName(),
+				tags:     tags,
+				totals:   make(map[string]uint64),
+			}
+			a.counters[key] = ca
+		}
+		if !seen {
+			a.instances++
+		}
+
+		ca.delta += c.GetDelta()
+		ca.totals[instance] = c.GetTotal()
+
+		return true
+	}
+
+	added := true
+	for name, v := range e.GetGauge().GetMetrics() {
+		key := a.key(e.GetSourceId(), name, tags)
+		ga, ok := a.gauges[key]
+		if !ok {
+			if a.full() {
+				added = false
+				continue
+			}
+			ga = &gaugeAggregate{
+				sourceID: e.GetSourceId(),
+				name:     name,
+				unit:     v.GetUnit(),
+				tags:     tags,
+				min:      v.GetValue(),
+				max:      v.GetValue(),
+			}
+			a.gauges[key] = ga
+		}
+
+		value := v.GetValue()
+		ga.last = value
+		ga.sum += value
+		ga.count++
+		if value < ga.min {
+			ga.min = value
+		}
+		if value > ga.max {
+			ga.max = value
+		}
+	}
+
+	return added
+}
+
+// flush returns one envelope per group and starts a new window.
+func (a *aggregator) flush() []*loggregator_v2.Envelope {
+	now := time.Now().UnixNano()
+	envs := make([]*loggregator_v2.Envelope, 0, len(a.counters)+len(a.gauges))
+
+	counterKeys := make([]string, 0, len(a.counters))
+	for k := range a.counters {
+		counterKeys = append(counterKeys, k)
+	}
+	sort.Strings(counterKeys)
+
+	for _, key := range counterKeys {
+		ca := a.counters[key]
+
+		var total uint64
+		for _, t := range ca.totals {
+			total += t
+		}
+
+		e := &loggregator_v2.Envelope{
+			Timestamp: now,
+			SourceId:  ca.sourceID,
+			Message: &loggregator_v2.Envelope_Counter{
+				Counter: &loggregator_v2.Counter{
+					Name:  ca.name,
+					Delta: ca.delta,
+					Total: total,
+				},
+			},
+		}
+		a.setTags(e, ca.tags)
+		envs = append(envs, e)
+	}
+
+	gaugeKeys := make([]string, 0, len(a.gauges))
+	for k := range a.gauges {
+		gaugeKeys = append(gaugeKeys, k)
+	}
+	sort.Strings(gaugeKeys)
+
+	for _, key := range gaugeKeys {
+		ga := a.gauges[key]
+		e := &loggregator_v2.Envelope{
+			Timestamp: now,
+			SourceId:  ga.sourceID,
+			Message: &loggregator_v2.Envelope_Gauge{
+				Gauge: &loggregator_v2.Gauge{
+					Metrics: map[string]*loggregator_v2.GaugeValue{
+						ga.name:           {Unit: ga.unit, Value: ga.last},
+						ga.name + ".min":  {Unit: ga.unit, Value: ga.min},
+						ga.name + ".max":  {Unit: ga.unit, Value: ga.max},
+						ga.name + ".mean": {Unit: ga.unit, Value: ga.sum / float64(ga.count)},
+					},
+				},
+			},
+		}
+		a.setTags(e, ga.tags)
+		envs = append(envs, e)
+	}
+
+	a.counters = make(map[string]*counterAggregate)
+	a.gauges = make(map[string]*gaugeAggregate)
+	a.instances = 0
+
+	return envs
+}
+
+func (a *aggregator) full() bool {
+	return len(a.counters)+len(a.gauges) >= maxAggregateGroups
+}
+
+func (a *aggregator) key(sourceID, name string, tags []string) string {
+	return sourceID + "\xff" + name + "\xff" + strings.Join(tags, "\xff")
+}
+
+// instanceKey identifies the instance that sent the envelope within its
+// group by the instance ID and the tags that are not grouped on.
+func (a *aggregator) instanceKey(e *loggregator_v2.Envelope) string {
+	grouped := make(map[string]bool, len(a.tags))
+	for _, t := range a.tags {
+		grouped[t] = true
+	}
+
+	var pairs []string
+	for name := range e.GetTags() {
+		if !grouped[name] {
+			v, _ := tagValue(e, name)
+			pairs = append(pairs, name+"="+v)
+		}
+	}
+	for name := range e.GetDeprecatedTags() {
+		if _, ok := e.GetTags()[name]; !ok && !grouped[name] {
+			v, _ := tagValue(e, name)
+			pairs = append(pairs, name+"="+v)
+		}
+	}
+	sort.Strings(pairs)
+
+	return e.GetInstanceId() + "\xff" + strings.Join(pairs, "\xff")
+}
+
+// setTags sets the group tags on the envelope the same way convergeTags
+// would for the stream.
+func (a *aggregator) setTags(e *loggregator_v2.Envelope, values []string) {
+	if a.usePreferred {
+		e.Tags = make(map[string]string, len(a.tags))
+	} else {
+		e.DeprecatedTags = make(map[string]*loggregator_v2.Value, len(a.tags))
+	}
+
+	for i, t := range a.tags {
+		if values[i] == "" {
+			continue
+		}
+
+		if a.usePreferred {
+			e.Tags[t] = values[i]
+			continue
+		}
+		e.DeprecatedTags[t] = &loggregator_v2.Value{
+			Data: &loggregator_v2.Value_Text{Text: values[i]},
+		}
+	}
+}
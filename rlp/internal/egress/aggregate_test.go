@@ -0,0 +1,256 @@
+package egress_test
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Aggregation", func() {
+	var (
+		metricClient *testhelper.SpyMetricClient
+		srv          *spyBatchedReceiverServer
+	)
+
+	BeforeEach(func() {
+		metricClient = testhelper.NewMetricClient()
+		srv = newSpyBatchedReceiverServer(nil)
+	})
+
+	request := &loggregator_v2.EgressBatchRequest{
+		UsePreferredTags: true,
+		Selectors: []*loggregator_v2.Selector{
+			{
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	}
+
+	newServer := func(envs ...*loggregator_v2.Envelope) *egress.Server {
+		return egress.NewServer(
+			&listReceiver{envelopes: envs},
+			metricClient,
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+		)
+	}
+
+	withAggregation := func(expr string) context.Context {
+		return metadata.NewIncomingContext(
+			context.Background(),
+			metadata.Pairs(egress.AggregateMetadataKey, expr),
+		)
+	}
+
+	received := func() []*loggregator_v2.Envelope {
+		var envs []*loggregator_v2.Envelope
+		for {
+			select {
+			case e := <-srv.envelopes:
+				envs = append(envs, e)
+			default:
+				return envs
+			}
+		}
+	}
+
+	It("sums counters per source ID, name and tags", func() {
+		server := newServer(
+			counterEnvelope("src", "requests", 1, 10, map[string]string{"job": "router", "index": "0"}),
+			counterEnvelope("src", "requests", 2, 12, map[string]string{"job": "router", "index": "1"}),
+			counterEnvelope("src", "requests", 3, 15, map[string]string{"job": "router", "index": "0"}),
+			counterEnvelope("src", "requests", 5, 5, map[string]string{"job": "cell"}),
+		)
+		srv.ctx = withAggregation(`{"window": "10s", "tags": ["job"]}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(2))
+
+		Expect(envs[0].GetTags()).To(Equal(map[string]string{"job": "cell"}))
+		Expect(envs[0].GetCounter().GetDelta()).To(Equal(uint64(5)))
+
+		Expect(envs[1].GetSourceId()).To(Equal("src"))
+		Expect(envs[1].GetTags()).To(Equal(map[string]string{"job": "router"}))
+		Expect(envs[1].GetCounter().GetName()).To(Equal("requests"))
+		Expect(envs[1].GetCounter().GetDelta()).To(Equal(uint64(6)))
+		Expect(envs[1].GetCounter().GetTotal()).To(Equal(uint64(27)))
+
+		Expect(metricClient.GetDelta("aggregated")).To(Equal(uint64(4)))
+	})
+
+	It("sums the totals of the instances regardless of arrival order", func() {
+		server := newServer(
+			counterEnvelope("src", "requests", 2, 12, map[string]string{"job": "router", "index": "1"}),
+			counterEnvelope("src", "requests", 1, 10, map[string]string{"job": "router", "index": "0"}),
+			counterEnvelope("src", "requests", 3, 15, map[string]string{"job": "router", "index": "0"}),
+		)
+		srv.ctx = withAggregation(`{"window": "10s", "tags": ["job"]}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetCounter().GetDelta()).To(Equal(uint64(6)))
+		Expect(envs[0].GetCounter().GetTotal()).To(Equal(uint64(27)))
+	})
+
+	It("keeps the last total of a counter when it goes down", func() {
+		server := newServer(
+			counterEnvelope("src", "requests", 1, 100, map[string]string{"job": "router"}),
+			counterEnvelope("src", "requests", 2, 2, map[string]string{"job": "router"}),
+		)
+		srv.ctx = withAggregation(`{"window": "10s", "tags": ["job"]}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(1))
+		Expect(envs[0].GetCounter().GetDelta()).To(Equal(uint64(3)))
+		Expect(envs[0].GetCounter().GetTotal()).To(Equal(uint64(2)))
+	})
+
+	It("summarizes gauges per metric", func() {
+		server := newServer(
+			gaugeEnvelope("src", "cpu", 2),
+			gaugeEnvelope("src", "cpu", 6),
+			gaugeEnvelope("src", "cpu", 1),
+		)
+		srv.ctx = withAggregation(`{"window": "10s"}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(1))
+
+		metrics := envs[0].GetGauge().GetMetrics()
+		Expect(metrics).To(HaveLen(4))
+		Expect(metrics["cpu"].GetValue()).To(Equal(1.0))
+		Expect(metrics["cpu.min"].GetValue()).To(Equal(1.0))
+		Expect(metrics["cpu.max"].GetValue()).To(Equal(6.0))
+		Expect(metrics["cpu.mean"].GetValue()).To(Equal(3.0))
+		Expect(metrics["cpu.mean"].GetUnit()).To(Equal("percent"))
+	})
+
+	It("sends other envelopes unchanged", func() {
+		server := newServer(
+			logEnvelope("some-log", nil),
+			counterEnvelope("src", "requests", 1, 1, nil),
+			logEnvelope("other-log", nil),
+		)
+		srv.ctx = withAggregation(`{"window": "10s"}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(3))
+		Expect(string(envs[0].GetLog().GetPayload())).To(Equal("some-log"))
+		Expect(string(envs[1].GetLog().GetPayload())).To(Equal("other-log"))
+		Expect(envs[2].GetCounter().GetName()).To(Equal("requests"))
+	})
+
+	It("sends the aggregates every window", func() {
+		receiver := newSpyReceiver(1 << 30)
+		receiver.envelope = counterEnvelope("src", "requests", 1, 0, nil)
+		defer receiver.stop()
+
+		server := egress.NewServer(
+			receiver,
+			metricClient,
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+		)
+		ctx, cancel := context.WithCancel(withAggregation(`{"window": "1s"}`))
+		defer cancel()
+		srv.ctx = ctx
+
+		go server.BatchedReceiver(request, srv)
+
+		var e *loggregator_v2.Envelope
+		Eventually(srv.envelopes, 3).Should(Receive(&e))
+		Expect(e.GetCounter().GetDelta()).To(BeNumerically(">", 1))
+	})
+
+	DescribeTable("rejects invalid aggregations", func(expr string) {
+		srv.ctx = withAggregation(expr)
+
+		err := newServer().BatchedReceiver(request, srv)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	},
+		Entry("malformed JSON", `{"window":`),
+		Entry("missing window", `{"tags": ["job"]}`),
+		Entry("short window", `{"window": "100ms"}`),
+		Entry("long window", `{"window": "1h"}`),
+		Entry("too many tags", `{"window": "10s", "tags": [
+			"a", "b", "c", "d", "e", "f", "g", "h", "i",
+			"j", "k", "l", "m", "n", "o", "p", "q"
+		]}`),
+	)
+
+	It("requires the batched receiver", func() {
+		rs := newSpyReceiverServer(nil)
+		rs.ctx = withAggregation(`{"window": "10s"}`)
+
+		err := newServer().Receiver(&loggregator_v2.EgressRequest{
+			Selectors: request.Selectors,
+		}, rs)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(err).To(MatchError(ContainSubstring("aggregation requires the batched receiver")))
+	})
+
+	It("reports invalid aggregations on the receiver as they are", func() {
+		rs := newSpyReceiverServer(nil)
+		rs.ctx = withAggregation(`{"window": "1h"}`)
+
+		err := newServer().Receiver(&loggregator_v2.EgressRequest{
+			Selectors: request.Selectors,
+		}, rs)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(err).To(MatchError(ContainSubstring("invalid aggregation")))
+	})
+})
+
+func counterEnvelope(sourceID, name string, delta, total uint64, tags map[string]string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Tags:     tags,
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{
+				Name:  name,
+				Delta: delta,
+				Total: total,
+			},
+		},
+	}
+}
+
+func gaugeEnvelope(sourceID, name string, value float64) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Envelope_Gauge{
+			Gauge: &loggregator_v2.Gauge{
+				Metrics: map[string]*loggregator_v2.GaugeValue{
+					name: {Unit: "percent", Value: value},
+				},
+			},
+		},
+	}
+}
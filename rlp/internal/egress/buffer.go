@@ -0,0 +1,42 @@
+package egress
+
+import (
+	"strconv"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// BufferSizeMetadataKey is the gRPC metadata key a subscriber uses to ask
+// for the number of envelopes buffered for its stream. A small buffer drops
+// envelopes sooner when the subscriber falls behind, a large one holds more
+// envelopes at the cost of latency and memory. The size is clamped to the
+// bounds configured with WithBufferSizeBounds.
+const BufferSizeMetadataKey = "loggregator-buffer-size"
+
+// bufferSize returns the size of the envelope buffer for the stream of the
+// given context. It returns an InvalidArgument error if the requested size
+// is not a positive integer.
+func (s *Server) bufferSize(ctx context.Context) (int, error) {
+	size := envelopeBufferSize
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok && len(md[BufferSizeMetadataKey]) > 0 && md[BufferSizeMetadataKey][0] != "" {
+		n, err := strconv.Atoi(md[BufferSizeMetadataKey][0])
+		if err != nil || n <= 0 {
+			return 0, status.Errorf(codes.InvalidArgument, "invalid buffer size: %q", md[BufferSizeMetadataKey][0])
+		}
+		size = n
+	}
+
+	if size < s.minBufferSize {
+		size = s.minBufferSize
+	}
+	if s.maxBufferSize > 0 && size > s.maxBufferSize {
+		size = s.maxBufferSize
+	}
+
+	return size, nil
+}
@@ -0,0 +1,109 @@
+package egress_test
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buffer size", func() {
+	var (
+		metricClient *testhelper.SpyMetricClient
+		srv          *spyReceiverServer
+	)
+
+	BeforeEach(func() {
+		metricClient = testhelper.NewMetricClient()
+		srv = newSpyReceiverServer(nil)
+		srv.wait = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		srv.stopWait()
+	})
+
+	request := &loggregator_v2.EgressRequest{
+		Selectors: []*loggregator_v2.Selector{
+			{
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	}
+
+	newServer := func(envelopeCount int, opts ...egress.ServerOption) *egress.Server {
+		envs := make([]*loggregator_v2.Envelope, envelopeCount)
+		for i := range envs {
+			envs[i] = logEnvelope("some-log", nil)
+		}
+
+		return egress.NewServer(
+			&listReceiver{envelopes: envs},
+			metricClient,
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+			opts...,
+		)
+	}
+
+	withBufferSize := func(size string) context.Context {
+		return metadata.NewIncomingContext(
+			context.Background(),
+			metadata.Pairs(egress.BufferSizeMetadataKey, size),
+		)
+	}
+
+	It("drops envelopes once the requested buffer is full", func() {
+		srv.ctx = withBufferSize("2")
+
+		go newServer(10).Receiver(request, srv)
+
+		// One envelope is being sent and two are buffered.
+		Eventually(func() uint64 {
+			return metricClient.GetDelta("dropped")
+		}).Should(BeNumerically(">=", 7))
+	})
+
+	It("buffers 10000 envelopes by default", func() {
+		go newServer(100).Receiver(request, srv)
+
+		Consistently(func() uint64 {
+			return metricClient.GetDelta("dropped")
+		}).Should(BeZero())
+	})
+
+	It("clamps the requested size to the bounds", func() {
+		srv.ctx = withBufferSize("1000")
+
+		go newServer(10, egress.WithBufferSizeBounds(1, 4)).Receiver(request, srv)
+
+		Eventually(func() uint64 {
+			return metricClient.GetDelta("dropped")
+		}).Should(BeNumerically(">=", 5))
+	})
+
+	DescribeTable("rejects invalid sizes", func(size string) {
+		srv.ctx = withBufferSize(size)
+
+		err := newServer(0).Receiver(request, srv)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	},
+		Entry("not a number", "large"),
+		Entry("zero", "0"),
+		Entry("negative", "-5"),
+	)
+})
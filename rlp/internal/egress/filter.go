@@ -0,0 +1,168 @@
+package egress
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// FilterMetadataKey is the gRPC metadata key a subscriber uses to pass a
+// filter expression with its request. The expression is a JSON object, for
+// example:
+//
+//	{
+//	  "include_tags": {"deployment": "cf"},
+//	  "exclude_tags": {"origin": "gorouter"},
+//	  "include_payload": "ERROR|FATAL",
+//	  "exclude_payload": "healthcheck"
+//	}
+//
+// An envelope is sent only if it has every include tag, none of the exclude
+// tags, and, for logs, a payload that matches include_payload and does not
+// match exclude_payload. Payloads are matched with RE2 regular expressions.
+const FilterMetadataKey = "loggregator-filter"
+
+const (
+	maxFilterBytes      = 4096
+	maxFilterTags       = 32
+	maxFilterRegexBytes = 1024
+
+	// maxFilterPayloadBytes bounds the part of a log payload that is
+	// matched so the cost of a regex is bounded for each envelope.
+	maxFilterPayloadBytes = 64 * 1024
+)
+
+type filterExpression struct {
+	IncludeTags    map[string]string `json:"include_tags"`
+	ExcludeTags    map[string]string `json:"exclude_tags"`
+	IncludePayload string            `json:"include_payload"`
+	ExcludePayload string            `json:"exclude_payload"`
+}
+
+// envelopeFilter decides which envelopes are sent to a subscriber.
+type envelopeFilter struct {
+	includeTags    map[string]string
+	excludeTags    map[string]string
+	includePayload *regexp.Regexp
+	excludePayload *regexp.Regexp
+}
+
+// filterFromContext returns the filter passed with the request of the given
+// context. It returns nil if there is none and an InvalidArgument error if
+// the filter is invalid.
+func filterFromContext(ctx context.Context) (*envelopeFilter, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[FilterMetadataKey]) == 0 || md[FilterMetadataKey][0] == "" {
+		return nil, nil
+	}
+
+	f, err := parseFilter(md[FilterMetadataKey][0])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid filter: %s", err)
+	}
+
+	return f, nil
+}
+
+func parseFilter(expr string) (*envelopeFilter, error) {
+	if len(expr) > maxFilterBytes {
+		return nil, fmt.Errorf("filter exceeds %d bytes", maxFilterBytes)
+	}
+
+	var fe filterExpression
+	if err := json.Unmarshal([]byte(expr), &fe); err != nil {
+		return nil, err
+	}
+
+	if len(fe.IncludeTags)+len(fe.ExcludeTags) > maxFilterTags {
+		return nil, fmt.Errorf("filter has more than %d tags", maxFilterTags)
+	}
+
+	f := &envelopeFilter{
+		includeTags: fe.IncludeTags,
+		excludeTags: fe.ExcludeTags,
+	}
+
+	var err error
+	if f.includePayload, err = compileFilterRegex(fe.IncludePayload); err != nil {
+		return nil, err
+	}
+	if f.excludePayload, err = compileFilterRegex(fe.ExcludePayload); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func compileFilterRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if len(expr) > maxFilterRegexBytes {
+		return nil, fmt.Errorf("payload regex exceeds %d bytes", maxFilterRegexBytes)
+	}
+
+	return regexp.Compile(expr)
+}
+
+// allow reports whether the envelope should be sent. A nil filter allows
+// every envelope.
+func (f *envelopeFilter) allow(e *loggregator_v2.Envelope) bool {
+	if f == nil {
+		return true
+	}
+
+	for k, v := range f.includeTags {
+		if value, ok := tagValue(e, k); !ok || value != v {
+			return false
+		}
+	}
+	for k, v := range f.excludeTags {
+		if value, ok := tagValue(e, k); ok && value == v {
+			return false
+		}
+	}
+
+	log := e.GetLog()
+	if log == nil {
+		return true
+	}
+
+	payload := log.GetPayload()
+	if len(payload) > maxFilterPayloadBytes {
+		payload = payload[:maxFilterPayloadBytes]
+	}
+	if f.includePayload != nil && !f.includePayload.Match(payload) {
+		return false
+	}
+	if f.excludePayload != nil && f.excludePayload.Match(payload) {
+		return false
+	}
+
+	return true
+}
+
+func tagValue(e *loggregator_v2.Envelope, name string) (string, bool) {
+	if v, ok := e.GetTags()[name]; ok {
+		return v, true
+	}
+
+	if v, ok := e.GetDeprecatedTags()[name]; ok {
+		switch x := v.Data.(type) {
+		case *loggregator_v2.Value_Text:
+			return x.Text, true
+		case *loggregator_v2.Value_Decimal:
+			return fmt.Sprint(x.Decimal), true
+		case *loggregator_v2.Value_Integer:
+			return fmt.Sprint(x.Integer), true
+		}
+	}
+
+	return "", false
+}
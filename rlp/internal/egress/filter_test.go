@@ -0,0 +1,165 @@
+package egress_test
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filters", func() {
+	var (
+		metricClient *testhelper.SpyMetricClient
+		server       *egress.Server
+		srv          *spyBatchedReceiverServer
+	)
+
+	BeforeEach(func() {
+		metricClient = testhelper.NewMetricClient()
+		server = egress.NewServer(
+			&listReceiver{envelopes: []*loggregator_v2.Envelope{
+				logEnvelope("ERROR: disk full", map[string]string{"origin": "cell"}),
+				logEnvelope("INFO: ok", map[string]string{"origin": "cell"}),
+				logEnvelope("ERROR: bad request", map[string]string{"origin": "gorouter"}),
+				{
+					Tags: map[string]string{"origin": "cell"},
+					Message: &loggregator_v2.Envelope_Counter{
+						Counter: &loggregator_v2.Counter{Name: "requests"},
+					},
+				},
+			}},
+			metricClient,
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+		)
+		srv = newSpyBatchedReceiverServer(nil)
+	})
+
+	request := &loggregator_v2.EgressBatchRequest{
+		Selectors: []*loggregator_v2.Selector{
+			{
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	}
+
+	withFilter := func(filter string) context.Context {
+		return metadata.NewIncomingContext(
+			context.Background(),
+			metadata.Pairs(egress.FilterMetadataKey, filter),
+		)
+	}
+
+	received := func() []*loggregator_v2.Envelope {
+		var envs []*loggregator_v2.Envelope
+		for {
+			select {
+			case e := <-srv.envelopes:
+				envs = append(envs, e)
+			default:
+				return envs
+			}
+		}
+	}
+
+	It("sends only envelopes that pass the filter", func() {
+		srv.ctx = withFilter(`{
+			"include_payload": "ERROR|FATAL",
+			"exclude_tags": {"origin": "gorouter"}
+		}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(2))
+		Expect(string(envs[0].GetLog().GetPayload())).To(Equal("ERROR: disk full"))
+		Expect(envs[1].GetCounter().GetName()).To(Equal("requests"))
+		Expect(metricClient.GetDelta("filtered")).To(Equal(uint64(2)))
+	})
+
+	It("sends only envelopes with the included tags", func() {
+		srv.ctx = withFilter(`{"include_tags": {"origin": "gorouter"}}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		envs := received()
+		Expect(envs).To(HaveLen(1))
+		Expect(string(envs[0].GetLog().GetPayload())).To(Equal("ERROR: bad request"))
+	})
+
+	It("excludes log payloads that match", func() {
+		srv.ctx = withFilter(`{"exclude_payload": "^INFO"}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		Expect(received()).To(HaveLen(3))
+	})
+
+	It("sends every envelope without a filter", func() {
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		Expect(received()).To(HaveLen(4))
+		Expect(metricClient.GetDelta("filtered")).To(BeZero())
+	})
+
+	DescribeTable("rejects invalid filters", func(filter string) {
+		srv.ctx = withFilter(filter)
+
+		err := server.BatchedReceiver(request, srv)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	},
+		Entry("malformed JSON", `{"include_payload":`),
+		Entry("invalid regex", `{"include_payload": "(ERROR"}`),
+		Entry("unsupported regex", `{"include_payload": "(?=ERROR)"}`),
+		Entry("long regex", `{"include_payload": "`+longString(2000)+`"}`),
+		Entry("long filter", `{"exclude_payload": "`+longString(5000)+`"}`),
+	)
+})
+
+type listReceiver struct {
+	envelopes []*loggregator_v2.Envelope
+}
+
+func (r *listReceiver) Subscribe(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (func() (*loggregator_v2.Envelope, error), error) {
+	envs := r.envelopes
+	return func() (*loggregator_v2.Envelope, error) {
+		if len(envs) == 0 {
+			return nil, io.EOF
+		}
+		e := envs[0]
+		envs = envs[1:]
+		return e, nil
+	}, nil
+}
+
+func logEnvelope(payload string, tags map[string]string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		Tags: tags,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{Payload: []byte(payload)},
+		},
+	}
+}
+
+func longString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = 'a'
+	}
+	return string(b)
+}
@@ -0,0 +1,166 @@
+package egress
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+const (
+	// lagBuckets are exponential bounds from 1ms to 2^16ms (about 65s) and
+	// a final bucket for anything above.
+	lagBuckets = 18
+
+	// maxLagShards bounds the shard IDs lag is tracked for. Streams of
+	// further shard IDs are tracked as lagOverflowShard.
+	maxLagShards     = 1000
+	lagOverflowShard = "other"
+
+	defaultLagInterval = time.Minute
+)
+
+// StreamLag holds the percentiles of the time from the timestamp of an
+// envelope until it was sent to a subscriber.
+type StreamLag struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+type lagCounts [lagBuckets]uint64
+
+// lagTracker counts the lag of sent envelopes per shard ID. Lag is reported
+// for the last complete interval so that it reflects recent behavior.
+type lagTracker struct {
+	interval time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	current  map[string]*lagCounts
+	previous map[string]*lagCounts
+}
+
+func newLagTracker(interval time.Duration) *lagTracker {
+	return &lagTracker{
+		interval: interval,
+		start:    time.Now(),
+		current:  make(map[string]*lagCounts),
+		previous: make(map[string]*lagCounts),
+	}
+}
+
+// observe records the lag of the given envelopes sent at now. Envelopes
+// without a timestamp are ignored.
+func (t *lagTracker) observe(shardID string, now time.Time, envs ...*loggregator_v2.Envelope) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rotate(now)
+
+	counts, ok := t.current[shardID]
+	if !ok {
+		if len(t.current) >= maxLagShards {
+			shardID = lagOverflowShard
+		}
+		counts, ok = t.current[shardID]
+		if !ok {
+			counts = &lagCounts{}
+			t.current[shardID] = counts
+		}
+	}
+
+	for _, e := range envs {
+		if e.GetTimestamp() == 0 {
+			continue
+		}
+
+		counts[lagBucket(now.Sub(time.Unix(0, e.GetTimestamp())))]++
+	}
+}
+
+// lag returns the lag percentiles of each shard ID over the last complete
+// interval.
+func (t *lagTracker) lag(now time.Time) map[string]StreamLag {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rotate(now)
+
+	lag := make(map[string]StreamLag, len(t.previous))
+	for shardID, counts := range t.previous {
+		lag[shardID] = StreamLag{
+			P50: counts.percentile(50),
+			P95: counts.percentile(95),
+			P99: counts.percentile(99),
+		}
+	}
+
+	return lag
+}
+
+func (t *lagTracker) rotate(now time.Time) {
+	elapsed := now.Sub(t.start)
+	if elapsed < t.interval {
+		return
+	}
+
+	t.previous = t.current
+	if elapsed >= 2*t.interval {
+		// Nothing was sent during the last complete interval.
+		t.previous = make(map[string]*lagCounts)
+	}
+	t.current = make(map[string]*lagCounts)
+	t.start = t.start.Add(elapsed / t.interval * t.interval)
+}
+
+// percentile returns the upper bound of the bucket that holds the given
+// percentile (0-100). Lag above the largest bound is reported as the
+// largest bound.
+func (c *lagCounts) percentile(p float64) time.Duration {
+	var count uint64
+	for _, n := range c {
+		count += n
+	}
+	if count == 0 {
+		return 0
+	}
+
+	rank := uint64(p / 100 * float64(count))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for i, n := range c {
+		cumulative += n
+		if cumulative >= rank {
+			return lagBound(i)
+		}
+	}
+
+	return lagBound(lagBuckets - 1)
+}
+
+func lagBucket(lag time.Duration) int {
+	ms := lag / time.Millisecond
+	if ms <= 1 {
+		return 0
+	}
+
+	i := bits.Len64(uint64(ms - 1))
+	if i >= lagBuckets {
+		return lagBuckets - 1
+	}
+
+	return i
+}
+
+func lagBound(i int) time.Duration {
+	if i >= lagBuckets-1 {
+		i = lagBuckets - 2
+	}
+
+	return time.Duration(1<<uint(i)) * time.Millisecond
+}
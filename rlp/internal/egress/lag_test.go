@@ -0,0 +1,67 @@
+package egress_test
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StreamLag", func() {
+	It("reports the lag of each shard ID over the last interval", func() {
+		sent := time.Now().Add(-200 * time.Millisecond).UnixNano()
+		server := egress.NewServer(
+			&listReceiver{envelopes: []*loggregator_v2.Envelope{
+				timestampedEnvelope("a", sent),
+				timestampedEnvelope("a", sent),
+				timestampedEnvelope("b", sent),
+			}},
+			testhelper.NewMetricClient(),
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+			egress.WithLagInterval(100*time.Millisecond),
+		)
+
+		err := server.BatchedReceiver(&loggregator_v2.EgressBatchRequest{
+			ShardId: "some-shard",
+			Selectors: []*loggregator_v2.Selector{
+				{
+					Message: &loggregator_v2.Selector_Log{
+						Log: &loggregator_v2.LogSelector{},
+					},
+				},
+			},
+		}, newSpyBatchedReceiverServer(nil))
+		Expect(err).ToNot(HaveOccurred())
+
+		var lag map[string]egress.StreamLag
+		Eventually(func() map[string]egress.StreamLag {
+			lag = server.StreamLag()
+			return lag
+		}).Should(HaveKey("some-shard"))
+
+		Expect(lag["some-shard"].P50).To(Equal(256 * time.Millisecond))
+		Expect(lag["some-shard"].P99).To(Equal(256 * time.Millisecond))
+	})
+
+	It("reports nothing before an interval completed", func() {
+		server := egress.NewServer(
+			&listReceiver{},
+			testhelper.NewMetricClient(),
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+		)
+
+		Expect(server.StreamLag()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,124 @@
+package egress
+
+import (
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// FieldsMetadataKey is the gRPC metadata key a subscriber uses to pass a
+// field mask with its request. The mask is a comma separated list of the
+// optional envelope fields to send, for example:
+//
+//	instance_id,tags.deployment,tags.job
+//
+// The fields are:
+//
+//	instance_id      the instance ID
+//	tags             every tag
+//	deprecated_tags  every deprecated tag
+//	tags.<key>       the tag or deprecated tag with the given key
+//
+// Fields that are not listed are cleared before the envelope is batched.
+// The source ID, timestamp and message are always sent.
+const FieldsMetadataKey = "loggregator-fields"
+
+const maxProjectionFields = 64
+
+// projection clears the envelope fields a subscriber did not ask for.
+type projection struct {
+	instanceID     bool
+	tags           bool
+	deprecatedTags bool
+	tagKeys        map[string]bool
+}
+
+// projectionFromContext returns the projection passed with the request of
+// the given context. It returns nil if there is none and an InvalidArgument
+// error if the field mask is invalid.
+func projectionFromContext(ctx context.Context) (*projection, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[FieldsMetadataKey]) == 0 || md[FieldsMetadataKey][0] == "" {
+		return nil, nil
+	}
+
+	p, err := parseProjection(md[FieldsMetadataKey][0])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid fields: %s", err)
+	}
+
+	return p, nil
+}
+
+func parseProjection(mask string) (*projection, error) {
+	fields := strings.Split(mask, ",")
+	if len(fields) > maxProjectionFields {
+		return nil, fmt.Errorf("more than %d fields", maxProjectionFields)
+	}
+
+	p := &projection{
+		tagKeys: make(map[string]bool),
+	}
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+
+		switch {
+		case f == "instance_id":
+			p.instanceID = true
+		case f == "tags":
+			p.tags = true
+		case f == "deprecated_tags":
+			p.deprecatedTags = true
+		case strings.HasPrefix(f, "tags.") && len(f) > len("tags."):
+			p.tagKeys[strings.TrimPrefix(f, "tags.")] = true
+		default:
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+	}
+
+	return p, nil
+}
+
+// apply clears the fields of the envelope that are not part of the
+// projection. A nil projection leaves the envelope unchanged.
+func (p *projection) apply(e *loggregator_v2.Envelope) {
+	if p == nil {
+		return
+	}
+
+	if !p.instanceID {
+		e.InstanceId = ""
+	}
+
+	for k := range e.Tags {
+		if !p.keepsTag(k, false) {
+			delete(e.Tags, k)
+		}
+	}
+
+	for k := range e.DeprecatedTags {
+		if !p.keepsTag(k, true) {
+			delete(e.DeprecatedTags, k)
+		}
+	}
+}
+
+// keepsTag reports whether the tag with the given key is sent as a tag or,
+// if deprecated is true, as a deprecated tag. A nil projection keeps every
+// tag.
+func (p *projection) keepsTag(key string, deprecated bool) bool {
+	if p == nil || p.tagKeys[key] {
+		return true
+	}
+
+	if deprecated {
+		return p.deprecatedTags
+	}
+
+	return p.tags
+}
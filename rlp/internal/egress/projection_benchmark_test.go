@@ -0,0 +1,120 @@
+package egress_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// BenchmarkFieldProjection streams firehose-like log envelopes through the
+// batched receiver and reports the encoded bytes sent per envelope for
+// different field masks.
+func BenchmarkFieldProjection(b *testing.B) {
+	for _, fields := range []string{
+		"",
+		"instance_id,tags",
+		"tags.deployment,tags.job",
+		"instance_id",
+	} {
+		b.Run(fmt.Sprintf("fields=%q", fields), func(b *testing.B) {
+			server := egress.NewServer(
+				&firehoseReceiver{count: b.N},
+				testhelper.NewMetricClient(),
+				newSpyHealthRegistrar(),
+				context.TODO(),
+				1000,
+				time.Second,
+			)
+
+			srv := &byteCountingServer{ctx: context.Background()}
+			if fields != "" {
+				srv.ctx = metadata.NewIncomingContext(
+					context.Background(),
+					metadata.Pairs(egress.FieldsMetadataKey, fields),
+				)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			err := server.BatchedReceiver(&loggregator_v2.EgressBatchRequest{
+				UsePreferredTags: true,
+				Selectors: []*loggregator_v2.Selector{
+					{
+						Message: &loggregator_v2.Selector_Log{
+							Log: &loggregator_v2.LogSelector{},
+						},
+					},
+				},
+			}, srv)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportMetric(float64(srv.bytes)/float64(b.N), "bytes/envelope")
+		})
+	}
+}
+
+// firehoseReceiver returns count log envelopes tagged like those of a Cloud
+// Foundry firehose.
+type firehoseReceiver struct {
+	count int
+}
+
+func (r *firehoseReceiver) Subscribe(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (func() (*loggregator_v2.Envelope, error), error) {
+	n := r.count
+	return func() (*loggregator_v2.Envelope, error) {
+		if n == 0 {
+			return nil, io.EOF
+		}
+		n--
+
+		return &loggregator_v2.Envelope{
+			Timestamp:  time.Now().UnixNano(),
+			SourceId:   "9f2a5a37-1f4e-4e0f-8b4b-6b1c58c4a1d2",
+			InstanceId: "3",
+			Tags: map[string]string{
+				"deployment":        "cf",
+				"job":               "diego-cell",
+				"index":             "4a8bc1f4-5f8e-4d3b-a3c9-2b1f6e8f0c7d",
+				"ip":                "10.0.16.21",
+				"origin":            "rep",
+				"source_type":       "APP/PROC/WEB",
+				"app_name":          "some-app",
+				"organization_name": "some-org",
+				"space_name":        "some-space",
+			},
+			Message: &loggregator_v2.Envelope_Log{
+				Log: &loggregator_v2.Log{
+					Payload: []byte("GET /v2/info HTTP/1.1 200 1274 - response_time:0.003"),
+				},
+			},
+		}, nil
+	}, nil
+}
+
+type byteCountingServer struct {
+	ctx   context.Context
+	bytes int
+
+	grpc.ServerStream
+}
+
+func (s *byteCountingServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *byteCountingServer) Send(b *loggregator_v2.EnvelopeBatch) error {
+	s.bytes += proto.Size(b)
+	return nil
+}
@@ -0,0 +1,163 @@
+package egress_test
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Field projection", func() {
+	var (
+		server *egress.Server
+		srv    *spyBatchedReceiverServer
+	)
+
+	BeforeEach(func() {
+		e := logEnvelope("some-log", map[string]string{
+			"deployment": "cf",
+			"job":        "diego-cell",
+			"index":      "0",
+		})
+		e.SourceId = "some-source-id"
+		e.InstanceId = "some-instance-id"
+		e.Timestamp = 12345
+		e.DeprecatedTags = map[string]*loggregator_v2.Value{
+			"origin": {Data: &loggregator_v2.Value_Text{Text: "rep"}},
+		}
+
+		server = egress.NewServer(
+			&listReceiver{envelopes: []*loggregator_v2.Envelope{e}},
+			testhelper.NewMetricClient(),
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+		)
+		srv = newSpyBatchedReceiverServer(nil)
+	})
+
+	request := func(usePreferredTags bool) *loggregator_v2.EgressBatchRequest {
+		return &loggregator_v2.EgressBatchRequest{
+			UsePreferredTags: usePreferredTags,
+			Selectors: []*loggregator_v2.Selector{
+				{
+					Message: &loggregator_v2.Selector_Log{
+						Log: &loggregator_v2.LogSelector{},
+					},
+				},
+			},
+		}
+	}
+
+	withFields := func(fields string) context.Context {
+		return metadata.NewIncomingContext(
+			context.Background(),
+			metadata.Pairs(egress.FieldsMetadataKey, fields),
+		)
+	}
+
+	receive := func() *loggregator_v2.Envelope {
+		var e *loggregator_v2.Envelope
+		Eventually(srv.envelopes).Should(Receive(&e))
+		return e
+	}
+
+	It("keeps only the listed tag keys", func() {
+		srv.ctx = withFields("tags.deployment, tags.origin")
+
+		Expect(server.BatchedReceiver(request(true), srv)).To(Succeed())
+
+		e := receive()
+		Expect(e.GetTags()).To(Equal(map[string]string{
+			"deployment": "cf",
+			"origin":     "rep",
+		}))
+		Expect(e.GetInstanceId()).To(BeEmpty())
+		Expect(e.GetSourceId()).To(Equal("some-source-id"))
+		Expect(e.GetTimestamp()).To(Equal(int64(12345)))
+		Expect(string(e.GetLog().GetPayload())).To(Equal("some-log"))
+	})
+
+	It("keeps the instance ID and every tag", func() {
+		srv.ctx = withFields("instance_id,tags")
+
+		Expect(server.BatchedReceiver(request(true), srv)).To(Succeed())
+
+		e := receive()
+		Expect(e.GetInstanceId()).To(Equal("some-instance-id"))
+		Expect(e.GetTags()).To(HaveLen(4))
+	})
+
+	It("drops the deprecated tags unless listed", func() {
+		srv.ctx = withFields("instance_id")
+
+		Expect(server.BatchedReceiver(request(false), srv)).To(Succeed())
+
+		e := receive()
+		Expect(e.GetDeprecatedTags()).To(BeEmpty())
+		Expect(e.GetInstanceId()).To(Equal("some-instance-id"))
+	})
+
+	It("keeps the deprecated tags when listed", func() {
+		srv.ctx = withFields("deprecated_tags")
+
+		Expect(server.BatchedReceiver(request(false), srv)).To(Succeed())
+
+		Expect(receive().GetDeprecatedTags()).To(HaveLen(4))
+	})
+
+	It("filters on tags the field mask drops", func() {
+		srv.ctx = metadata.NewIncomingContext(
+			context.Background(),
+			metadata.Pairs(
+				egress.FieldsMetadataKey, "tags.job",
+				egress.FilterMetadataKey, `{"include_tags": {"origin": "rep"}}`,
+			),
+		)
+
+		Expect(server.BatchedReceiver(request(true), srv)).To(Succeed())
+
+		Expect(receive().GetTags()).To(Equal(map[string]string{
+			"job": "diego-cell",
+		}))
+	})
+
+	It("sends every field without a field mask", func() {
+		Expect(server.BatchedReceiver(request(true), srv)).To(Succeed())
+
+		e := receive()
+		Expect(e.GetInstanceId()).To(Equal("some-instance-id"))
+		Expect(e.GetTags()).To(HaveLen(4))
+	})
+
+	DescribeTable("rejects invalid field masks", func(fields string) {
+		srv.ctx = withFields(fields)
+
+		err := server.BatchedReceiver(request(true), srv)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	},
+		Entry("unknown field", "payload"),
+		Entry("empty tag key", "tags."),
+		Entry("empty field", "tags,,instance_id"),
+		Entry("too many fields", longFieldMask(65)),
+	)
+})
+
+func longFieldMask(n int) string {
+	mask := "tags.a"
+	for i := 1; i < n; i++ {
+		mask += ",tags.a"
+	}
+	return mask
+}
@@ -0,0 +1,168 @@
+package egress
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// IdentityMetadataKey is the gRPC metadata key a trusted forwarder, such as
+// the RLP gateway, uses to pass on the identity of the client it streams
+// for.
+const IdentityMetadataKey = "loggregator-client-identity"
+
+// Reasons a stream is rejected, reported as the reason tag of the
+// rejected_streams metric.
+const (
+	rejectedMaxStreams    = "max_streams"
+	rejectedIdentityQuota = "identity_quota"
+	rejectedShardQuota    = "shard_quota"
+)
+
+// StreamQuotas limits the number of concurrent streams per client identity
+// and per shard ID. A limit of 0 or less is unlimited.
+type StreamQuotas struct {
+	// PerIdentity is the default limit for each client identity.
+	PerIdentity int
+
+	// PerShard is the default limit for each shard ID.
+	PerShard int
+
+	// Identities overrides the default limit for specific identities.
+	Identities map[string]int
+
+	// Shards overrides the default limit for specific shard IDs.
+	Shards map[string]int
+
+	// TrustedForwarders are the certificate common names of peers that may
+	// pass on a client identity with IdentityMetadataKey.
+	TrustedForwarders []string
+}
+
+func (q StreamQuotas) identityLimit(identity string) int {
+	if limit, ok := q.Identities[identity]; ok {
+		return limit
+	}
+
+	return q.PerIdentity
+}
+
+func (q StreamQuotas) shardLimit(shardID string) int {
+	if limit, ok := q.Shards[shardID]; ok {
+		return limit
+	}
+
+	return q.PerShard
+}
+
+// StreamUsage holds the number of open streams per client identity and per
+// shard ID.
+type StreamUsage struct {
+	Identities map[string]int
+	Shards     map[string]int
+}
+
+// quotaTracker counts the open streams per identity and shard and enforces
+// the StreamQuotas.
+type quotaTracker struct {
+	quotas     StreamQuotas
+	forwarders map[string]bool
+
+	mu         sync.Mutex
+	identities map[string]int
+	shards     map[string]int
+}
+
+func newQuotaTracker(q StreamQuotas) *quotaTracker {
+	forwarders := make(map[string]bool)
+	for _, f := range q.TrustedForwarders {
+		forwarders[f] = true
+	}
+
+	return &quotaTracker{
+		quotas:     q,
+		forwarders: forwarders,
+		identities: make(map[string]int),
+		shards:     make(map[string]int),
+	}
+}
+
+// acquire reserves a stream for the identity and shard ID. It returns the
+// reason the stream is rejected, or an empty reason and a function that
+// releases the stream.
+func (t *quotaTracker) acquire(identity, shardID string) (release func(), reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit := t.quotas.identityLimit(identity); limit > 0 && t.identities[identity] >= limit {
+		return nil, rejectedIdentityQuota
+	}
+	if limit := t.quotas.shardLimit(shardID); shardID != "" && limit > 0 && t.shards[shardID] >= limit {
+		return nil, rejectedShardQuota
+	}
+
+	t.identities[identity]++
+	if shardID != "" {
+		t.shards[shardID]++
+	}
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		decrement(t.identities, identity)
+		if shardID != "" {
+			decrement(t.shards, shardID)
+		}
+	}, ""
+}
+
+func (t *quotaTracker) usage() StreamUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := StreamUsage{
+		Identities: make(map[string]int, len(t.identities)),
+		Shards:     make(map[string]int, len(t.shards)),
+	}
+	for k, v := range t.identities {
+		u.Identities[k] = v
+	}
+	for k, v := range t.shards {
+		u.Shards[k] = v
+	}
+
+	return u
+}
+
+// identity returns the identity of the client of a stream. It is the common
+// name of the peer certificate unless the peer is a trusted forwarder that
+// passed on the identity of its client.
+func (t *quotaTracker) identity(ctx context.Context) string {
+	var cn string
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			cn = info.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+
+	if t.forwarders[cn] {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md[IdentityMetadataKey]; len(ids) > 0 && ids[0] != "" {
+				return ids[0]
+			}
+		}
+	}
+
+	return cn
+}
+
+func decrement(m map[string]int, key string) {
+	m[key]--
+	if m[key] <= 0 {
+		delete(m, key)
+	}
+}
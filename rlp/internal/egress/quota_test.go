@@ -0,0 +1,167 @@
+package egress_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream quotas", func() {
+	var (
+		metricClient *testhelper.SpyMetricClient
+		server       *egress.Server
+	)
+
+	newServer := func(q egress.StreamQuotas) {
+		metricClient = testhelper.NewMetricClient()
+		server = egress.NewServer(
+			&stubReceiver{},
+			metricClient,
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			1,
+			time.Nanosecond,
+			egress.WithStreamQuotas(q),
+		)
+	}
+
+	stream := func(ctx context.Context, shardID string) error {
+		srv := newSpyBatchedReceiverServer(nil)
+		srv.ctx = ctx
+
+		return server.BatchedReceiver(&loggregator_v2.EgressBatchRequest{
+			ShardId: shardID,
+			Selectors: []*loggregator_v2.Selector{
+				{
+					Message: &loggregator_v2.Selector_Log{
+						Log: &loggregator_v2.LogSelector{},
+					},
+				},
+			},
+		}, srv)
+	}
+
+	identities := func() map[string]int {
+		return server.StreamUsage().Identities
+	}
+
+	It("limits the streams of each identity", func() {
+		newServer(egress.StreamQuotas{PerIdentity: 1})
+
+		go stream(peerContext("nozzle"), "")
+		Eventually(identities).Should(HaveKeyWithValue("nozzle", 1))
+
+		err := stream(peerContext("nozzle"), "")
+		Expect(err).To(MatchError(status.Errorf(
+			codes.ResourceExhausted,
+			`unable to create stream, max egress streams for identity "nozzle" reached: 1`,
+		)))
+
+		go stream(peerContext("other-nozzle"), "")
+		Eventually(identities).Should(HaveKeyWithValue("other-nozzle", 1))
+	})
+
+	It("overrides the limit of specific identities", func() {
+		newServer(egress.StreamQuotas{
+			PerIdentity: 1,
+			Identities:  map[string]int{"nozzle": 2},
+		})
+
+		go stream(peerContext("nozzle"), "")
+		go stream(peerContext("nozzle"), "")
+		Eventually(identities).Should(HaveKeyWithValue("nozzle", 2))
+
+		err := stream(peerContext("nozzle"), "")
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("limits the streams of each shard", func() {
+		newServer(egress.StreamQuotas{PerShard: 1})
+
+		go stream(peerContext("nozzle"), "shard-a")
+		Eventually(func() map[string]int {
+			return server.StreamUsage().Shards
+		}).Should(HaveKeyWithValue("shard-a", 1))
+
+		err := stream(peerContext("other-nozzle"), "shard-a")
+		Expect(err).To(MatchError(status.Errorf(
+			codes.ResourceExhausted,
+			`unable to create stream, max egress streams for shard "shard-a" reached: 1`,
+		)))
+	})
+
+	It("counts rejections with their reason", func() {
+		newServer(egress.StreamQuotas{PerIdentity: 1})
+
+		go stream(peerContext("nozzle"), "")
+		Eventually(identities).Should(HaveKeyWithValue("nozzle", 1))
+		Expect(stream(peerContext("nozzle"), "")).ToNot(Succeed())
+
+		var reasons []string
+		for _, e := range metricClient.GetEnvelopes("rejected_streams") {
+			if e.GetCounter().GetDelta() > 0 {
+				reasons = append(reasons, e.GetDeprecatedTags()["reason"].GetText())
+			}
+		}
+		Expect(reasons).To(ConsistOf("identity_quota"))
+	})
+
+	It("uses the identity passed on by a trusted forwarder", func() {
+		newServer(egress.StreamQuotas{
+			PerIdentity:       1,
+			TrustedForwarders: []string{"gateway"},
+		})
+
+		go stream(forwardedContext("gateway", "client-a"), "")
+		go stream(forwardedContext("gateway", "client-b"), "")
+		Eventually(identities).Should(HaveKeyWithValue("client-a", 1))
+		Eventually(identities).Should(HaveKeyWithValue("client-b", 1))
+
+		err := stream(forwardedContext("gateway", "client-a"), "")
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("ignores the identity passed on by an untrusted peer", func() {
+		newServer(egress.StreamQuotas{
+			TrustedForwarders: []string{"gateway"},
+		})
+
+		go stream(forwardedContext("nozzle", "client-a"), "")
+		Eventually(identities).Should(HaveKeyWithValue("nozzle", 1))
+		Expect(identities()).ToNot(HaveKey("client-a"))
+	})
+})
+
+func peerContext(cn string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{
+					{Subject: pkix.Name{CommonName: cn}},
+				},
+			},
+		},
+	})
+}
+
+func forwardedContext(cn, identity string) context.Context {
+	return metadata.NewIncomingContext(
+		peerContext(cn),
+		metadata.Pairs(egress.IdentityMetadataKey, identity),
+	)
+}
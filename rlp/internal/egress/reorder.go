@@ -0,0 +1,364 @@
+package egress
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ReorderMetadataKey is the gRPC metadata key a subscriber uses to ask for
+// envelopes in timestamp order. The value is a JSON object, for example:
+//
+//	{"window_ms": 500, "late": "drop"}
+//
+// Envelopes are held for up to window_ms milliseconds and sent in timestamp
+// order per source ID and instance ID. An envelope that arrives after a
+// newer envelope of its source and instance was sent is late. Late
+// envelopes are sent immediately if late is "emit", the default, or dropped
+// if it is "drop". Dropped late envelopes are counted by the stream
+// position of SequenceMetadataKey.
+const ReorderMetadataKey = "loggregator-reorder"
+
+const (
+	lateEmit = "emit"
+	lateDrop = "drop"
+
+	maxReorderWindow = 10 * time.Second
+
+	// maxReorderHeld bounds the envelopes held for a stream. When it is
+	// reached the oldest envelope of the source that waited longest is sent
+	// before its window lapsed.
+	maxReorderHeld = envelopeBufferSize
+
+	// maxReorderSources bounds the sources a stream remembers the last
+	// sent timestamp of. When it is reached they are forgotten.
+	maxReorderSources = 10000
+)
+
+type reorderExpression struct {
+	WindowMS int64  `json:"window_ms"`
+	Late     string `json:"late"`
+}
+
+// reorderer holds the envelopes of a stream for a window and releases them
+// in timestamp order.
+type reorderer struct {
+	window   time.Duration
+	dropLate bool
+
+	depth *metricemitter.Gauge
+	late  *metricemitter.Counter
+	seq   *streamSequence
+
+	sources  map[string]*reorderSource
+	held     int
+	arrivals []*reorderItem
+	ready    []*loggregator_v2.Envelope
+	sent     map[string]int64
+}
+
+// reorderSource holds the envelopes of a source ID and instance ID. Its
+// watermark is the newest timestamp of its envelopes that were held for the
+// window. Held envelopes at or below the watermark are released.
+type reorderSource struct {
+	held      reorderHeap
+	watermark int64
+}
+
+type reorderItem struct {
+	e       *loggregator_v2.Envelope
+	key     string
+	arrival time.Time
+	index   int
+}
+
+// reorderFromContext returns the reorderer asked for with the request of the
+// given context. It returns nil if there is none and an InvalidArgument
+// error if the expression is invalid.
+func reorderFromContext(ctx context.Context) (*reorderer, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[ReorderMetadataKey]) == 0 || md[ReorderMetadataKey][0] == "" {
+		return nil, nil
+	}
+
+	r, err := parseReorder(md[ReorderMetadataKey][0])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid reorder: %s", err)
+	}
+
+	return r, nil
+}
+
+func parseReorder(expr string) (*reorderer, error) {
+	if len(expr) > maxFilterBytes {
+		return nil, fmt.Errorf("reorder exceeds %d bytes", maxFilterBytes)
+	}
+
+	var re reorderExpression
+	if err := json.Unmarshal([]byte(expr), &re); err != nil {
+		return nil, err
+	}
+
+	window := time.Duration(re.WindowMS) * time.Millisecond
+	if window <= 0 || window > maxReorderWindow {
+		return nil, fmt.Errorf("window_ms must be between 1 and %d", maxReorderWindow/time.Millisecond)
+	}
+
+	switch re.Late {
+	case "", lateEmit, lateDrop:
+	default:
+		return nil, fmt.Errorf("late must be %q or %q", lateEmit, lateDrop)
+	}
+
+	return &reorderer{
+		window:   window,
+		dropLate: re.Late == lateDrop,
+		sources:  make(map[string]*reorderSource),
+		sent:     make(map[string]int64),
+	}, nil
+}
+
+type reorderResult struct {
+	e   *loggregator_v2.Envelope
+	err error
+}
+
+// wrap returns a function that yields the envelopes of rx in timestamp
+// order. Once rx fails the held envelopes are released and the error is
+// returned.
+func (r *reorderer) wrap(
+	ctx context.Context,
+	rx func() (*loggregator_v2.Envelope, error),
+) func() (*loggregator_v2.Envelope, error) {
+	in := make(chan reorderResult)
+	go func() {
+		for {
+			e, err := rx()
+			select {
+			case in <- reorderResult{e: e, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	out := make(chan reorderResult)
+	go r.run(ctx, in, out)
+
+	return func() (*loggregator_v2.Envelope, error) {
+		select {
+		case res := <-out:
+			return res.e, res.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (r *reorderer) run(ctx context.Context, in <-chan reorderResult, out chan<- reorderResult) {
+	defer func() {
+		r.depth.Decrement(float64(r.held))
+	}()
+
+	tick := r.window / 10
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var err error
+	for {
+		recv := in
+		if err != nil || len(r.ready) >= maxReorderHeld {
+			recv = nil
+		}
+
+		var send chan<- reorderResult
+		var next reorderResult
+		switch {
+		case len(r.ready) > 0:
+			send = out
+			next = reorderResult{e: r.ready[0]}
+		case err != nil:
+			send = out
+			next = reorderResult{err: err}
+		}
+
+		select {
+		case res := <-recv:
+			if res.err != nil {
+				err = res.err
+				r.releaseAll()
+				continue
+			}
+			r.add(res.e, time.Now())
+		case t := <-ticker.C:
+			r.release(t)
+		case send <- next:
+			if next.err != nil {
+				return
+			}
+			r.ready[0] = nil
+			r.ready = r.ready[1:]
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// add holds the envelope, or readies it right away if it is late and late
+// envelopes are emitted.
+func (r *reorderer) add(e *loggregator_v2.Envelope, now time.Time) {
+	key := reorderKey(e)
+	if last, ok := r.sent[key]; ok && e.GetTimestamp() < last {
+		r.late.Increment(1)
+		if r.dropLate {
+			r.seq.drop()
+			return
+		}
+		r.ready = append(r.ready, e)
+		return
+	}
+
+	if r.held >= maxReorderHeld {
+		r.evict()
+	}
+
+	src, ok := r.sources[key]
+	if !ok {
+		src = &reorderSource{}
+		r.sources[key] = src
+	}
+
+	it := &reorderItem{e: e, key: key, arrival: now}
+	heap.Push(&src.held, it)
+	r.arrivals = append(r.arrivals, it)
+	r.held++
+	r.depth.Increment(1)
+}
+
+// evict readies the oldest envelope of the source that waited longest.
+func (r *reorderer) evict() {
+	for len(r.arrivals) > 0 && r.arrivals[0].index < 0 {
+		r.arrivals[0] = nil
+		r.arrivals = r.arrivals[1:]
+	}
+	if len(r.arrivals) == 0 {
+		return
+	}
+
+	key := r.arrivals[0].key
+	src := r.sources[key]
+	r.emit(heap.Pop(&src.held).(*reorderItem))
+	if src.held.Len() == 0 {
+		delete(r.sources, key)
+	}
+}
+
+// release readies the envelopes that were held for the window and any
+// envelopes of the same source that are older than them.
+func (r *reorderer) release(now time.Time) {
+	for len(r.arrivals) > 0 && now.Sub(r.arrivals[0].arrival) >= r.window {
+		it := r.arrivals[0]
+		r.arrivals[0] = nil
+		r.arrivals = r.arrivals[1:]
+
+		if it.index < 0 {
+			continue
+		}
+
+		src := r.sources[it.key]
+		if it.e.GetTimestamp() > src.watermark {
+			src.watermark = it.e.GetTimestamp()
+		}
+
+		for src.held.Len() > 0 && src.held[0].e.GetTimestamp() <= src.watermark {
+			r.emit(heap.Pop(&src.held).(*reorderItem))
+		}
+		if src.held.Len() == 0 {
+			delete(r.sources, it.key)
+		}
+	}
+}
+
+// releaseAll readies every held envelope in timestamp order.
+func (r *reorderer) releaseAll() {
+	items := make([]*reorderItem, 0, r.held)
+	for _, src := range r.sources {
+		items = append(items, src.held...)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].e.GetTimestamp() < items[j].e.GetTimestamp()
+	})
+
+	for _, it := range items {
+		r.emit(it)
+	}
+	r.sources = make(map[string]*reorderSource)
+	r.arrivals = nil
+}
+
+// emit readies an envelope that is no longer held.
+func (r *reorderer) emit(it *reorderItem) {
+	r.held--
+	r.depth.Decrement(1)
+	r.ready = append(r.ready, it.e)
+
+	if len(r.sent) >= maxReorderSources {
+		r.sent = make(map[string]int64)
+	}
+	if it.e.GetTimestamp() > r.sent[it.key] {
+		r.sent[it.key] = it.e.GetTimestamp()
+	}
+}
+
+func reorderKey(e *loggregator_v2.Envelope) string {
+	return e.GetSourceId() + "/" + e.GetInstanceId()
+}
+
+// reorderHeap orders the held envelopes of a source by timestamp. Popped
+// items have an index of -1.
+type reorderHeap []*reorderItem
+
+func (h reorderHeap) Len() int { return len(h) }
+
+func (h reorderHeap) Less(i, j int) bool {
+	return h[i].e.GetTimestamp() < h[j].e.GetTimestamp()
+}
+
+func (h reorderHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *reorderHeap) Push(x interface{}) {
+	it := x.(*reorderItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *reorderHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+
+	return it
+}
@@ -0,0 +1,240 @@
+package egress_test
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reorder", func() {
+	var (
+		metricClient *testhelper.SpyMetricClient
+		srv          *spyBatchedReceiverServer
+	)
+
+	BeforeEach(func() {
+		metricClient = testhelper.NewMetricClient()
+		srv = newSpyBatchedReceiverServer(nil)
+	})
+
+	request := &loggregator_v2.EgressBatchRequest{
+		Selectors: []*loggregator_v2.Selector{
+			{
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	}
+
+	newServer := func(r egress.Receiver) *egress.Server {
+		return egress.NewServer(
+			r,
+			metricClient,
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			100,
+			time.Millisecond,
+		)
+	}
+
+	withReorder := func(ctx context.Context, expr string) context.Context {
+		return metadata.NewIncomingContext(
+			ctx,
+			metadata.Pairs(egress.ReorderMetadataKey, expr),
+		)
+	}
+
+	timestamps := func() []int64 {
+		var ts []int64
+		for {
+			select {
+			case e := <-srv.envelopes:
+				ts = append(ts, e.GetTimestamp())
+			default:
+				return ts
+			}
+		}
+	}
+
+	It("sends envelopes in timestamp order", func() {
+		server := newServer(&listReceiver{envelopes: []*loggregator_v2.Envelope{
+			timestampedEnvelope("a", 3),
+			timestampedEnvelope("a", 1),
+			timestampedEnvelope("b", 4),
+			timestampedEnvelope("a", 2),
+		}})
+		srv.ctx = withReorder(context.Background(), `{"window_ms": 1000}`)
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		Expect(timestamps()).To(Equal([]int64{1, 2, 3, 4}))
+	})
+
+	It("sends held envelopes once the window lapsed", func() {
+		r := newChanReceiver()
+		defer close(r.envelopes)
+		server := newServer(r)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		srv.ctx = withReorder(ctx, `{"window_ms": 100}`)
+
+		go server.BatchedReceiver(request, srv)
+
+		r.envelopes <- timestampedEnvelope("a", 2)
+		r.envelopes <- timestampedEnvelope("a", 1)
+
+		var e *loggregator_v2.Envelope
+		Eventually(srv.envelopes).Should(Receive(&e))
+		Expect(e.GetTimestamp()).To(Equal(int64(1)))
+		Eventually(srv.envelopes).Should(Receive(&e))
+		Expect(e.GetTimestamp()).To(Equal(int64(2)))
+	})
+
+	It("holds each source for its own window", func() {
+		r := newChanReceiver()
+		defer close(r.envelopes)
+		server := newServer(r)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		srv.ctx = withReorder(ctx, `{"window_ms": 500}`)
+
+		go server.BatchedReceiver(request, srv)
+
+		r.envelopes <- timestampedEnvelope("b", 100)
+		Eventually(srv.envelopes).Should(Receive())
+
+		r.envelopes <- timestampedEnvelope("a", 1)
+		Consistently(srv.envelopes, 250*time.Millisecond).ShouldNot(Receive())
+
+		var e *loggregator_v2.Envelope
+		Eventually(srv.envelopes).Should(Receive(&e))
+		Expect(e.GetSourceId()).To(Equal("a"))
+	})
+
+	It("counts dropped late envelopes in the stream position", func() {
+		r := newChanReceiver()
+		defer close(r.envelopes)
+		server := newServer(r)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		srv.ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(
+			egress.ReorderMetadataKey, `{"window_ms": 10, "late": "drop"}`,
+			egress.SequenceMetadataKey, "true",
+		))
+
+		go server.BatchedReceiver(request, srv)
+
+		r.envelopes <- timestampedEnvelope("a", 5)
+		r.envelopes <- timestampedEnvelope("b", 1)
+		Eventually(func() string {
+			select {
+			case e := <-srv.envelopes:
+				return e.GetSourceId()
+			default:
+				return ""
+			}
+		}).Should(Equal("b"))
+
+		r.envelopes <- timestampedEnvelope("a", 3)
+		r.envelopes <- timestampedEnvelope("b", 3)
+
+		Eventually(func() uint64 {
+			select {
+			case e := <-srv.envelopes:
+				return e.GetCounter().GetTotal()
+			default:
+				return 0
+			}
+		}).Should(Equal(uint64(1)))
+	})
+
+	DescribeTable("late envelopes", func(policy string, sent bool) {
+		r := newChanReceiver()
+		defer close(r.envelopes)
+		server := newServer(r)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		srv.ctx = withReorder(ctx, `{"window_ms": 10, "late": "`+policy+`"}`)
+
+		go server.BatchedReceiver(request, srv)
+
+		r.envelopes <- timestampedEnvelope("a", 5)
+		Eventually(srv.envelopes).Should(Receive())
+
+		r.envelopes <- timestampedEnvelope("a", 3)
+		r.envelopes <- timestampedEnvelope("b", 3)
+
+		var e *loggregator_v2.Envelope
+		Eventually(srv.envelopes).Should(Receive(&e))
+		if sent {
+			Expect(e.GetSourceId()).To(Equal("a"))
+			Eventually(srv.envelopes).Should(Receive(&e))
+		}
+		Expect(e.GetSourceId()).To(Equal("b"))
+		Consistently(srv.envelopes).ShouldNot(Receive())
+
+		Expect(metricClient.GetDelta("late_envelopes")).To(Equal(uint64(1)))
+	},
+		Entry("are sent with emit", "emit", true),
+		Entry("are dropped with drop", "drop", false),
+	)
+
+	DescribeTable("rejects invalid reorders", func(expr string) {
+		srv.ctx = withReorder(context.Background(), expr)
+
+		err := newServer(&listReceiver{}).BatchedReceiver(request, srv)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	},
+		Entry("malformed JSON", `{"window_ms":`),
+		Entry("missing window", `{"late": "drop"}`),
+		Entry("long window", `{"window_ms": 60000}`),
+		Entry("unknown late policy", `{"window_ms": 100, "late": "keep"}`),
+	)
+})
+
+type chanReceiver struct {
+	envelopes chan *loggregator_v2.Envelope
+}
+
+func newChanReceiver() *chanReceiver {
+	return &chanReceiver{
+		envelopes: make(chan *loggregator_v2.Envelope),
+	}
+}
+
+func (r *chanReceiver) Subscribe(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (func() (*loggregator_v2.Envelope, error), error) {
+	return func() (*loggregator_v2.Envelope, error) {
+		e, ok := <-r.envelopes
+		if !ok {
+			return nil, io.EOF
+		}
+		return e, nil
+	}, nil
+}
+
+func timestampedEnvelope(sourceID string, ts int64) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		SourceId:  sourceID,
+		Timestamp: ts,
+		Message: &loggregator_v2.Envelope_Log{
+			Log: &loggregator_v2.Log{},
+		},
+	}
+}
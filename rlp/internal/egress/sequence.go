@@ -0,0 +1,110 @@
+package egress
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// SequenceMetadataKey is the gRPC metadata key a subscriber of the batched
+// receiver sets to "true" to have every batch end with a stream position
+// envelope. The envelope is a counter named StreamDroppedName whose total is
+// the number of envelopes dropped for the stream so far. Its
+// StreamSequenceTag tag holds the sequence number of the batch, which
+// starts at 1 and increases by one for every batch of the stream. If the
+// receiver reports it, the StreamRoutersTag tag holds the number of routers
+// the subscription is attached to when the batch is sent. Like the tags of
+// every other envelope they are deprecated tags unless the subscriber uses
+// preferred tags.
+const SequenceMetadataKey = "loggregator-stream-sequence"
+
+const (
+	// StreamDroppedName is the name of the stream position counter.
+	StreamDroppedName = "rlp_stream_dropped"
+
+	// StreamSequenceTag is the tag of the stream position counter that
+	// holds the sequence number of the batch.
+	StreamSequenceTag = "sequence"
+
+	// StreamRoutersTag is the tag of the stream position counter that holds
+	// the number of routers the subscription is attached to.
+	StreamRoutersTag = "routers"
+)
+
+// streamSequence numbers the batches of a stream and counts the envelopes
+// dropped for it.
+type streamSequence struct {
+	sequence     uint64
+	dropped      uint64
+	usePreferred bool
+
+	// attached reports the number of routers the subscription is attached
+	// to. It is nil if the receiver does not report it.
+	attached func() int
+}
+
+// sequenceFromContext returns a streamSequence if the subscriber of the
+// given context asked for stream positions and nil otherwise.
+func sequenceFromContext(ctx context.Context, usePreferred bool) *streamSequence {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[SequenceMetadataKey]) == 0 {
+		return nil
+	}
+
+	if enabled, _ := strconv.ParseBool(md[SequenceMetadataKey][0]); !enabled {
+		return nil
+	}
+
+	return &streamSequence{usePreferred: usePreferred}
+}
+
+// drop counts a dropped envelope. It is a no-op on a nil streamSequence.
+func (s *streamSequence) drop() {
+	if s == nil {
+		return
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+}
+
+// next returns the stream position envelope for the next batch.
+func (s *streamSequence) next() *loggregator_v2.Envelope {
+	s.sequence++
+
+	e := &loggregator_v2.Envelope{
+		Timestamp: time.Now().UnixNano(),
+		Message: &loggregator_v2.Envelope_Counter{
+			Counter: &loggregator_v2.Counter{
+				Name:  StreamDroppedName,
+				Total: atomic.LoadUint64(&s.dropped),
+			},
+		},
+	}
+
+	tags := map[string]string{
+		StreamSequenceTag: strconv.FormatUint(s.sequence, 10),
+	}
+	if s.attached != nil {
+		tags[StreamRoutersTag] = strconv.Itoa(s.attached())
+	}
+
+	if s.usePreferred {
+		e.Tags = tags
+		return e
+	}
+
+	e.DeprecatedTags = make(map[string]*loggregator_v2.Value, len(tags))
+	for name, value := range tags {
+		e.DeprecatedTags[name] = &loggregator_v2.Value{
+			Data: &loggregator_v2.Value_Text{
+				Text: value,
+			},
+		}
+	}
+
+	return e
+}
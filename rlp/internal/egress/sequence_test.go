@@ -0,0 +1,201 @@
+package egress_test
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/rlp/internal/egress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream sequence", func() {
+	request := &loggregator_v2.EgressBatchRequest{
+		UsePreferredTags: true,
+		Selectors: []*loggregator_v2.Selector{
+			{
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	}
+
+	withSequence := func(ctx context.Context) context.Context {
+		return metadata.NewIncomingContext(
+			ctx,
+			metadata.Pairs(egress.SequenceMetadataKey, "true"),
+		)
+	}
+
+	newServer := func(r egress.Receiver, batchSize int) *egress.Server {
+		return egress.NewServer(
+			r,
+			testhelper.NewMetricClient(),
+			newSpyHealthRegistrar(),
+			context.TODO(),
+			batchSize,
+			time.Minute,
+		)
+	}
+
+	It("ends every batch with the stream position", func() {
+		server := newServer(&listReceiver{envelopes: []*loggregator_v2.Envelope{
+			logEnvelope("a", nil),
+			logEnvelope("b", nil),
+			logEnvelope("c", nil),
+			logEnvelope("d", nil),
+			logEnvelope("e", nil),
+		}}, 2)
+		srv := &batchRecordingServer{ctx: withSequence(context.Background())}
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		batches := srv.recorded()
+		Expect(len(batches)).To(BeNumerically(">=", 3))
+
+		var logs int
+		for i, b := range batches {
+			Expect(len(b.Batch)).To(BeNumerically(">=", 2))
+
+			last := b.Batch[len(b.Batch)-1]
+			Expect(last.GetCounter().GetName()).To(Equal(egress.StreamDroppedName))
+			Expect(last.GetCounter().GetTotal()).To(BeZero())
+			Expect(last.GetTags()[egress.StreamSequenceTag]).To(Equal(strconv.Itoa(i + 1)))
+
+			logs += len(b.Batch) - 1
+		}
+		Expect(logs).To(Equal(5))
+	})
+
+	It("sets the sequence as a deprecated tag without preferred tags", func() {
+		server := newServer(&listReceiver{envelopes: []*loggregator_v2.Envelope{
+			logEnvelope("a", nil),
+		}}, 1)
+		srv := &batchRecordingServer{ctx: withSequence(context.Background())}
+
+		Expect(server.BatchedReceiver(&loggregator_v2.EgressBatchRequest{
+			Selectors: request.Selectors,
+		}, srv)).To(Succeed())
+
+		batches := srv.recorded()
+		Expect(batches).ToNot(BeEmpty())
+
+		last := batches[0].Batch[len(batches[0].Batch)-1]
+		Expect(last.GetCounter().GetName()).To(Equal(egress.StreamDroppedName))
+		Expect(last.GetTags()).To(BeEmpty())
+		Expect(last.GetDeprecatedTags()[egress.StreamSequenceTag].GetText()).To(Equal("1"))
+	})
+
+	It("reports the routers the subscription is attached to", func() {
+		server := newServer(&attachedReceiver{
+			listReceiver: listReceiver{envelopes: []*loggregator_v2.Envelope{
+				logEnvelope("a", nil),
+			}},
+			attached: 3,
+		}, 1)
+		srv := &batchRecordingServer{ctx: withSequence(context.Background())}
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		batches := srv.recorded()
+		Expect(batches).ToNot(BeEmpty())
+
+		last := batches[0].Batch[len(batches[0].Batch)-1]
+		Expect(last.GetTags()[egress.StreamRoutersTag]).To(Equal("3"))
+	})
+
+	It("does not add the stream position unless asked for", func() {
+		server := newServer(&listReceiver{envelopes: []*loggregator_v2.Envelope{
+			logEnvelope("a", nil),
+			logEnvelope("b", nil),
+		}}, 2)
+		srv := &batchRecordingServer{}
+
+		Expect(server.BatchedReceiver(request, srv)).To(Succeed())
+
+		for _, b := range srv.recorded() {
+			for _, e := range b.Batch {
+				Expect(e.GetCounter()).To(BeNil())
+			}
+		}
+	})
+
+	It("reports the envelopes dropped for the stream", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		server := newServer(newSpyReceiver(1000000), 1)
+		srv := newSpyBatchedReceiverServer(nil)
+		srv.delay = 10 * time.Millisecond
+		srv.ctx = withSequence(ctx)
+
+		go server.BatchedReceiver(request, srv)
+
+		Eventually(func() uint64 {
+			for {
+				select {
+				case e := <-srv.envelopes:
+					if e.GetCounter().GetName() == egress.StreamDroppedName && e.GetCounter().GetTotal() > 0 {
+						return e.GetCounter().GetTotal()
+					}
+				default:
+					return 0
+				}
+			}
+		}, 3).Should(BeNumerically(">", 0))
+	})
+})
+
+type batchRecordingServer struct {
+	ctx context.Context
+
+	mu      sync.Mutex
+	batches []*loggregator_v2.EnvelopeBatch
+
+	grpc.ServerStream
+}
+
+func (s *batchRecordingServer) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+
+	return context.Background()
+}
+
+func (s *batchRecordingServer) Send(b *loggregator_v2.EnvelopeBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, b)
+
+	return nil
+}
+
+func (s *batchRecordingServer) recorded() []*loggregator_v2.EnvelopeBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*loggregator_v2.EnvelopeBatch(nil), s.batches...)
+}
+
+// attachedReceiver is a listReceiver that reports a fixed number of attached
+// routers.
+type attachedReceiver struct {
+	listReceiver
+	attached int
+}
+
+func (r *attachedReceiver) SubscribeWithStatus(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (func() (*loggregator_v2.Envelope, error), func() int, error) {
+	rx, err := r.Subscribe(ctx, req)
+	return rx, func() int { return r.attached }, err
+}
@@ -4,20 +4,29 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator/metricemitter"
 	"code.cloudfoundry.org/loggregator/plumbing/batching"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"golang.org/x/net/context"
 )
 
 const (
+	// envelopeBufferSize is the size of the envelope buffer of a stream
+	// unless the subscriber asks for another with BufferSizeMetadataKey.
 	envelopeBufferSize = 10000
+
+	// defaultMaxBatchBytes keeps batches below the default 4MB gRPC
+	// message limit.
+	defaultMaxBatchBytes = 3 * 1024 * 1024
 )
 
 // HealthRegistrar provides an interface to record various counters.
@@ -31,6 +40,14 @@ type Receiver interface {
 	Subscribe(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (rx func() (*loggregator_v2.Envelope, error), err error)
 }
 
+// AttachedReceiver is a Receiver that also reports how many routers a
+// subscription is attached to. The count is sent to subscribers of the
+// batched receiver with the stream position of SequenceMetadataKey.
+type AttachedReceiver interface {
+	Receiver
+	SubscribeWithStatus(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (rx func() (*loggregator_v2.Envelope, error), attached func() int, err error)
+}
+
 // MetricClient creates new CounterMetrics to be emitted periodically.
 type MetricClient interface {
 	NewCounter(name string, opts ...metricemitter.MetricOption) *metricemitter.Counter
@@ -43,14 +60,24 @@ type Server struct {
 	receiver            Receiver
 	egressMetric        *metricemitter.Counter
 	droppedMetric       *metricemitter.Counter
-	rejectedMetric      *metricemitter.Counter
+	filteredMetric      *metricemitter.Counter
+	aggregatedMetric    *metricemitter.Counter
+	lateMetric          *metricemitter.Counter
+	reorderDepthMetric  *metricemitter.Gauge
+	rejectedMetrics     map[string]*metricemitter.Counter
 	subscriptionsMetric *metricemitter.Gauge
 	health              HealthRegistrar
 	ctx                 context.Context
 	batchSize           int
 	batchInterval       time.Duration
 	maxStreams          int64
+	maxBatchBytes       int
 	subscriptions       int64
+	quotas              *quotaTracker
+	minBufferSize       int
+	maxBufferSize       int
+	lag                 *lagTracker
+	load                *loadMonitor
 }
 
 // NewServer is the preferred way to create a new Server.
@@ -74,10 +101,51 @@ func NewServer(
 		}),
 	)
 
-	rejectedMetric := m.NewCounter("rejected_streams",
+	// metric-documentation-v2: (loggregator.rlp.filtered) Number of v2
+	// envelopes not sent to a consumer because of the filter of its
+	// subscription.
+	filteredMetric := m.NewCounter("filtered",
+		metricemitter.WithVersion(2, 0),
+	)
+
+	// metric-documentation-v2: (loggregator.rlp.aggregated) Number of v2
+	// envelopes folded into aggregated metrics for a consumer.
+	aggregatedMetric := m.NewCounter("aggregated",
+		metricemitter.WithVersion(2, 0),
+	)
+
+	// metric-documentation-v2: (loggregator.rlp.late_envelopes) Number of
+	// v2 envelopes that arrived after a newer envelope of their source was
+	// sent to a consumer.
+	lateMetric := m.NewCounter("late_envelopes",
 		metricemitter.WithVersion(2, 0),
 	)
 
+	// metric-documentation-v2: (loggregator.rlp.reorder_depth) Number of v2
+	// envelopes held to be sent to consumers in timestamp order.
+	reorderDepthMetric := m.NewGauge("reorder_depth", "envelopes",
+		metricemitter.WithVersion(2, 0),
+	)
+
+	rejectedMetrics := make(map[string]*metricemitter.Counter)
+	for _, reason := range []string{
+		rejectedMaxStreams,
+		rejectedIdentityQuota,
+		rejectedShardQuota,
+		rejectedDropRate,
+		rejectedHeap,
+		rejectedGoroutines,
+	} {
+		// metric-documentation-v2: (loggregator.rlp.rejected_streams) Number
+		// of streams rejected by the RLP, tagged with the reason.
+		rejectedMetrics[reason] = m.NewCounter("rejected_streams",
+			metricemitter.WithVersion(2, 0),
+			metricemitter.WithTags(map[string]string{
+				"reason": reason,
+			}),
+		)
+	}
+
 	subscriptionsMetric := m.NewGauge("subscriptions", "total",
 		metricemitter.WithVersion(2, 0),
 	)
@@ -86,18 +154,29 @@ func NewServer(
 		receiver:            r,
 		egressMetric:        egressMetric,
 		droppedMetric:       droppedMetric,
-		rejectedMetric:      rejectedMetric,
+		filteredMetric:      filteredMetric,
+		aggregatedMetric:    aggregatedMetric,
+		lateMetric:          lateMetric,
+		reorderDepthMetric:  reorderDepthMetric,
+		rejectedMetrics:     rejectedMetrics,
 		subscriptionsMetric: subscriptionsMetric,
 		health:              h,
 		ctx:                 c,
 		batchSize:           batchSize,
 		batchInterval:       batchInterval,
 		maxStreams:          500,
+		maxBatchBytes:       defaultMaxBatchBytes,
+		quotas:              newQuotaTracker(StreamQuotas{}),
+		minBufferSize:       1,
+		maxBufferSize:       envelopeBufferSize,
+		lag:                 newLagTracker(defaultLagInterval),
+		load:                newLoadMonitor(AdmissionThresholds{}),
 	}
 
 	for _, o := range opts {
 		o(s)
 	}
+	s.load.start(c)
 
 	return s
 }
@@ -113,6 +192,65 @@ func WithMaxStreams(conn int64) ServerOption {
 	}
 }
 
+// WithMaxBatchBytes specifies the maximum encoded size of a batch sent to a
+// subscriber. A value of 0 or less removes the limit.
+func WithMaxBatchBytes(n int) ServerOption {
+	return func(s *Server) {
+		s.maxBatchBytes = n
+	}
+}
+
+// WithStreamQuotas specifies the limits on the number of streams per client
+// identity and per shard ID. By default there are no limits besides
+// WithMaxStreams.
+func WithStreamQuotas(q StreamQuotas) ServerOption {
+	return func(s *Server) {
+		s.quotas = newQuotaTracker(q)
+	}
+}
+
+// WithBufferSizeBounds specifies the bounds of the envelope buffer size a
+// subscriber may ask for with BufferSizeMetadataKey. Requested sizes outside
+// the bounds are clamped. A max of 0 or less removes the upper bound. By
+// default a stream buffers up to 10000 envelopes.
+func WithBufferSizeBounds(min, max int) ServerOption {
+	return func(s *Server) {
+		s.minBufferSize = min
+		s.maxBufferSize = max
+	}
+}
+
+// WithAdmissionThresholds specifies the load above which new streams are
+// rejected with Unavailable. The load is sampled every interval until the
+// context of the server is done. By default streams are admitted regardless
+// of load.
+func WithAdmissionThresholds(t AdmissionThresholds) ServerOption {
+	return func(s *Server) {
+		s.load = newLoadMonitor(t)
+	}
+}
+
+// WithLagInterval specifies the interval over which the lag reported by
+// StreamLag is measured. It defaults to a minute.
+func WithLagInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.lag = newLagTracker(d)
+	}
+}
+
+// StreamLag returns the percentiles of the time from the timestamp of an
+// envelope until it was sent, per shard ID, over the last complete lag
+// interval.
+func (s *Server) StreamLag() map[string]StreamLag {
+	return s.lag.lag(time.Now())
+}
+
+// StreamUsage returns the number of open streams per client identity and
+// per shard ID.
+func (s *Server) StreamUsage() StreamUsage {
+	return s.quotas.usage()
+}
+
 // Receiver implements the loggregator-api V2 gRPC interface for receiving
 // envelopes from upstream connections.
 func (s *Server) Receiver(r *loggregator_v2.EgressRequest, srv loggregator_v2.Egress_ReceiverServer) error {
@@ -122,19 +260,15 @@ func (s *Server) Receiver(r *loggregator_v2.EgressRequest, srv loggregator_v2.Eg
 	s.subscriptionsMetric.Increment(1)
 	defer s.subscriptionsMetric.Decrement(1)
 
-	subCount := atomic.AddInt64(&s.subscriptions, 1)
-	defer atomic.AddInt64(&s.subscriptions, -1)
-
-	if subCount > s.maxStreams {
-		s.rejectedMetric.Increment(1)
-		return status.Errorf(codes.ResourceExhausted, "unable to create stream, max egress streams reached: %d", s.maxStreams)
+	release, err := s.admit(srv.Context(), r.GetShardId())
+	if err != nil {
+		return err
 	}
+	defer release()
 
 	ctx, cancel := context.WithCancel(srv.Context())
 	defer cancel()
 
-	buffer := make(chan *loggregator_v2.Envelope, envelopeBufferSize)
-
 	r.Selectors = s.convergeSelectors(r.GetLegacySelector(), r.GetSelectors())
 	r.LegacySelector = nil
 
@@ -147,6 +281,35 @@ func (s *Server) Receiver(r *loggregator_v2.EgressRequest, srv loggregator_v2.Eg
 		}
 	}
 
+	filter, err := filterFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	proj, err := projectionFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	ro, err := reorderFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	agg, err := aggregatorFromContext(srv.Context(), r.GetUsePreferredTags())
+	if err != nil {
+		return err
+	}
+	if agg != nil {
+		return status.Errorf(codes.InvalidArgument, "aggregation requires the batched receiver")
+	}
+
+	bufferSize, err := s.bufferSize(srv.Context())
+	if err != nil {
+		return err
+	}
+	buffer := make(chan *loggregator_v2.Envelope, bufferSize)
+
 	go func() {
 		select {
 		case <-s.ctx.Done():
@@ -167,14 +330,18 @@ func (s *Server) Receiver(r *loggregator_v2.EgressRequest, srv loggregator_v2.Eg
 		log.Printf("Unable to setup subscription: %s", err)
 		return fmt.Errorf("unable to setup subscription")
 	}
+	rx = s.reorder(ctx, ro, nil, rx)
+	s.sendAdmitted(srv.Context())
 
-	go s.consumeReceiver(r.UsePreferredTags, buffer, rx, cancel)
+	go s.consumeReceiver(r.UsePreferredTags, filter, proj, buffer, rx, cancel)
 
 	for data := range buffer {
 		if err := srv.Send(data); err != nil {
 			log.Printf("Send error: %s", err)
 			return io.ErrUnexpectedEOF
 		}
+		s.lag.observe(r.GetShardId(), time.Now(), data)
+		s.load.send(1)
 
 		// metric-documentation-v2: (loggregator.rlp.egress) Number of v2
 		// envelopes sent to RLP consumers.
@@ -188,6 +355,12 @@ func (s *Server) Receiver(r *loggregator_v2.EgressRequest, srv loggregator_v2.Eg
 // receiving batches of envelopes. Envelopes will be written to the egress
 // batched receiver server whenever the configured interval or configured
 // batch size is exceeded.
+//
+// If the subscriber sets SequenceMetadataKey, every batch ends with an
+// envelope that holds its sequence number and the number of envelopes
+// dropped for the stream so far. If the subscriber sets
+// AggregateMetadataKey, counters and gauges are aggregated over a window
+// before they are batched.
 func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggregator_v2.Egress_BatchedReceiverServer) error {
 	s.health.Inc("subscriptionCount")
 	defer s.health.Dec("subscriptionCount")
@@ -195,13 +368,11 @@ func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggr
 	s.subscriptionsMetric.Increment(1)
 	defer s.subscriptionsMetric.Decrement(1)
 
-	subCount := atomic.AddInt64(&s.subscriptions, 1)
-	defer func() { atomic.AddInt64(&s.subscriptions, -1) }()
-
-	if subCount > s.maxStreams {
-		s.rejectedMetric.Increment(1)
-		return status.Errorf(codes.ResourceExhausted, "unable to create stream, max egress streams reached: %d", s.maxStreams)
+	release, err := s.admit(srv.Context(), r.GetShardId())
+	if err != nil {
+		return err
 	}
+	defer release()
 
 	r.Selectors = s.convergeSelectors(r.GetLegacySelector(), r.GetSelectors())
 	r.LegacySelector = nil
@@ -215,10 +386,37 @@ func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggr
 		}
 	}
 
+	filter, err := filterFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	proj, err := projectionFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	ro, err := reorderFromContext(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	agg, err := aggregatorFromContext(srv.Context(), r.GetUsePreferredTags())
+	if err != nil {
+		return err
+	}
+
+	seq := sequenceFromContext(srv.Context(), r.GetUsePreferredTags())
+
+	bufferSize, err := s.bufferSize(srv.Context())
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(srv.Context())
 	defer cancel()
 
-	buffer := make(chan *loggregator_v2.Envelope, envelopeBufferSize)
+	buffer := make(chan *loggregator_v2.Envelope, bufferSize)
 
 	go func() {
 		select {
@@ -229,14 +427,19 @@ func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggr
 		}
 	}()
 
-	rx, err := s.receiver.Subscribe(ctx, r)
+	rx, attached, err := s.subscribe(ctx, r)
 	if err != nil {
 		log.Printf("Unable to setup subscription: %s", err)
 		return fmt.Errorf("unable to setup subscription")
 	}
+	if seq != nil {
+		seq.attached = attached
+	}
+	rx = s.reorder(ctx, ro, seq, rx)
+	s.sendAdmitted(srv.Context())
 
 	receiveErrorStream := make(chan error, 1)
-	go s.consumeBatchReceiver(r.UsePreferredTags, buffer, receiveErrorStream, rx, cancel)
+	go s.consumeBatchReceiver(r.UsePreferredTags, filter, proj, seq, buffer, receiveErrorStream, rx, cancel)
 
 	senderErrorStream := make(chan error, 1)
 	batcher := batching.NewV2EnvelopeBatcher(
@@ -246,9 +449,36 @@ func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggr
 			srv:          srv,
 			errStream:    senderErrorStream,
 			egressMetric: s.egressMetric,
+			seq:          seq,
+			lag:          s.lag,
+			load:         s.load,
+			shardID:      r.GetShardId(),
 		},
+		batching.WithMaxBatchBytes(s.maxBatchBytes),
 	)
 
+	write := func(e *loggregator_v2.Envelope) {
+		if agg == nil || !aggregatable(e) {
+			batcher.Write(e)
+			return
+		}
+
+		if !agg.add(e) {
+			s.droppedMetric.Increment(1)
+			s.load.drop()
+			seq.drop()
+			return
+		}
+		s.aggregatedMetric.Increment(1)
+	}
+
+	var window <-chan time.Time
+	if agg != nil {
+		ticker := time.NewTicker(agg.window)
+		defer ticker.Stop()
+		window = ticker.C
+	}
+
 	resetDuration := 100 * time.Millisecond
 	timer := time.NewTimer(resetDuration)
 	for {
@@ -257,16 +487,25 @@ func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggr
 			if !ok {
 				continue
 			}
-			batcher.Write(data)
+			write(data)
 			if !timer.Stop() {
 				<-timer.C
 			}
 			timer.Reset(resetDuration)
+		case <-window:
+			for _, e := range agg.flush() {
+				batcher.Write(e)
+			}
 		case <-senderErrorStream:
 			return io.ErrUnexpectedEOF
 		case <-receiveErrorStream:
 			for d := range buffer {
-				batcher.Write(d)
+				write(d)
+			}
+			if agg != nil {
+				for _, e := range agg.flush() {
+					batcher.Write(e)
+				}
 			}
 			batcher.ForcedFlush()
 
@@ -280,6 +519,86 @@ func (s *Server) BatchedReceiver(r *loggregator_v2.EgressBatchRequest, srv loggr
 	return nil
 }
 
+// subscribe subscribes to the receiver. It also returns how many routers
+// the subscription is attached to if the receiver reports it and nil
+// otherwise.
+func (s *Server) subscribe(
+	ctx context.Context,
+	r *loggregator_v2.EgressBatchRequest,
+) (func() (*loggregator_v2.Envelope, error), func() int, error) {
+	if ar, ok := s.receiver.(AttachedReceiver); ok {
+		return ar.SubscribeWithStatus(ctx, r)
+	}
+
+	rx, err := s.receiver.Subscribe(ctx, r)
+	return rx, nil, err
+}
+
+// reorder returns rx unchanged if the subscriber did not ask for envelopes in
+// timestamp order and a function that yields them in order otherwise.
+func (s *Server) reorder(
+	ctx context.Context,
+	ro *reorderer,
+	seq *streamSequence,
+	rx func() (*loggregator_v2.Envelope, error),
+) func() (*loggregator_v2.Envelope, error) {
+	if ro == nil {
+		return rx
+	}
+
+	ro.depth = s.reorderDepthMetric
+	ro.late = s.lateMetric
+	ro.seq = seq
+
+	return ro.wrap(ctx, rx)
+}
+
+// admit reserves a stream for the client of the given context. It returns an
+// Unavailable error with a retry-after hint if the RLP is overloaded and an
+// error if the stream would exceed the maximum number of streams or the
+// quota of the client identity or shard ID. Otherwise it returns a function
+// that releases the stream.
+func (s *Server) admit(ctx context.Context, shardID string) (func(), error) {
+	if reason := s.load.overloaded(); reason != "" {
+		s.rejectedMetrics[reason].Increment(1)
+
+		retryAfter := strconv.FormatInt(s.load.retryAfter(), 10)
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(RetryAfterMetadataKey, retryAfter))
+
+		return nil, status.Errorf(codes.Unavailable, "unable to create stream, RLP is overloaded: %s", reason)
+	}
+
+	subCount := atomic.AddInt64(&s.subscriptions, 1)
+	if subCount > s.maxStreams {
+		atomic.AddInt64(&s.subscriptions, -1)
+		s.rejectedMetrics[rejectedMaxStreams].Increment(1)
+		return nil, status.Errorf(codes.ResourceExhausted, "unable to create stream, max egress streams reached: %d", s.maxStreams)
+	}
+
+	identity := s.quotas.identity(ctx)
+	release, reason := s.quotas.acquire(identity, shardID)
+	if reason != "" {
+		atomic.AddInt64(&s.subscriptions, -1)
+		s.rejectedMetrics[reason].Increment(1)
+
+		if reason == rejectedShardQuota {
+			return nil, status.Errorf(codes.ResourceExhausted, "unable to create stream, max egress streams for shard %q reached: %d", shardID, s.quotas.quotas.shardLimit(shardID))
+		}
+		return nil, status.Errorf(codes.ResourceExhausted, "unable to create stream, max egress streams for identity %q reached: %d", identity, s.quotas.quotas.identityLimit(identity))
+	}
+
+	return func() {
+		release()
+		atomic.AddInt64(&s.subscriptions, -1)
+	}, nil
+}
+
+// sendAdmitted tells the subscriber that its stream was admitted. It fails
+// only once the stream is done, which the stream itself will notice.
+func (s *Server) sendAdmitted(ctx context.Context) {
+	_ = grpc.SendHeader(ctx, metadata.Pairs(AdmittedMetadataKey, "true"))
+}
+
 // convergeSelectors takes in any LegacySelector on the request as well as
 // Selectors and converts LegacySelector into a Selector based on Selector
 // hierarchy.
@@ -305,10 +624,19 @@ type batchWriter struct {
 	srv          loggregator_v2.Egress_BatchedReceiverServer
 	errStream    chan<- error
 	egressMetric *metricemitter.Counter
+	seq          *streamSequence
+	lag          *lagTracker
+	load         *loadMonitor
+	shardID      string
 }
 
 func (b *batchWriter) Write(batch []*loggregator_v2.Envelope) {
-	err := b.srv.Send(&loggregator_v2.EnvelopeBatch{Batch: batch})
+	envelopes := batch
+	if b.seq != nil {
+		envelopes = append(envelopes, b.seq.next())
+	}
+
+	err := b.srv.Send(&loggregator_v2.EnvelopeBatch{Batch: envelopes})
 	if err != nil {
 		select {
 		case b.errStream <- err:
@@ -320,10 +648,15 @@ func (b *batchWriter) Write(batch []*loggregator_v2.Envelope) {
 	// metric-documentation-v2: (loggregator.rlp.egress) Number of v2
 	// envelopes sent to RLP consumers.
 	b.egressMetric.Increment(uint64(len(batch)))
+	b.lag.observe(b.shardID, time.Now(), batch...)
+	b.load.send(len(batch))
 }
 
 func (s *Server) consumeBatchReceiver(
 	usePreferred bool,
+	filter *envelopeFilter,
+	proj *projection,
+	seq *streamSequence,
 	buffer chan<- *loggregator_v2.Envelope,
 	errorStream chan<- error,
 	rx func() (*loggregator_v2.Envelope, error),
@@ -346,7 +679,15 @@ func (s *Server) consumeBatchReceiver(
 			break
 		}
 
-		s.convergeTags(usePreferred, e)
+		// The filter matches tags in either form so it runs before the tags
+		// are converged. Only the tags the projection keeps are converged.
+		if !filter.allow(e) {
+			s.filteredMetric.Increment(1)
+			continue
+		}
+
+		s.convergeTags(usePreferred, proj, e)
+		proj.apply(e)
 
 		select {
 		case buffer <- e:
@@ -354,12 +695,16 @@ func (s *Server) consumeBatchReceiver(
 			// metric-documentation-v2: (loggregator.rlp.dropped) Number of v2
 			// envelopes dropped while egressing to a consumer.
 			s.droppedMetric.Increment(1)
+			s.load.drop()
+			seq.drop()
 		}
 	}
 }
 
 func (s *Server) consumeReceiver(
 	usePreferred bool,
+	filter *envelopeFilter,
+	proj *projection,
 	buffer chan<- *loggregator_v2.Envelope,
 	rx func() (*loggregator_v2.Envelope, error),
 	cancel func(),
@@ -379,7 +724,15 @@ func (s *Server) consumeReceiver(
 			break
 		}
 
-		s.convergeTags(usePreferred, e)
+		// The filter matches tags in either form so it runs before the tags
+		// are converged. Only the tags the projection keeps are converged.
+		if !filter.allow(e) {
+			s.filteredMetric.Increment(1)
+			continue
+		}
+
+		s.convergeTags(usePreferred, proj, e)
+		proj.apply(e)
 
 		select {
 		case buffer <- e:
@@ -387,17 +740,22 @@ func (s *Server) consumeReceiver(
 			// metric-documentation-v2: (loggregator.rlp.dropped) Number of v2
 			// envelopes dropped while egressing to a consumer.
 			s.droppedMetric.Increment(1)
+			s.load.drop()
 		}
 	}
 }
 
-func (s *Server) convergeTags(usePreferred bool, e *loggregator_v2.Envelope) {
+func (s *Server) convergeTags(usePreferred bool, proj *projection, e *loggregator_v2.Envelope) {
 	if usePreferred {
 		if e.Tags == nil {
 			e.Tags = make(map[string]string)
 		}
 
 		for name, value := range e.GetDeprecatedTags() {
+			if !proj.keepsTag(name, false) {
+				continue
+			}
+
 			switch x := value.Data.(type) {
 			case *loggregator_v2.Value_Decimal:
 				e.GetTags()[name] = fmt.Sprint(x.Decimal)
@@ -416,6 +774,10 @@ func (s *Server) convergeTags(usePreferred bool, e *loggregator_v2.Envelope) {
 	}
 
 	for name, value := range e.GetTags() {
+		if !proj.keepsTag(name, true) {
+			continue
+		}
+
 		e.GetDeprecatedTags()[name] = &loggregator_v2.Value{
 			Data: &loggregator_v2.Value_Text{
 				Text: value,
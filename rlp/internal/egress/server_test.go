@@ -1139,6 +1139,7 @@ type spyReceiverServer struct {
 	err       error
 	wait      chan struct{}
 	envelopes chan *loggregator_v2.Envelope
+	ctx       context.Context
 
 	grpc.ServerStream
 }
@@ -1150,7 +1151,11 @@ func newSpyReceiverServer(err error) *spyReceiverServer {
 	}
 }
 
-func (*spyReceiverServer) Context() context.Context {
+func (s *spyReceiverServer) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+
 	return context.Background()
 }
 
@@ -1176,6 +1181,7 @@ type spyBatchedReceiverServer struct {
 	err       error
 	envelopes chan *loggregator_v2.Envelope
 	delay     time.Duration
+	ctx       context.Context
 
 	grpc.ServerStream
 }
@@ -1187,7 +1193,11 @@ func newSpyBatchedReceiverServer(err error) *spyBatchedReceiverServer {
 	}
 }
 
-func (*spyBatchedReceiverServer) Context() context.Context {
+func (s *spyBatchedReceiverServer) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+
 	return context.Background()
 }
 
@@ -0,0 +1,142 @@
+package ingress
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// dedupeSet remembers the fingerprints of the envelopes of a subscription
+// for a window. It holds at most max fingerprints. When it is full the
+// oldest fingerprint is evicted, so a later duplicate of that envelope is no
+// longer suppressed. Envelopes are never dropped because the set is full.
+type dedupeSet struct {
+	window time.Duration
+	max    int
+
+	mu    sync.Mutex
+	seen  map[uint64]struct{}
+	order []dedupeEntry
+	head  int
+}
+
+type dedupeEntry struct {
+	fingerprint uint64
+	expires     time.Time
+}
+
+func newDedupeSet(window time.Duration, max int) *dedupeSet {
+	return &dedupeSet{
+		window: window,
+		max:    max,
+		seen:   make(map[uint64]struct{}),
+	}
+}
+
+// check reports whether an envelope with the same fingerprint was seen within
+// the window and otherwise remembers it. It also reports whether a
+// fingerprint was evicted to make room.
+func (d *dedupeSet) check(e *loggregator_v2.Envelope, now time.Time) (duplicate, evicted bool) {
+	fp := fingerprint(e)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for d.len() > 0 && !d.order[d.head].expires.After(now) {
+		d.evictOldest()
+	}
+
+	if _, ok := d.seen[fp]; ok {
+		return true, false
+	}
+
+	if d.max > 0 && d.len() >= d.max {
+		d.evictOldest()
+		evicted = true
+	}
+
+	d.seen[fp] = struct{}{}
+	d.order = append(d.order, dedupeEntry{
+		fingerprint: fp,
+		expires:     now.Add(d.window),
+	})
+
+	return false, evicted
+}
+
+func (d *dedupeSet) len() int {
+	return len(d.order) - d.head
+}
+
+func (d *dedupeSet) evictOldest() {
+	delete(d.seen, d.order[d.head].fingerprint)
+	d.head++
+
+	// Reclaim the evicted entries once they make up half of the slice.
+	if d.head > len(d.order)/2 {
+		n := copy(d.order, d.order[d.head:])
+		d.order = d.order[:n]
+		d.head = 0
+	}
+}
+
+// fingerprint hashes the source ID, instance ID, timestamp, type and payload
+// of the envelope. Tags are not part of the fingerprint since routers and
+// agents may add their own.
+func fingerprint(e *loggregator_v2.Envelope) uint64 {
+	h := fnv.New64a()
+	writeString(h, e.GetSourceId())
+	writeString(h, e.GetInstanceId())
+	writeUint64(h, uint64(e.GetTimestamp()))
+
+	switch m := e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		h.Write([]byte{1, byte(m.Log.GetType())})
+		h.Write(m.Log.GetPayload())
+	case *loggregator_v2.Envelope_Counter:
+		h.Write([]byte{2})
+		writeString(h, m.Counter.GetName())
+		writeUint64(h, m.Counter.GetDelta())
+		writeUint64(h, m.Counter.GetTotal())
+	case *loggregator_v2.Envelope_Gauge:
+		h.Write([]byte{3})
+
+		// Metrics are summed so that the map order does not matter.
+		var sum uint64
+		for name, v := range m.Gauge.GetMetrics() {
+			mh := fnv.New64a()
+			writeString(mh, name)
+			writeString(mh, v.GetUnit())
+			writeUint64(mh, math.Float64bits(v.GetValue()))
+			sum += mh.Sum64()
+		}
+		writeUint64(h, sum)
+	case *loggregator_v2.Envelope_Timer:
+		h.Write([]byte{4})
+		writeString(h, m.Timer.GetName())
+		writeUint64(h, uint64(m.Timer.GetStart()))
+		writeUint64(h, uint64(m.Timer.GetStop()))
+	case *loggregator_v2.Envelope_Event:
+		h.Write([]byte{5})
+		writeString(h, m.Event.GetTitle())
+		writeString(h, m.Event.GetBody())
+	}
+
+	return h.Sum64()
+}
+
+func writeString(h hash.Hash64, s string) {
+	writeUint64(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+func writeUint64(h hash.Hash64, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	h.Write(b[:])
+}
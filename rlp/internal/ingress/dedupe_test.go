@@ -0,0 +1,139 @@
+package ingress_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/plumbing"
+	"code.cloudfoundry.org/loggregator/rlp/internal/ingress"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deduplication", func() {
+	var (
+		routerA      *spyRouter
+		routerB      *spyRouter
+		metricClient *testhelper.SpyMetricClient
+		cancel       func()
+	)
+
+	BeforeEach(func() {
+		routerA = startMockDopplerServer()
+		routerB = startMockDopplerServer()
+		metricClient = testhelper.NewMetricClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+		routerA.Stop()
+		routerB.Stop()
+	})
+
+	subscribe := func(window time.Duration, maxEntries int) <-chan *loggregator_v2.Envelope {
+		finder := newMockFinder()
+		connector := ingress.NewGRPCConnector(
+			5,
+			ingress.NewPool(2, grpc.WithInsecure()),
+			finder,
+			metricClient,
+			ingress.WithDedupe(window, maxEntries),
+		)
+
+		finder.NextOutput.Ret0 <- plumbing.Event{
+			GRPCDopplers: createGrpcURIs(routerA, routerB),
+		}
+		Eventually(finder.NextCalled).Should(HaveLen(2))
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		data, _, ready := readFromSubscription(ctx, &loggregator_v2.EgressBatchRequest{
+			ShardId: "test-sub-id",
+		}, connector)
+		Eventually(ready).Should(BeClosed())
+
+		return data
+	}
+
+	It("suppresses envelopes received from both routers", func() {
+		data := subscribe(time.Minute, 2)
+		senderA := captureSubscribeSender(routerA)
+		senderB := captureSubscribeSender(routerB)
+
+		e := &loggregator_v2.Envelope{SourceId: "A", Timestamp: 1}
+		Expect(senderA.Send(&loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{e},
+		})).To(Succeed())
+		Expect(senderB.Send(&loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{e, {SourceId: "C"}},
+		})).To(Succeed())
+
+		Eventually(data).Should(Receive(Equal(e)))
+		Eventually(data).Should(Receive(Equal(&loggregator_v2.Envelope{SourceId: "C"})))
+		Expect(metricClient.GetDelta("deduplicated")).To(Equal(uint64(1)))
+	})
+
+	It("forgets the oldest envelopes when the limit is reached", func() {
+		data := subscribe(time.Minute, 2)
+		senderA := captureSubscribeSender(routerA)
+
+		batch := []*loggregator_v2.Envelope{
+			{SourceId: "A", Timestamp: 1},
+			{SourceId: "A", Timestamp: 2},
+			{SourceId: "A", Timestamp: 3},
+			{SourceId: "A", Timestamp: 1},
+		}
+		Expect(senderA.Send(&loggregator_v2.EnvelopeBatch{Batch: batch})).To(Succeed())
+
+		for _, e := range batch {
+			Eventually(data).Should(Receive(Equal(e)))
+		}
+		Expect(metricClient.GetDelta("deduplicated")).To(BeZero())
+		Expect(metricClient.GetDelta("dedupe_evictions")).To(Equal(uint64(2)))
+	})
+
+	It("keeps every envelope up to the limit", func() {
+		data := subscribe(time.Minute, 2)
+		senderA := captureSubscribeSender(routerA)
+
+		Expect(senderA.Send(&loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{
+				{SourceId: "A", Timestamp: 1},
+				{SourceId: "A", Timestamp: 2},
+				{SourceId: "A", Timestamp: 1},
+				{SourceId: "A", Timestamp: 2},
+			},
+		})).To(Succeed())
+
+		Eventually(data).Should(Receive(Equal(&loggregator_v2.Envelope{SourceId: "A", Timestamp: 1})))
+		Eventually(data).Should(Receive(Equal(&loggregator_v2.Envelope{SourceId: "A", Timestamp: 2})))
+		Eventually(func() uint64 {
+			return metricClient.GetDelta("deduplicated")
+		}).Should(Equal(uint64(2)))
+		Expect(metricClient.GetDelta("dedupe_evictions")).To(BeZero())
+	})
+
+	It("sends an envelope again once the window lapsed", func() {
+		data := subscribe(100*time.Millisecond, 10)
+		senderA := captureSubscribeSender(routerA)
+
+		e := &loggregator_v2.Envelope{SourceId: "A", Timestamp: 1}
+		Expect(senderA.Send(&loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{e},
+		})).To(Succeed())
+		Eventually(data).Should(Receive(Equal(e)))
+
+		time.Sleep(200 * time.Millisecond)
+
+		Expect(senderA.Send(&loggregator_v2.EnvelopeBatch{
+			Batch: []*loggregator_v2.Envelope{e},
+		})).To(Succeed())
+		Eventually(data).Should(Receive(Equal(e)))
+		Expect(metricClient.GetDelta("deduplicated")).To(BeZero())
+	})
+})
@@ -1,12 +1,11 @@
 package ingress
 
 import (
-	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator/metricemitter"
@@ -17,13 +16,14 @@ import (
 )
 
 const (
-	maxConnections = 2000
+	defaultMaxConsumers = 2000
 )
 
 // DopplerPool creates a pool of doppler gRPC connections
 type DopplerPool interface {
 	RegisterDoppler(addr string)
 	Subscribe(dopplerAddr string, ctx context.Context, req *loggregator_v2.EgressBatchRequest) (loggregator_v2.Egress_BatchedReceiverClient, error)
+	Connections(dopplerAddr string) int
 
 	Close(dopplerAddr string)
 }
@@ -39,19 +39,26 @@ type GRPCConnector struct {
 	mu      sync.RWMutex
 	clients []*dopplerClientInfo
 
-	pool           DopplerPool
-	finder         Finder
-	consumerStates []unsafe.Pointer
-	bufferSize     int
-
-	ingressMetric    *metricemitter.Counter
-	disconnectMetric *metricemitter.Counter
-	connectMetric    *metricemitter.Counter
+	pool         DopplerPool
+	finder       Finder
+	consumers    *consumerRegistry
+	maxConsumers int
+	bufferSize   int
+	dedupeWindow time.Duration
+	dedupeMax    int
+
+	ingressMetric      *metricemitter.Counter
+	dedupedMetric      *metricemitter.Counter
+	evictedMetric      *metricemitter.Counter
+	disconnectMetric   *metricemitter.Counter
+	connectMetric      *metricemitter.Counter
+	routerStateMetrics map[plumbing.RouterState]*metricemitter.Gauge
 }
 
 // MetricClient creates new CounterMetrics to be emitted periodically.
 type MetricClient interface {
 	NewCounter(name string, opts ...metricemitter.MetricOption) *metricemitter.Counter
+	NewGauge(name, unit string, opts ...metricemitter.MetricOption) *metricemitter.Gauge
 }
 
 // NewGRPCConnector creates a new GRPCConnector.
@@ -60,6 +67,7 @@ func NewGRPCConnector(
 	pool DopplerPool,
 	f Finder,
 	m MetricClient,
+	opts ...GRPCConnectorOption,
 ) *GRPCConnector {
 	ingressMetric := m.NewCounter("ingress",
 		metricemitter.WithTags(map[string]string{
@@ -70,21 +78,75 @@ func NewGRPCConnector(
 	disconnectMetric := m.NewCounter("log_router_disconnects")
 	connectMetric := m.NewCounter("log_router_connects")
 
+	// metric-documentation-v2: (loggregator.rlp.deduplicated) Number of v2
+	// envelopes received from more than one router and suppressed.
+	dedupedMetric := m.NewCounter("deduplicated",
+		metricemitter.WithVersion(2, 0),
+	)
+
+	// metric-documentation-v2: (loggregator.rlp.dedupe_evictions) Number of
+	// envelope fingerprints forgotten before their window lapsed because a
+	// subscription reached its limit.
+	evictedMetric := m.NewCounter("dedupe_evictions",
+		metricemitter.WithVersion(2, 0),
+	)
+
 	c := &GRPCConnector{
-		bufferSize:       bufferSize,
-		pool:             pool,
-		finder:           f,
-		consumerStates:   make([]unsafe.Pointer, maxConnections),
-		ingressMetric:    ingressMetric,
-		disconnectMetric: disconnectMetric,
-		connectMetric:    connectMetric,
+		bufferSize:         bufferSize,
+		maxConsumers:       defaultMaxConsumers,
+		pool:               pool,
+		finder:             f,
+		ingressMetric:      ingressMetric,
+		disconnectMetric:   disconnectMetric,
+		connectMetric:      connectMetric,
+		dedupedMetric:      dedupedMetric,
+		evictedMetric:      evictedMetric,
+		routerStateMetrics: plumbing.NewRouterStateGauges(m),
+	}
+	for _, o := range opts {
+		o(c)
 	}
+	c.consumers = newConsumerRegistry(c.maxConsumers)
+
 	go c.readFinder()
 	return c
 }
 
+// GRPCConnectorOption is used to configure a new GRPCConnector.
+type GRPCConnectorOption func(*GRPCConnector)
+
+// WithMaxConsumers sets the maximum number of concurrent subscriptions. A
+// value of 0 or less removes the limit. It defaults to 2000.
+func WithMaxConsumers(n int) GRPCConnectorOption {
+	return func(c *GRPCConnector) {
+		c.maxConsumers = n
+	}
+}
+
+// WithDedupe suppresses envelopes a subscription receives more than once,
+// for example from agents that send to two routers. Envelopes are compared
+// by source ID, instance ID, timestamp, type and payload. An envelope is
+// suppressed if the same envelope was received within the window. Each
+// subscription remembers at most maxEntries envelopes; beyond that the
+// oldest are forgotten and their duplicates are no longer suppressed.
+// maxEntries must be positive when deduplication is enabled. A window of 0
+// or less disables deduplication, which is the default.
+func WithDedupe(window time.Duration, maxEntries int) GRPCConnectorOption {
+	return func(c *GRPCConnector) {
+		c.dedupeWindow = window
+		c.dedupeMax = maxEntries
+	}
+}
+
 // Subscribe returns a Receiver that yields all corresponding messages from Doppler
 func (c *GRPCConnector) Subscribe(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (recv func() (*loggregator_v2.Envelope, error), err error) {
+	recv, _, err = c.SubscribeWithStatus(ctx, req)
+	return recv, err
+}
+
+// SubscribeWithStatus is like Subscribe but also returns a function that
+// reports how many dopplers the subscription is currently attached to.
+func (c *GRPCConnector) SubscribeWithStatus(ctx context.Context, req *loggregator_v2.EgressBatchRequest) (recv func() (*loggregator_v2.Envelope, error), attached func() int, err error) {
 	cs := &consumerState{
 		data:     make(chan *loggregator_v2.Envelope, c.bufferSize),
 		errs:     make(chan error, 1),
@@ -92,24 +154,97 @@ func (c *GRPCConnector) Subscribe(ctx context.Context, req *loggregator_v2.Egres
 		req:      req,
 		dopplers: make(map[string]bool),
 	}
+	if c.dedupeWindow > 0 {
+		cs.dedupe = newDedupeSet(c.dedupeWindow, c.dedupeMax)
+	}
+
+	err = c.consumers.add(cs)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	go func() {
 		<-cs.ctx.Done()
 		atomic.StoreInt64(&cs.dead, 1)
+		c.consumers.remove(cs)
 	}()
 
-	err = c.addConsumerState(cs)
-	if err != nil {
-		return nil, err
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, client := range c.clients {
+		go c.consumeSubscription(cs, client)
 	}
+	return cs.Recv, cs.Attached, nil
+}
 
+// RouterStates returns the connection state of each doppler known to the
+// connector.
+func (c *GRPCConnector) RouterStates() map[string]plumbing.RouterState {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	states := make(map[string]plumbing.RouterState, len(c.clients))
 	for _, client := range c.clients {
-		go c.consumeSubscription(cs, client)
+		states[client.uri] = client.breaker.State()
+	}
+
+	return states
+}
+
+// RouterStatus is the connection status of a doppler.
+type RouterStatus struct {
+	Addr  string               `json:"addr"`
+	State plumbing.RouterState `json:"state"`
+
+	// Connections is the number of established connections to the doppler.
+	Connections int `json:"connections"`
+
+	// Streams is the number of subscriptions currently streaming from the
+	// doppler.
+	Streams int `json:"streams"`
+
+	LastConnect   *time.Time `json:"last_connect,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// RouterStatuses returns the connection status of each doppler known to the
+// connector, ordered by address.
+func (c *GRPCConnector) RouterStatuses() []RouterStatus {
+	c.mu.RLock()
+	clients := make([]*dopplerClientInfo, len(c.clients))
+	copy(clients, c.clients)
+	c.mu.RUnlock()
+
+	statuses := make([]RouterStatus, 0, len(clients))
+	for _, client := range clients {
+		s := client.status()
+		s.Connections = c.pool.Connections(client.uri)
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Addr < statuses[j].Addr
+	})
+
+	return statuses
+}
+
+func (c *GRPCConnector) reportRouterStates() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.setRouterStateMetrics()
+}
+
+// setRouterStateMetrics must be called while holding c.mu.
+func (c *GRPCConnector) setRouterStateMetrics() {
+	states := make([]plumbing.RouterState, 0, len(c.clients))
+	for _, client := range c.clients {
+		states = append(states, client.breaker.State())
 	}
-	return cs.Recv, nil
+
+	plumbing.SetRouterStateGauges(c.routerStateMetrics, states)
 }
 
 func (c *GRPCConnector) readFinder() {
@@ -125,21 +260,24 @@ func (c *GRPCConnector) handleFinderEvent(uris []string) {
 	defer c.mu.Unlock()
 
 	newURIs, deadClients := c.delta(uris)
+	consumers := c.consumers.snapshot()
 
 	for _, addr := range newURIs {
 		c.pool.RegisterDoppler(addr)
 		client := &dopplerClientInfo{
 			uri: addr,
+			breaker: plumbing.NewRouterBreaker(
+				plumbing.WithBreakerStateChange(func(_, _ plumbing.RouterState) {
+					c.reportRouterStates()
+				}),
+			),
 		}
 
 		c.clients = append(c.clients, client)
 
-		for i := range c.consumerStates {
-			cs := atomic.LoadPointer(&c.consumerStates[i])
-			if cs != nil &&
-				(*consumerState)(cs) != nil &&
-				atomic.LoadInt64(&(*consumerState)(cs).dead) == 0 {
-				go c.consumeSubscription((*consumerState)(cs), client)
+		for _, cs := range consumers {
+			if atomic.LoadInt64(&cs.dead) == 0 {
+				go c.consumeSubscription(cs, client)
 			}
 		}
 	}
@@ -154,6 +292,8 @@ func (c *GRPCConnector) handleFinderEvent(uris []string) {
 			c.close(deadClient)
 		}
 	}
+
+	c.setRouterStateMetrics()
 }
 
 func (c *GRPCConnector) delta(uris []string) (add []string, dead []*dopplerClientInfo) {
@@ -202,13 +342,12 @@ func (c *GRPCConnector) consumeSubscription(cs *consumerState, dopplerClient *do
 			log.Printf("closing doppler connection %s...", dopplerClient.uri)
 			c.pool.Close(dopplerClient.uri)
 			c.close(dopplerClient)
+			c.setRouterStateMetrics()
 		}
 
 		cs.forgetDoppler(dopplerClient.uri)
 	}()
 
-	delay := time.Millisecond
-
 	tried := false
 	for {
 		ctxDisconnect := atomic.LoadInt64(&cs.dead)
@@ -219,27 +358,45 @@ func (c *GRPCConnector) consumeSubscription(cs *consumerState, dopplerClient *do
 			c.disconnectMetric.Increment(1)
 			return
 		}
+
+		if ok, wait := dopplerClient.breaker.Allow(); !ok {
+			select {
+			case <-cs.ctx.Done():
+			case <-time.After(wait):
+			}
+			continue
+		}
 		tried = true
 
 		dopplerStream, err := c.pool.Subscribe(dopplerClient.uri, cs.ctx, cs.req)
 		if err != nil {
-			time.Sleep(delay)
-			if delay < time.Minute {
-				delay *= 10
+			if cs.ctx.Err() == nil {
+				dopplerClient.breaker.Failure()
+				dopplerClient.failed(err)
 			}
 			continue
 		}
+		dopplerClient.breaker.Success()
+		dopplerClient.connected()
 		c.connectMetric.Increment(1)
 
-		delay = time.Millisecond
+		atomic.AddInt64(&cs.attached, 1)
+		atomic.AddInt64(&dopplerClient.streams, 1)
+		err = c.readStream(dopplerStream, cs)
+		atomic.AddInt64(&dopplerClient.streams, -1)
+		atomic.AddInt64(&cs.attached, -1)
 
-		if err := c.readStream(dopplerStream, cs); err != nil {
+		if err != nil {
 			if s, ok := status.FromError(err); ok {
 				if s.Code() == codes.Canceled {
 					continue
 				}
 			}
 			log.Printf("Error while reading from stream (%s): %s", dopplerClient.uri, err)
+			if cs.ctx.Err() == nil {
+				dopplerClient.breaker.Failure()
+				dopplerClient.failed(err)
+			}
 
 			continue
 		}
@@ -255,6 +412,10 @@ func (c *GRPCConnector) readStream(s loggregator_v2.Egress_BatchedReceiverClient
 		}
 
 		for _, p := range resp.GetBatch() {
+			if c.duplicate(cs, p) {
+				continue
+			}
+
 			select {
 			case <-cs.ctx.Done():
 				return nil
@@ -268,26 +429,71 @@ func (c *GRPCConnector) readStream(s loggregator_v2.Egress_BatchedReceiverClient
 	}
 }
 
-func (c *GRPCConnector) addConsumerState(cs *consumerState) error {
-	for i := range c.consumerStates {
-		state := atomic.LoadPointer(&c.consumerStates[i])
-		if state == nil ||
-			(*consumerState)(state) == nil ||
-			atomic.LoadInt64(&(*consumerState)(state).dead) != 0 {
+// duplicate reports whether the consumer already received the envelope.
+func (c *GRPCConnector) duplicate(cs *consumerState, e *loggregator_v2.Envelope) bool {
+	if cs.dedupe == nil {
+		return false
+	}
 
-			if atomic.CompareAndSwapPointer(&c.consumerStates[i], state, unsafe.Pointer(cs)) {
-				return nil
-			}
-		}
+	duplicate, evicted := cs.dedupe.check(e, time.Now())
+	if evicted {
+		c.evictedMetric.Increment(1)
+	}
+	if duplicate {
+		c.dedupedMetric.Increment(1)
 	}
 
-	return fmt.Errorf("at connection limit: %d", maxConnections)
+	return duplicate
 }
 
 type dopplerClientInfo struct {
 	uri        string
 	disconnect bool
 	refCount   int64
+	streams    int64
+	breaker    *plumbing.RouterBreaker
+
+	statusMu    sync.Mutex
+	lastConnect time.Time
+	lastErr     string
+	lastErrTime time.Time
+}
+
+func (d *dopplerClientInfo) connected() {
+	d.statusMu.Lock()
+	defer d.statusMu.Unlock()
+
+	d.lastConnect = time.Now()
+}
+
+func (d *dopplerClientInfo) failed(err error) {
+	d.statusMu.Lock()
+	defer d.statusMu.Unlock()
+
+	d.lastErr = err.Error()
+	d.lastErrTime = time.Now()
+}
+
+func (d *dopplerClientInfo) status() RouterStatus {
+	d.statusMu.Lock()
+	defer d.statusMu.Unlock()
+
+	s := RouterStatus{
+		Addr:      d.uri,
+		State:     d.breaker.State(),
+		Streams:   int(atomic.LoadInt64(&d.streams)),
+		LastError: d.lastErr,
+	}
+	if !d.lastConnect.IsZero() {
+		t := d.lastConnect
+		s.LastConnect = &t
+	}
+	if !d.lastErrTime.IsZero() {
+		t := d.lastErrTime
+		s.LastErrorTime = &t
+	}
+
+	return s
 }
 
 type consumerState struct {
@@ -298,6 +504,8 @@ type consumerState struct {
 	missed    int
 	maxMissed int
 	dead      int64
+	attached  int64
+	dedupe    *dedupeSet
 
 	mu       sync.Mutex
 	dopplers map[string]bool
@@ -314,6 +522,12 @@ func (cs *consumerState) Recv() (*loggregator_v2.Envelope, error) {
 	}
 }
 
+// Attached returns the number of dopplers the consumer is currently
+// receiving from.
+func (cs *consumerState) Attached() int {
+	return int(atomic.LoadInt64(&cs.attached))
+}
+
 func (cs *consumerState) tryAddDoppler(doppler string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -0,0 +1,57 @@
+package ingress_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/metricemitter/testhelper"
+	"code.cloudfoundry.org/loggregator/plumbing"
+	"code.cloudfoundry.org/loggregator/rlp/internal/ingress"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func BenchmarkSubscribeUnsubscribe(b *testing.B) {
+	connector := newBenchmarkConnector()
+	req := &loggregator_v2.EgressBatchRequest{ShardId: "some-shard"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		if _, err := connector.Subscribe(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+		cancel()
+	}
+}
+
+func BenchmarkSubscribeUnsubscribeParallel(b *testing.B) {
+	connector := newBenchmarkConnector()
+	req := &loggregator_v2.EgressBatchRequest{ShardId: "some-shard"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ctx, cancel := context.WithCancel(context.Background())
+			if _, err := connector.Subscribe(ctx, req); err != nil {
+				b.Fatal(err)
+			}
+			cancel()
+		}
+	})
+}
+
+func newBenchmarkConnector() *ingress.GRPCConnector {
+	return ingress.NewGRPCConnector(
+		5,
+		ingress.NewPool(1, grpc.WithInsecure()),
+		plumbing.NewStaticFinder(nil),
+		testhelper.NewMetricClient(),
+		ingress.WithMaxConsumers(0),
+	)
+}
@@ -149,6 +149,47 @@ var _ = Describe("GRPCConnector", func() {
 					return metricClient.GetDelta("log_router_connects")
 				}).Should(Equal(uint64(2)))
 			})
+
+			It("reports each doppler as connected", func() {
+				Eventually(mockDopplerServerA.requests).Should(Receive())
+				Eventually(mockDopplerServerB.requests).Should(Receive())
+
+				Eventually(connector.RouterStates).Should(Equal(map[string]plumbing.RouterState{
+					mockDopplerServerA.addr.String(): plumbing.RouterConnected,
+					mockDopplerServerB.addr.String(): plumbing.RouterConnected,
+				}))
+			})
+
+			It("reports the status of each doppler", func() {
+				Eventually(mockDopplerServerA.requests).Should(Receive())
+				Eventually(mockDopplerServerB.requests).Should(Receive())
+
+				var statuses []ingress.RouterStatus
+				Eventually(func() int {
+					statuses = connector.RouterStatuses()
+					var streams int
+					for _, s := range statuses {
+						streams += s.Streams
+					}
+					return streams
+				}).Should(Equal(2))
+
+				Expect(statuses).To(HaveLen(2))
+				for _, s := range statuses {
+					Expect(s.State).To(Equal(plumbing.RouterConnected))
+					Expect(s.Connections).To(BeNumerically(">", 0))
+					Expect(s.LastConnect).ToNot(BeNil())
+					Expect(s.LastError).To(BeEmpty())
+				}
+				Expect(statuses[0].Addr < statuses[1].Addr).To(BeTrue())
+			})
+
+			It("reports how many dopplers a subscription is attached to", func() {
+				_, attached, err := connector.SubscribeWithStatus(ctx, req)
+				Expect(err).ToNot(HaveOccurred())
+
+				Eventually(attached).Should(Equal(2))
+			})
 		})
 
 		Context("when a doppler disconnects", func() {
@@ -165,6 +206,19 @@ var _ = Describe("GRPCConnector", func() {
 				Eventually(mockDopplerServerB.requests).Should(Receive())
 			})
 
+			It("records the last error of a doppler", func() {
+				mockDopplerServerA.Stop()
+
+				Eventually(func() string {
+					for _, s := range connector.RouterStatuses() {
+						if s.Addr == mockDopplerServerA.addr.String() {
+							return s.LastError
+						}
+					}
+					return ""
+				}, 5).ShouldNot(BeEmpty())
+			})
+
 			It("emits a counter metric for total doppler disconnects", func() {
 				cancelCtx()
 
@@ -85,6 +85,23 @@ func (p *Pool) Close(dopplerAddr string) {
 	}
 }
 
+// Connections returns the number of established connections to the
+// doppler.
+func (p *Pool) Connections(dopplerAddr string) int {
+	p.mu.RLock()
+	clients := p.dopplers[dopplerAddr]
+	p.mu.RUnlock()
+
+	var n int
+	for i := range clients {
+		if atomic.LoadPointer(&clients[i]) != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
 func (p *Pool) fetchClient(clients []unsafe.Pointer) loggregator_v2.EgressClient {
 	seed := rand.Int()
 	for i := range clients {
@@ -53,6 +53,15 @@ var _ = Describe("Pool", func() {
 				Eventually(accepter1).Should(HaveLen(2))
 				Eventually(accepter2).Should(HaveLen(2))
 			})
+
+			It("reports the connections to each doppler", func() {
+				pool.RegisterDoppler(lis1.Addr().String())
+
+				Eventually(func() int {
+					return pool.Connections(lis1.Addr().String())
+				}).Should(Equal(2))
+				Expect(pool.Connections(lis2.Addr().String())).To(Equal(0))
+			})
 		})
 
 		Describe("Close()", func() {
@@ -38,20 +38,18 @@ func main() {
 		conf.GRPC.KeyFile,
 		conf.GRPC.CAFile,
 		"doppler",
+		plumbing.WithCRLFiles(conf.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Fatalf("Could not use TLS config: %s", err)
 	}
 
-	var opts []plumbing.ConfigOption
-	if len(conf.GRPC.CipherSuites) > 0 {
-		opts = append(opts, plumbing.WithCipherSuites(conf.GRPC.CipherSuites))
-	}
 	rlpCredentials, err := plumbing.NewServerCredentials(
 		conf.GRPC.CertFile,
 		conf.GRPC.KeyFile,
 		conf.GRPC.CAFile,
-		opts...,
+		plumbing.WithTLSPolicy(conf.GRPC.TLSPolicy()),
+		plumbing.WithCRLFiles(conf.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Fatalf("Could not use TLS config: %s", err)
@@ -62,15 +60,21 @@ func main() {
 		conf.GRPC.KeyFile,
 		conf.GRPC.CAFile,
 		"metron",
+		plumbing.WithCRLFiles(conf.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Fatalf("Could not use TLS config: %s", err)
 	}
 
+	peerStats := plumbing.NewPeerStatsHandler(plumbing.WithMaxPeers(conf.MaxStatsPeers))
+
 	// metric-documentation-v2: setup function
 	metric, err := metricemitter.NewClient(
 		conf.AgentAddr,
-		metricemitter.WithGRPCDialOptions(grpc.WithTransportCredentials(metronCredentials)),
+		metricemitter.WithGRPCDialOptions(
+			grpc.WithTransportCredentials(metronCredentials),
+			grpc.WithStatsHandler(peerStats),
+		),
 		metricemitter.WithOrigin("loggregator.rlp"),
 		metricemitter.WithPulseInterval(conf.MetricEmitterInterval),
 		metricemitter.WithSourceID(conf.MetricSourceID),
@@ -79,6 +83,11 @@ func main() {
 		log.Fatalf("Couldn't connect to metric emitter: %s", err)
 	}
 
+	streamQuotas, err := conf.StreamQuotas()
+	if err != nil {
+		log.Fatalf("Invalid stream quotas: %s", err)
+	}
+
 	ingressKP := keepalive.ClientParameters{
 		Time:                15 * time.Second,
 		Timeout:             20 * time.Second,
@@ -88,21 +97,54 @@ func main() {
 		MinTime:             10 * time.Second,
 		PermitWithoutStream: true,
 	}
-	rlp := app.NewRLP(
-		metric,
+	egressOpts := []grpc.ServerOption{
+		grpc.Creds(rlpCredentials),
+		grpc.KeepaliveEnforcementPolicy(egressKP),
+	}
+	if rules := conf.GRPC.AuthzRules(); len(rules) > 0 {
+		authorizer := plumbing.NewPeerAuthorizer(rules)
+		egressOpts = append(egressOpts,
+			grpc.UnaryInterceptor(authorizer.UnaryServerInterceptor()),
+			grpc.StreamInterceptor(authorizer.StreamServerInterceptor()),
+		)
+	}
+	rlpOpts := []app.RLPOption{
 		app.WithEgressPort(conf.GRPC.Port),
 		app.WithIngressAddrs(conf.RouterAddrs),
 		app.WithIngressDialOptions(
 			grpc.WithTransportCredentials(dopplerCredentials),
 			grpc.WithKeepaliveParams(ingressKP),
 		),
-		app.WithEgressServerOptions(
-			grpc.Creds(rlpCredentials),
-			grpc.KeepaliveEnforcementPolicy(egressKP),
-		),
+		app.WithEgressServerOptions(egressOpts...),
 		app.WithHealthAddr(conf.HealthAddr),
 		app.WithMaxEgressStreams(conf.MaxEgressStreams),
-	)
+		app.WithMaxIngressSubscriptions(conf.MaxRouterSubscriptions),
+		app.WithMaxEgressBatchBytes(conf.MaxEgressBatchBytes),
+		app.WithSizeMetricsInterval(conf.MetricEmitterInterval),
+		app.WithPeerStats(peerStats),
+		app.WithMinReadyRouters(conf.MinReadyRouters),
+		app.WithEgressStreamQuotas(streamQuotas),
+		app.WithDedupe(conf.DedupeWindow, conf.DedupeMaxEntries),
+		app.WithIngressBufferSize(conf.IngressBufferSize),
+		app.WithEgressBufferSizeBounds(conf.MinEgressBufferSize, conf.MaxEgressBufferSize),
+		app.WithAdmissionThresholds(conf.AdmissionThresholds()),
+	}
+	switch {
+	case conf.RouterAddrsFile != "":
+		rlpOpts = append(rlpOpts, app.WithIngressFinder(
+			plumbing.NewFileFinder(conf.RouterAddrsFile),
+		))
+	case conf.RouterDNSAddr != "":
+		rlpOpts = append(rlpOpts, app.WithIngressFinder(
+			plumbing.NewDNSFinder(
+				conf.RouterDNSAddr,
+				plumbing.WithDNSRefreshInterval(conf.RouterDNSInterval),
+				plumbing.WithDNSJitter(conf.RouterDNSJitter),
+			),
+		))
+	}
+
+	rlp := app.NewRLP(metric, rlpOpts...)
 	go rlp.Start()
 	defer rlp.Stop()
 	go profiler.New(conf.PProfPort).Start()
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	envstruct "code.cloudfoundry.org/go-envstruct"
+	"code.cloudfoundry.org/loggregator/plumbing"
 )
 
 // Agent stores the configuration for connecting to the Agent over gRPC.
@@ -14,11 +15,46 @@ type Agent struct {
 // GRPC stores the configuration for the router as a server using a PORT
 // with mTLS certs and as a client also using mTSL certs for emitting metrics.
 type GRPC struct {
-	Port         uint16   `env:"ROUTER_PORT"`
-	CertFile     string   `env:"ROUTER_CERT_FILE"`
-	KeyFile      string   `env:"ROUTER_KEY_FILE"`
-	CAFile       string   `env:"ROUTER_CA_FILE"`
-	CipherSuites []string `env:"ROUTER_CIPHER_SUITES"`
+	Port             uint16   `env:"ROUTER_PORT"`
+	CertFile         string   `env:"ROUTER_CERT_FILE"`
+	KeyFile          string   `env:"ROUTER_KEY_FILE"`
+	CAFile           string   `env:"ROUTER_CA_FILE"`
+	CipherSuites     []string `env:"ROUTER_CIPHER_SUITES"`
+	MinTLSVersion    string   `env:"ROUTER_MIN_TLS_VERSION"`
+	MaxTLSVersion    string   `env:"ROUTER_MAX_TLS_VERSION"`
+	CurvePreferences []string `env:"ROUTER_CURVE_PREFERENCES"`
+	CRLFiles         []string `env:"ROUTER_CRL_FILES"`
+
+	// IngressAllowedPeers and EgressAllowedPeers are the certificate
+	// identities allowed to write to and read from the router. When empty
+	// any peer with a certificate signed by the CA is allowed.
+	IngressAllowedPeers []string `env:"ROUTER_INGRESS_ALLOWED_PEERS"`
+	EgressAllowedPeers  []string `env:"ROUTER_EGRESS_ALLOWED_PEERS"`
+}
+
+// TLSPolicy returns the TLS policy for the router server.
+func (g GRPC) TLSPolicy() plumbing.TLSPolicy {
+	return plumbing.TLSPolicy{
+		CipherSuites:     g.CipherSuites,
+		MinVersion:       g.MinTLSVersion,
+		MaxVersion:       g.MaxTLSVersion,
+		CurvePreferences: g.CurvePreferences,
+	}
+}
+
+// AuthzRules returns the peer authorization rules for the router server.
+func (g GRPC) AuthzRules() map[string][]string {
+	rules := make(map[string][]string)
+	if len(g.IngressAllowedPeers) > 0 {
+		rules["/loggregator.v2.Ingress/*"] = g.IngressAllowedPeers
+		rules["/plumbing.DopplerIngestor/*"] = g.IngressAllowedPeers
+	}
+	if len(g.EgressAllowedPeers) > 0 {
+		rules["/loggregator.v2.Egress/*"] = g.EgressAllowedPeers
+		rules["/plumbing.Doppler/*"] = g.EgressAllowedPeers
+	}
+
+	return rules
 }
 
 // Config stores all configurations options for the Router.
@@ -29,12 +65,20 @@ type Config struct {
 	MaxRetainedLogMessages       uint32 `env:"ROUTER_MAX_RETAINED_LOG_MESSAGES"`
 	SinkInactivityTimeoutSeconds int    `env:"ROUTER_SINK_INACTIVITY_TIMEOUT_SECONDS"`
 
+	// egress
+	MaxEgressBatchBytes int `env:"ROUTER_MAX_EGRESS_BATCH_BYTES"`
+
 	// health
 	PProfPort                       uint32 `env:"ROUTER_PPROF_PORT"`
 	HealthAddr                      string `env:"ROUTER_HEALTH_ADDR"`
 	Agent                           Agent
 	MetricBatchIntervalMilliseconds uint   `env:"ROUTER_METRIC_BATCH_INTERVAL_MILLISECONDS"`
 	MetricSourceID                  string `env:"ROUTER_METRIC_SOURCE_ID"`
+	MaxStatsPeers                   int    `env:"ROUTER_MAX_STATS_PEERS"`
+
+	// MaxIngressDrops is the number of envelopes the ingress buffers may
+	// drop between health checks before the router reports NOT_SERVING.
+	MaxIngressDrops uint64 `env:"ROUTER_HEALTH_MAX_INGRESS_DROPS"`
 }
 
 // LoadConfig reads from the environment to create a Config.
@@ -43,6 +87,9 @@ func LoadConfig() (*Config, error) {
 		MetricBatchIntervalMilliseconds: 5000,
 		HealthAddr:                      "localhost:14825",
 		MetricSourceID:                  "doppler",
+		MaxEgressBatchBytes:             3 * 1024 * 1024,
+		MaxStatsPeers:                   500,
+		MaxIngressDrops:                 10000,
 	}
 
 	err := envstruct.Load(&config)
@@ -75,5 +122,9 @@ func (c *Config) validate() (err error) {
 		return errors.New("invalid router config, no GRPC.KeyFile provided")
 	}
 
+	if err := c.GRPC.TLSPolicy().Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
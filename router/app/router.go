@@ -1,8 +1,10 @@
 package app
 
 import (
+	"fmt"
 	"log"
 	"net"
+	"sync/atomic"
 	"time"
 
 	gendiodes "code.cloudfoundry.org/go-diodes"
@@ -16,7 +18,6 @@ import (
 	"code.cloudfoundry.org/loggregator/router/internal/sinks"
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -25,6 +26,9 @@ type Router struct {
 	c              *Config
 	healthListener net.Listener
 	server         *server.Server
+	health         *plumbing.GRPCHealth
+	checks         *healthendpoint.Checks
+	stopSizes      func()
 	addrs          Addrs
 }
 
@@ -41,6 +45,9 @@ func NewRouter(grpc GRPC, opts ...RouterOption) *Router {
 				GRPCAddress: "127.0.0.1:3458",
 			},
 			MetricBatchIntervalMilliseconds: 5000,
+			MaxEgressBatchBytes:             3 * 1024 * 1024,
+			MaxStatsPeers:                   500,
+			MaxIngressDrops:                 10000,
 		},
 	}
 
@@ -70,6 +77,30 @@ func WithMetricReporting(
 	}
 }
 
+// WithMaxEgressBatchBytes specifies the maximum encoded size of a batch sent
+// to a v2 subscriber. A value of 0 or less removes the limit.
+func WithMaxEgressBatchBytes(n int) RouterOption {
+	return func(r *Router) {
+		r.c.MaxEgressBatchBytes = n
+	}
+}
+
+// WithMaxStatsPeers specifies the number of distinct gRPC peers that bytes
+// and messages are reported for. A value of 0 or less removes the limit.
+func WithMaxStatsPeers(n int) RouterOption {
+	return func(r *Router) {
+		r.c.MaxStatsPeers = n
+	}
+}
+
+// WithMaxIngressDrops specifies the number of envelopes the ingress buffers
+// may drop between health checks before the router reports NOT_SERVING.
+func WithMaxIngressDrops(n uint64) RouterOption {
+	return func(r *Router) {
+		r.c.MaxIngressDrops = n
+	}
+}
+
 // WithPersistence turns on recent log storage.
 func WithPersistence(
 	maxRetainedLogMessages uint32,
@@ -91,16 +122,65 @@ func (d *Router) Start() {
 	//------------------------------
 	// v2 Metrics (gRPC)
 	//------------------------------
-	metricClient := initV2Metrics(d.c)
+	peerStats := plumbing.NewPeerStatsHandler(plumbing.WithMaxPeers(d.c.MaxStatsPeers))
+	metricClient := initV2Metrics(d.c, grpc.WithStatsHandler(peerStats))
 
 	//------------------------------
 	// Health
 	//------------------------------
 	promRegistry := prometheus.NewRegistry()
-	d.healthListener = healthendpoint.StartServer(d.c.HealthAddr, promRegistry)
+	d.checks = healthendpoint.NewChecks()
+	d.healthListener = healthendpoint.StartServer(
+		d.c.HealthAddr,
+		promRegistry,
+		healthendpoint.WithChecks(d.checks),
+	)
 	d.addrs.Health = d.healthListener.Addr().String()
 	healthRegistrar := initHealthRegistrar(promRegistry)
 
+	// metric-documentation-health: (revokedPeers)
+	// Number of peers rejected because their certificate was revoked
+	promRegistry.MustRegister(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "loggregator",
+			Subsystem: "router",
+			Name:      "revokedPeers",
+			Help:      "Number of peers rejected because their certificate was revoked",
+		},
+		func() float64 {
+			return float64(plumbing.RevokedPeers())
+		},
+	))
+
+	// metric-documentation-health: (peerBytes)
+	// Payload bytes exchanged with each gRPC peer
+	// metric-documentation-health: (peerMessages)
+	// Messages exchanged with each gRPC peer
+	promRegistry.MustRegister(healthendpoint.NewPeerStatsCollector(
+		"loggregator",
+		"router",
+		peerStats.Stats,
+	))
+
+	// metric-documentation-health: (tlsCertExpiry)
+	// Expiry of each TLS certificate in use, as a unix timestamp
+	promRegistry.MustRegister(healthendpoint.NewValueCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "router",
+			Name:      "tlsCertExpiry",
+			Help:      "Expiry of each TLS certificate in use, as a unix timestamp",
+		},
+		"cert",
+		func() map[string]float64 {
+			expiries := make(map[string]float64)
+			for cert, expiry := range plumbing.CertExpiries() {
+				expiries[cert] = float64(expiry.Unix())
+			}
+			return expiries
+		},
+	))
+
 	//------------------------------
 	// In memory store of
 	// - recent logs
@@ -137,16 +217,19 @@ func (d *Router) Start() {
 		metricemitter.WithVersion(2, 0),
 	)
 
+	saturation := &diodeSaturation{max: d.c.MaxIngressDrops}
 	v1Buf := diodes.NewManyToOneEnvelope(10000, gendiodes.AlertFunc(func(missed int) {
 		log.Printf("Dropped %d envelopes (v1 buffer)", missed)
 
 		ingressDropped.Increment(uint64(missed))
+		saturation.dropped(missed)
 	}))
 
 	v2Buf := diodes.NewManyToOneEnvelopeV2(10000, gendiodes.AlertFunc(func(missed int) {
 		log.Printf("Dropped %d envelopes (v2 buffer)", missed)
 
 		ingressDropped.Increment(uint64(missed))
+		saturation.dropped(missed)
 	}))
 
 	// metric-documentation-v2: (loggregator.doppler.subscriptions) Number of
@@ -187,32 +270,50 @@ func (d *Router) Start() {
 		healthRegistrar,
 		100*time.Millisecond,
 		100,
+		v2.WithMaxBatchBytes(d.c.MaxEgressBatchBytes),
 	)
 
-	var opts []plumbing.ConfigOption
-	if len(d.c.GRPC.CipherSuites) > 0 {
-		opts = append(opts, plumbing.WithCipherSuites(d.c.GRPC.CipherSuites))
-	}
-	tlsConfig, err := plumbing.NewServerMutualTLSConfig(
+	serverCreds, err := plumbing.NewServerCredentials(
 		d.c.GRPC.CertFile,
 		d.c.GRPC.KeyFile,
 		d.c.GRPC.CAFile,
-		opts...,
+		plumbing.WithTLSPolicy(d.c.GRPC.TLSPolicy()),
+		plumbing.WithCRLFiles(d.c.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Panicf("Failed to create tls config for router server: %s", err)
 	}
+	srvOpts := []grpc.ServerOption{
+		grpc.Creds(serverCreds),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	sizeStats := plumbing.NewSizeStatsHandler()
+	d.stopSizes = initSizeMetrics(d.c, sizeStats, metricClient, promRegistry)
+	srvOpts = append(srvOpts, grpc.StatsHandler(
+		plumbing.NewMultiStatsHandler(sizeStats, peerStats),
+	))
+	if rules := d.c.GRPC.AuthzRules(); len(rules) > 0 {
+		authorizer := plumbing.NewPeerAuthorizer(rules)
+		srvOpts = append(srvOpts,
+			grpc.UnaryInterceptor(authorizer.UnaryServerInterceptor()),
+			grpc.StreamInterceptor(authorizer.StreamServerInterceptor()),
+		)
+	}
+	d.health = plumbing.NewGRPCHealth(
+		func() error { return d.server.Accepting() },
+		saturation.check,
+	)
 	srv, err := server.NewServer(
 		d.c.GRPC.Port,
 		v1Ingress,
 		v1Egress,
 		v2Ingress,
 		v2Egress,
-		grpc.Creds(credentials.NewTLS(tlsConfig)),
-		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
-			MinTime:             10 * time.Second,
-			PermitWithoutStream: true,
-		}),
+		d.health,
+		srvOpts...,
 	)
 	if err != nil {
 		log.Panicf("Failed to create router server: %s", err)
@@ -220,6 +321,7 @@ func (d *Router) Start() {
 
 	d.server = srv
 	d.addrs.GRPC = d.server.Addr()
+	d.checks.AddReadiness(healthendpoint.NewCheck("grpc_listener", d.server.Accepting))
 
 	//------------------------------
 	// Start
@@ -231,6 +333,7 @@ func (d *Router) Start() {
 	go repeater.Start()
 
 	go d.server.Start()
+	d.health.Start(healthCheckInterval)
 
 	log.Print("Startup: router server started.")
 }
@@ -249,16 +352,20 @@ func (d *Router) Addrs() Addrs {
 // Stop closes the gRPC and health listeners.
 func (d *Router) Stop() {
 	// TODO: Drain
+	d.health.Drain()
+	d.checks.Shutdown()
 	d.healthListener.Close()
 	d.server.Stop()
+	d.stopSizes()
 }
 
-func initV2Metrics(c *Config) *metricemitter.Client {
+func initV2Metrics(c *Config, opts ...grpc.DialOption) *metricemitter.Client {
 	credentials, err := plumbing.NewClientCredentials(
 		c.GRPC.CertFile,
 		c.GRPC.KeyFile,
 		c.GRPC.CAFile,
 		"metron",
+		plumbing.WithCRLFiles(c.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Fatalf("Could not use GRPC creds for server: %s", err)
@@ -269,7 +376,9 @@ func initV2Metrics(c *Config) *metricemitter.Client {
 	// metric-documentation-v2: setup function
 	metricClient, err := metricemitter.NewClient(
 		c.Agent.GRPCAddress,
-		metricemitter.WithGRPCDialOptions(grpc.WithTransportCredentials(credentials)),
+		metricemitter.WithGRPCDialOptions(
+			append(opts, grpc.WithTransportCredentials(credentials))...,
+		),
 		metricemitter.WithOrigin("loggregator.doppler"),
 		metricemitter.WithPulseInterval(batchInterval),
 		metricemitter.WithSourceID(c.MetricSourceID),
@@ -281,6 +390,61 @@ func initV2Metrics(c *Config) *metricemitter.Client {
 	return metricClient
 }
 
+// initSizeMetrics emits the sizes of the gRPC messages until the returned
+// stop func is called.
+func initSizeMetrics(
+	c *Config,
+	h *plumbing.SizeStatsHandler,
+	m *metricemitter.Client,
+	r prometheus.Registerer,
+) (stop func()) {
+	batchInterval := time.Duration(c.MetricBatchIntervalMilliseconds) * time.Millisecond
+
+	var stops []func()
+	for direction, hist := range map[string]*plumbing.SizeHistogram{
+		"in":  h.In(),
+		"out": h.Out(),
+	} {
+		// metric-documentation-v2: (loggregator.doppler.message_size_p50) 50th
+		// percentile of gRPC message sizes in bytes per interval.
+		// metric-documentation-v2: (loggregator.doppler.message_size_p95) 95th
+		// percentile of gRPC message sizes in bytes per interval.
+		// metric-documentation-v2: (loggregator.doppler.message_size_p99) 99th
+		// percentile of gRPC message sizes in bytes per interval.
+		// metric-documentation-v2: (loggregator.doppler.message_size_bucket)
+		// Number of gRPC messages per size bucket per interval.
+		stops = append(stops, hist.EmitMetrics(m, "message_size", batchInterval,
+			metricemitter.WithVersion(2, 0),
+			metricemitter.WithTags(map[string]string{
+				"direction": direction,
+			}),
+		))
+
+		hist := hist
+		// metric-documentation-health: (messageSize)
+		// Size of gRPC messages in bytes
+		r.MustRegister(healthendpoint.NewHistogramCollector(
+			prometheus.HistogramOpts{
+				Namespace:   "loggregator",
+				Subsystem:   "router",
+				Name:        "messageSize",
+				Help:        "Size of gRPC messages in bytes",
+				ConstLabels: prometheus.Labels{"direction": direction},
+			},
+			func() (uint64, float64, map[float64]uint64) {
+				s := hist.Snapshot()
+				return s.Count(), float64(s.Total), s.Buckets()
+			},
+		))
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
 func initHealthRegistrar(r prometheus.Registerer) *healthendpoint.Registrar {
 	return healthendpoint.New(r, map[string]prometheus.Gauge{
 		// metric-documentation-health: (ingressStreamCount)
@@ -315,3 +479,27 @@ func initHealthRegistrar(r prometheus.Registerer) *healthendpoint.Registrar {
 		),
 	})
 }
+
+// healthCheckInterval is how often the conditions reported by the gRPC
+// health service are evaluated.
+const healthCheckInterval = 5 * time.Second
+
+// diodeSaturation fails its check when the ingress diodes have dropped more
+// than max envelopes since the last check. Occasional drops are expected
+// under bursts and do not take the router out of service.
+type diodeSaturation struct {
+	missed uint64
+	max    uint64
+}
+
+func (s *diodeSaturation) dropped(missed int) {
+	atomic.AddUint64(&s.missed, uint64(missed))
+}
+
+func (s *diodeSaturation) check() error {
+	if missed := atomic.SwapUint64(&s.missed, 0); missed > s.max {
+		return fmt.Errorf("ingress diodes dropped %d envelopes (max %d)", missed, s.max)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -18,18 +19,21 @@ type Server struct {
 	grpcServer *grpc.Server
 
 	mu      sync.Mutex
+	started bool
 	stopped bool
 }
 
 // NewServer is the constructor for Server. The constructor attempts to open a
 // listener on the provided port and will return an error if that binding
-// fails.
+// fails. The standard gRPC health service is registered with the given
+// health.
 func NewServer(
 	port uint16,
 	v1Ingress plumbingv1.DopplerIngestorServer,
 	v1Egress plumbingv1.DopplerServer,
 	v2Ingress loggregator_v2.IngressServer,
 	v2Egress loggregator_v2.EgressServer,
+	health *plumbingv1.GRPCHealth,
 	srvOpts ...grpc.ServerOption,
 ) (*Server, error) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
@@ -44,6 +48,7 @@ func NewServer(
 	plumbingv1.RegisterDopplerServer(grpcServer, v1Egress)
 	loggregator_v2.RegisterIngressServer(grpcServer, v2Ingress)
 	loggregator_v2.RegisterEgressServer(grpcServer, v2Egress)
+	health.Register(grpcServer)
 
 	s := &Server{
 		listener:   lis,
@@ -56,6 +61,10 @@ func NewServer(
 // Start initiates the gRPC server.
 func (g *Server) Start() {
 	log.Printf("Starting gRPC server on %s", g.listener.Addr().String())
+	g.mu.Lock()
+	g.started = true
+	g.mu.Unlock()
+
 	if err := g.grpcServer.Serve(g.listener); err != nil {
 		g.mu.Lock()
 		stopped := g.stopped
@@ -75,6 +84,22 @@ func (g *Server) Stop() {
 	g.grpcServer.Stop()
 }
 
+// Accepting returns an error unless the server has been started and has not
+// been stopped.
+func (g *Server) Accepting() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.started {
+		return errors.New("grpc server has not started")
+	}
+	if g.stopped {
+		return errors.New("grpc server has stopped")
+	}
+
+	return nil
+}
+
 // Addr provides the address of the listener.
 func (g *Server) Addr() string {
 	return g.listener.Addr().String()
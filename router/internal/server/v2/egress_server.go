@@ -32,6 +32,19 @@ type EgressServer struct {
 	health              HealthRegistrar
 	batchInterval       time.Duration
 	batchSize           uint
+	maxBatchBytes       int
+}
+
+// EgressServerOption configures an EgressServer.
+type EgressServerOption func(*EgressServer)
+
+// WithMaxBatchBytes specifies the maximum encoded size of a batch sent to a
+// subscriber. A value of 0 or less removes the limit. It defaults to 3MB to
+// stay below the default gRPC message limit.
+func WithMaxBatchBytes(n int) EgressServerOption {
+	return func(s *EgressServer) {
+		s.maxBatchBytes = n
+	}
 }
 
 // NewEgressServer is the constructor for EgressServer.
@@ -43,6 +56,7 @@ func NewEgressServer(
 	h HealthRegistrar,
 	batchInterval time.Duration,
 	batchSize uint,
+	opts ...EgressServerOption,
 ) *EgressServer {
 	// metric-documentation-v2: (loggregator.doppler.egress) Number of
 	// envelopes read from a diode to be sent to subscriptions.
@@ -50,7 +64,7 @@ func NewEgressServer(
 		metricemitter.WithVersion(2, 0),
 	)
 
-	return &EgressServer{
+	e := &EgressServer{
 		subscriber:          s,
 		egressMetric:        egressMetric,
 		droppedMetric: 		 droppedMetric,
@@ -58,7 +72,13 @@ func NewEgressServer(
 		health:              h,
 		batchInterval:       batchInterval,
 		batchSize:           batchSize,
+		maxBatchBytes:       3 * 1024 * 1024,
+	}
+	for _, o := range opts {
+		o(e)
 	}
+
+	return e
 }
 
 // Alert logs dropped message counts to stderr.
@@ -99,6 +119,7 @@ func (s *EgressServer) BatchedReceiver(
 			errStream:    errStream,
 			egressMetric: s.egressMetric,
 		},
+		batching.WithMaxBatchBytes(s.maxBatchBytes),
 	)
 
 	c := make(chan *loggregator_v2.Envelope)
@@ -37,6 +37,9 @@ func main() {
 			conf.MetricBatchIntervalMilliseconds,
 			conf.MetricSourceID,
 		),
+		app.WithMaxEgressBatchBytes(conf.MaxEgressBatchBytes),
+		app.WithMaxStatsPeers(conf.MaxStatsPeers),
+		app.WithMaxIngressDrops(conf.MaxIngressDrops),
 	)
 	r.Start()
 
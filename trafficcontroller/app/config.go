@@ -15,9 +15,10 @@ type Agent struct {
 
 // GRPC stores TLS configuration for gRPC communcation to router and agent.
 type GRPC struct {
-	CAFile   string `env:"ROUTER_CA_FILE"`
-	CertFile string `env:"ROUTER_CERT_FILE"`
-	KeyFile  string `env:"ROUTER_KEY_FILE"`
+	CAFile   string   `env:"ROUTER_CA_FILE"`
+	CertFile string   `env:"ROUTER_CERT_FILE"`
+	KeyFile  string   `env:"ROUTER_KEY_FILE"`
+	CRLFiles []string `env:"ROUTER_CRL_FILES"`
 }
 
 // LogCacheTLSConfig stores TLS configuration for gRPC communcation to router and agent.
@@ -39,24 +40,29 @@ type CCTLSClientConfig struct {
 
 // Config stores all Configuration options for trafficcontroller.
 type Config struct {
-	IP                    string        `env:"TRAFFIC_CONTROLLER_IP, report"`
-	ApiHost               string        `env:"TRAFFIC_CONTROLLER_API_HOST, report"`
-	OutgoingDropsondePort uint32        `env:"TRAFFIC_CONTROLLER_OUTGOING_DROPSONDE_PORT, report"`
-	OutgoingCertFile      string        `env:"TRAFFIC_CONTROLLER_OUTGOING_CERT_FILE, report"`
-	OutgoingKeyFile       string        `env:"TRAFFIC_CONTROLLER_OUTGOING_KEY_FILE, report"`
-	SystemDomain          string        `env:"TRAFFIC_CONTROLLER_SYSTEM_DOMAIN, report"`
-	SkipCertVerify        bool          `env:"TRAFFIC_CONTROLLER_SKIP_CERT_VERIFY, report"`
-	UaaHost               string        `env:"TRAFFIC_CONTROLLER_UAA_HOST, report"`
-	UaaClient             string        `env:"TRAFFIC_CONTROLLER_UAA_CLIENT, report"`
-	UaaClientSecret       string        `env:"TRAFFIC_CONTROLLER_UAA_CLIENT_SECRET"`
-	UaaCACert             string        `env:"TRAFFIC_CONTROLLER_UAA_CA_CERT, report"`
-	SecurityEventLog      string        `env:"TRAFFIC_CONTROLLER_SECURITY_EVENT_LOG, report"`
-	PProfPort             uint32        `env:"TRAFFIC_CONTROLLER_PPROF_PORT, report"`
-	MetricEmitterInterval time.Duration `env:"TRAFFIC_CONTROLLER_METRIC_EMITTER_INTERVAL, report"`
-	HealthAddr            string        `env:"TRAFFIC_CONTROLLER_HEALTH_ADDR, report"`
-	DisableAccessControl  bool          `env:"TRAFFIC_CONTROLLER_DISABLE_ACCESS_CONTROL, report"`
-	RouterAddrs           []string      `env:"ROUTER_ADDRS, report"`
-	LogCacheAddr          string        `env:"LOG_CACHE_ADDR, report"`
+	IP                     string        `env:"TRAFFIC_CONTROLLER_IP, report"`
+	ApiHost                string        `env:"TRAFFIC_CONTROLLER_API_HOST, report"`
+	OutgoingDropsondePort  uint32        `env:"TRAFFIC_CONTROLLER_OUTGOING_DROPSONDE_PORT, report"`
+	OutgoingCertFile       string        `env:"TRAFFIC_CONTROLLER_OUTGOING_CERT_FILE, report"`
+	OutgoingKeyFile        string        `env:"TRAFFIC_CONTROLLER_OUTGOING_KEY_FILE, report"`
+	SystemDomain           string        `env:"TRAFFIC_CONTROLLER_SYSTEM_DOMAIN, report"`
+	SkipCertVerify         bool          `env:"TRAFFIC_CONTROLLER_SKIP_CERT_VERIFY, report"`
+	UaaHost                string        `env:"TRAFFIC_CONTROLLER_UAA_HOST, report"`
+	UaaClient              string        `env:"TRAFFIC_CONTROLLER_UAA_CLIENT, report"`
+	UaaClientSecret        string        `env:"TRAFFIC_CONTROLLER_UAA_CLIENT_SECRET"`
+	UaaCACert              string        `env:"TRAFFIC_CONTROLLER_UAA_CA_CERT, report"`
+	SecurityEventLog       string        `env:"TRAFFIC_CONTROLLER_SECURITY_EVENT_LOG, report"`
+	PProfPort              uint32        `env:"TRAFFIC_CONTROLLER_PPROF_PORT, report"`
+	MetricEmitterInterval  time.Duration `env:"TRAFFIC_CONTROLLER_METRIC_EMITTER_INTERVAL, report"`
+	HealthAddr             string        `env:"TRAFFIC_CONTROLLER_HEALTH_ADDR, report"`
+	DisableAccessControl   bool          `env:"TRAFFIC_CONTROLLER_DISABLE_ACCESS_CONTROL, report"`
+	RouterAddrs            []string      `env:"ROUTER_ADDRS, report"`
+	RouterDNSAddr          string        `env:"ROUTER_DNS_ADDR, report"`
+	RouterAddrsFile        string        `env:"ROUTER_ADDRS_FILE, report"`
+	RouterDNSInterval      time.Duration `env:"ROUTER_DNS_INTERVAL, report"`
+	RouterDNSJitter        time.Duration `env:"ROUTER_DNS_JITTER, report"`
+	LogCacheAddr           string        `env:"LOG_CACHE_ADDR, report"`
+	MaxRouterSubscriptions int           `env:"MAX_ROUTER_SUBSCRIPTIONS, report"`
 
 	CCTLSClientConfig CCTLSClientConfig
 	Agent             Agent
@@ -67,8 +73,11 @@ type Config struct {
 // LoadConfig reads from the environment to create a Config.
 func LoadConfig() (*Config, error) {
 	config := Config{
-		MetricEmitterInterval: time.Minute,
-		HealthAddr:            "localhost:14825",
+		MetricEmitterInterval:  time.Minute,
+		HealthAddr:             "localhost:14825",
+		MaxRouterSubscriptions: 2000,
+		RouterDNSInterval:      10 * time.Second,
+		RouterDNSJitter:        2 * time.Second,
 		LogCacheTLSConfig: LogCacheTLSConfig{
 			ServerName: "log_cache",
 		},
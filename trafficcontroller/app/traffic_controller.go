@@ -75,7 +75,15 @@ func (t *TrafficController) Start() {
 
 	// Start the health endpoint listener
 	promRegistry := prometheus.NewRegistry()
-	healthendpoint.StartServer(t.conf.HealthAddr, promRegistry)
+	checks := healthendpoint.NewChecks()
+	if !t.disableAccessControl {
+		checks.AddReadiness(healthendpoint.NewCheck("uaa_reachable", t.uaaReachable))
+	}
+	healthendpoint.StartServer(
+		t.conf.HealthAddr,
+		promRegistry,
+		healthendpoint.WithChecks(checks),
+	)
 	healthRegistry := healthendpoint.New(promRegistry, map[string]prometheus.Gauge{
 		// metric-documentation-health: (firehoseStreamCount)
 		// Number of open firehose streams
@@ -115,13 +123,61 @@ func (t *TrafficController) Start() {
 		t.conf.GRPC.KeyFile,
 		t.conf.GRPC.CAFile,
 		"doppler",
+		plumbing.WithCRLFiles(t.conf.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Fatalf("Could not use GRPC creds for server: %s", err)
 	}
 
-	f := plumbing.NewStaticFinder(t.conf.RouterAddrs)
-	f.Start()
+	// metric-documentation-health: (revokedPeers)
+	// Number of peers rejected because their certificate was revoked
+	promRegistry.MustRegister(prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "loggregator",
+			Subsystem: "trafficcontroller",
+			Name:      "revokedPeers",
+			Help:      "Number of peers rejected because their certificate was revoked",
+		},
+		func() float64 {
+			return float64(plumbing.RevokedPeers())
+		},
+	))
+
+	// metric-documentation-health: (tlsCertExpiry)
+	// Expiry of each TLS certificate in use, as a unix timestamp
+	promRegistry.MustRegister(healthendpoint.NewValueCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "trafficcontroller",
+			Name:      "tlsCertExpiry",
+			Help:      "Expiry of each TLS certificate in use, as a unix timestamp",
+		},
+		"cert",
+		func() map[string]float64 {
+			expiries := make(map[string]float64)
+			for cert, expiry := range plumbing.CertExpiries() {
+				expiries[cert] = float64(expiry.Unix())
+			}
+			return expiries
+		},
+	))
+
+	// metric-documentation-health: (routerAddrs)
+	// Router addresses currently known to the traffic controller
+	routerAddrs := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "trafficcontroller",
+			Name:      "routerAddrs",
+			Help:      "Router addresses currently known to the traffic controller",
+		},
+		[]string{"addr"},
+	)
+	promRegistry.MustRegister(routerAddrs)
+
+	finder := t.routerFinder()
+	finder.Start()
+	f := plumbing.NewReportingFinder(finder, routerAddrs)
 
 	kp := keepalive.ClientParameters{
 		Time:                15 * time.Second,
@@ -129,7 +185,32 @@ func (t *TrafficController) Start() {
 		PermitWithoutStream: true,
 	}
 	pool := plumbing.NewPool(20, grpc.WithTransportCredentials(creds), grpc.WithKeepaliveParams(kp))
-	grpcConnector := plumbing.NewGRPCConnector(1000, pool, f, t.metricClient)
+	grpcConnector := plumbing.NewGRPCConnector(
+		1000,
+		pool,
+		f,
+		t.metricClient,
+		plumbing.WithMaxConsumers(t.conf.MaxRouterSubscriptions),
+	)
+
+	// metric-documentation-health: (routerState)
+	// Connection state of each router
+	promRegistry.MustRegister(healthendpoint.NewStateCollector(
+		prometheus.GaugeOpts{
+			Namespace: "loggregator",
+			Subsystem: "trafficcontroller",
+			Name:      "routerState",
+			Help:      "Connection state of each router",
+		},
+		"addr",
+		func() map[string]string {
+			states := make(map[string]string)
+			for addr, state := range grpcConnector.RouterStates() {
+				states[addr] = state.String()
+			}
+			return states
+		},
+	))
 
 	var logCacheClient proxy.LogCacheClient
 	recentLogsEnabled := false
@@ -157,7 +238,13 @@ func (t *TrafficController) Start() {
 		recentLogsEnabled = true
 	}
 
-	recentLogsHandler := proxy.NewRecentLogsHandler(logCacheClient, 5*time.Second, t.metricClient, recentLogsEnabled)
+	recentLogsHandler := proxy.NewRecentLogsHandler(
+		logCacheClient,
+		5*time.Second,
+		t.metricClient,
+		recentLogsEnabled,
+		proxy.WithRouterFallback(grpcConnector),
+	)
 
 	dopplerHandler := http.Handler(
 		proxy.NewDopplerProxy(
@@ -210,4 +297,42 @@ func (t *TrafficController) Start() {
 	signal.Notify(killChan, os.Interrupt)
 	<-killChan
 	log.Print("Shutting down")
+	checks.Shutdown()
+}
+
+// uaaReachable returns an error unless UAA responds successfully to a
+// request for its health.
+func (t *TrafficController) uaaReachable() error {
+	resp, err := t.uaaHTTPClient.Get(t.conf.UaaHost + "/healthz")
+	if err != nil {
+		return fmt.Errorf("failed to reach UAA: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("UAA health returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+type routerFinder interface {
+	Start()
+	Next() plumbing.Event
+}
+
+func (t *TrafficController) routerFinder() routerFinder {
+	if t.conf.RouterAddrsFile != "" {
+		return plumbing.NewFileFinder(t.conf.RouterAddrsFile)
+	}
+
+	if t.conf.RouterDNSAddr != "" {
+		return plumbing.NewDNSFinder(
+			t.conf.RouterDNSAddr,
+			plumbing.WithDNSRefreshInterval(t.conf.RouterDNSInterval),
+			plumbing.WithDNSJitter(t.conf.RouterDNSJitter),
+		)
+	}
+
+	return plumbing.NewStaticFinder(t.conf.RouterAddrs)
 }
@@ -29,19 +29,37 @@ type LogCacheClient interface {
 	) ([]*loggregator_v2.Envelope, error)
 }
 
+// RouterRecentLogsProvider queries the routers for the recent logs of an app.
+type RouterRecentLogsProvider interface {
+	RecentLogs(ctx context.Context, appID string) ([][]byte, error)
+}
+
 type RecentLogsHandler struct {
 	recentLogProvider   LogCacheClient
+	routerProvider      RouterRecentLogsProvider
 	timeout             time.Duration
 	latencyMetric       *metricemitter.Gauge
 	logCacheFailsMetric *metricemitter.Counter
 	logCacheEnabled     bool
 }
 
+// RecentLogsHandlerOption configures a RecentLogsHandler.
+type RecentLogsHandlerOption func(*RecentLogsHandler)
+
+// WithRouterFallback configures the handler to query the routers for recent
+// logs when log cache is disabled.
+func WithRouterFallback(p RouterRecentLogsProvider) RecentLogsHandlerOption {
+	return func(h *RecentLogsHandler) {
+		h.routerProvider = p
+	}
+}
+
 func NewRecentLogsHandler(
 	recentLogProvider LogCacheClient,
 	t time.Duration,
 	m MetricClient,
 	logCacheEnabled bool,
+	opts ...RecentLogsHandlerOption,
 ) *RecentLogsHandler {
 	// metric-documentation-v2: (doppler_proxy.recent_logs_latency) Measures
 	// amount of time to serve the request for recent logs
@@ -53,16 +71,26 @@ func NewRecentLogsHandler(
 		metricemitter.WithVersion(2, 0),
 	)
 
-	return &RecentLogsHandler{
+	h := &RecentLogsHandler{
 		recentLogProvider:   recentLogProvider,
 		timeout:             t,
 		latencyMetric:       latencyMetric,
 		logCacheFailsMetric: logCacheFailsMetric,
 		logCacheEnabled:     logCacheEnabled,
 	}
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
 }
 
 func (h *RecentLogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.logCacheEnabled && h.routerProvider != nil {
+		h.serveFromRouters(w, r)
+		return
+	}
+
 	if !h.logCacheEnabled {
 		envelopeBytes, err := (&events.Envelope{
 			Origin:    proto.String("loggregator.trafficcontroller"),
@@ -129,6 +157,39 @@ func (h *RecentLogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	serveMultiPartResponse(w, resp)
 }
 
+func (h *RecentLogsHandler) serveFromRouters(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	defer func() {
+		elapsedMillisecond := float64(time.Since(startTime)) / float64(time.Millisecond)
+		h.latencyMetric.Set(elapsedMillisecond)
+	}()
+
+	appID := mux.Vars(r)["appID"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	resp, err := h.routerProvider.RecentLogs(ctx, appID)
+	if err != nil {
+		log.Printf("error querying routers for recent logs: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("failed to read recent logs from routers"))
+		return
+	}
+
+	limit, ok := limitFrom(r)
+	if !ok {
+		limit = 1000
+	}
+
+	// The routers return logs oldest first. Keep the most recent ones.
+	if len(resp) > limit {
+		resp = resp[len(resp)-limit:]
+	}
+
+	serveMultiPartResponse(w, resp)
+}
+
 func backoffSearchForLogs(limit int, ctx context.Context, appID string, logProvider LogCacheClient) ([]*loggregator_v2.Envelope, error) {
 	envelopes, err := logProvider.Read(
 		ctx,
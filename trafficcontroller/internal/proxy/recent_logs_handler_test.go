@@ -189,6 +189,73 @@ var _ = Describe("Recent Logs Handler", func() {
 		Expect(logEnvelope.GetLogMessage().GetSourceType()).To(Equal("Loggregator"))
 	})
 
+	Context("when LogCache is disabled and a router fallback is configured", func() {
+		var routers *fakeRouterRecentLogsProvider
+
+		BeforeEach(func() {
+			routers = &fakeRouterRecentLogsProvider{
+				logs: [][]byte{
+					[]byte("log1"),
+					[]byte("log2"),
+					[]byte("log3"),
+				},
+			}
+
+			recentLogsHandler = proxy.NewRecentLogsHandler(
+				logCacheClient,
+				200*time.Millisecond,
+				testhelper.NewMetricClient(),
+				false,
+				proxy.WithRouterFallback(routers),
+			)
+		})
+
+		It("returns the recent logs from the routers", func() {
+			req, _ := http.NewRequest("GET", "/apps/8de7d390-9044-41ff-ab76-432299923511/recentlogs", nil)
+			req.Header.Add("Authorization", "token")
+
+			recentLogsHandler.ServeHTTP(recorder, req)
+
+			Expect(readMultiPartResponse(recorder)).To(Equal(routers.logs))
+		})
+
+		It("returns the most recent logs when a limit is given", func() {
+			req, _ := http.NewRequest("GET", "/apps/8de7d390-9044-41ff-ab76-432299923511/recentlogs?limit=2", nil)
+			req.Header.Add("Authorization", "token")
+
+			recentLogsHandler.ServeHTTP(recorder, req)
+
+			Expect(readMultiPartResponse(recorder)).To(Equal([][]byte{
+				[]byte("log2"),
+				[]byte("log3"),
+			}))
+		})
+
+		It("returns a 500 when the routers fail", func() {
+			routers.err = errors.New("It failed")
+
+			req, _ := http.NewRequest("GET", "/apps/8de7d390-9044-41ff-ab76-432299923511/recentlogs", nil)
+			req.Header.Add("Authorization", "token")
+
+			recentLogsHandler.ServeHTTP(recorder, req)
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(Equal("failed to read recent logs from routers"))
+		})
+
+		It("cancels the router query when the request is done", func() {
+			reqCtx, cancel := context.WithCancel(context.Background())
+			req, _ := http.NewRequest("GET", "/apps/8de7d390-9044-41ff-ab76-432299923511/recentlogs", nil)
+			req = req.WithContext(reqCtx)
+			req.Header.Add("Authorization", "token")
+			cancel()
+
+			recentLogsHandler.ServeHTTP(recorder, req)
+
+			Expect(routers.ctx.Err()).To(Equal(context.Canceled))
+		})
+	})
+
 	It("increments a metric when calls to log cache fail", func() {
 		spyMetricClient := testhelper.NewMetricClient()
 		logCacheClient.err <- errors.New("Failed to read from Log Cache")
@@ -305,3 +372,35 @@ func buildV2Gauge(sid, instanceId string, cpu float64, t int64) *loggregator_v2.
 		},
 	}
 }
+
+type fakeRouterRecentLogsProvider struct {
+	logs [][]byte
+	err  error
+	ctx  context.Context
+}
+
+func (f *fakeRouterRecentLogsProvider) RecentLogs(ctx context.Context, appID string) ([][]byte, error) {
+	f.ctx = ctx
+	return f.logs, f.err
+}
+
+func readMultiPartResponse(recorder *httptest.ResponseRecorder) [][]byte {
+	boundaryRegexp := regexp.MustCompile("boundary=(.*)")
+	matches := boundaryRegexp.FindStringSubmatch(recorder.Header().Get("Content-Type"))
+	ExpectWithOffset(1, matches).To(HaveLen(2))
+	reader := multipart.NewReader(recorder.Body, matches[1])
+
+	var parts [][]byte
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+
+		partBytes, err := ioutil.ReadAll(part)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		parts = append(parts, partBytes)
+	}
+
+	return parts
+}
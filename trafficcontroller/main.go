@@ -31,6 +31,7 @@ func main() {
 		conf.GRPC.KeyFile,
 		conf.GRPC.CAFile,
 		"metron",
+		plumbing.WithCRLFiles(conf.GRPC.CRLFiles...),
 	)
 	if err != nil {
 		log.Fatalf("Could not use GRPC creds for client: %s", err)